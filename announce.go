@@ -0,0 +1,158 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Kinds of announcements.
+const (
+	// AnnounceServiceRemoved is sent by Server.Unregister.
+	AnnounceServiceRemoved = "serviceRemoved"
+
+	// AnnounceDraining is sent by Server.Drain.
+	AnnounceDraining = "draining"
+)
+
+// Announcement is a notice a server pushes to the clients subscribed with
+// Client.SubscribeAnnouncements before it stops serving some calls, so they
+// can redirect them before they start failing.
+type Announcement struct {
+	// Kind is AnnounceServiceRemoved or AnnounceDraining.
+	Kind string `json:"-"`
+
+	// Service is the service being removed, empty when the server drains.
+	Service string `json:"service,omitempty"`
+
+	// Deadline is when calls will start failing.
+	Deadline time.Time `json:"deadline"`
+}
+
+// subscribeBuiltin implements rpc.announcements, subscribing the connection to
+// the server's announcements until it ends.
+func (conn *Connection) subscribeBuiltin(req *Request) (interface{}, error) {
+	if conn.c == nil {
+		return nil, ErrNoPeerChannel
+	}
+
+	conn.s.announceMu.Lock()
+	defer conn.s.announceMu.Unlock()
+
+	if conn.s.subscribers == nil {
+		conn.s.subscribers = make(map[*Connection]bool)
+	}
+	conn.s.subscribers[conn] = true
+
+	return nil, nil
+}
+
+func (s *Server) unsubscribe(conn *Connection) {
+	s.announceMu.Lock()
+	delete(s.subscribers, conn)
+	s.announceMu.Unlock()
+}
+
+// announce sends a to the subscribed connections. They are notified without
+// the lock held, so a slow connection doesn't hold up subscriptions or the end
+// of other connections.
+func (s *Server) announce(a *Announcement) {
+	s.announceMu.Lock()
+	subscribers := make([]*Connection, 0, len(s.subscribers))
+	for conn := range s.subscribers {
+		subscribers = append(subscribers, conn)
+	}
+	s.announceMu.Unlock()
+
+	for _, conn := range subscribers {
+		if err := conn.notify(builtinService+"."+a.Kind, a); err != nil {
+			s.logf("jsonrpc: announce %s to %s: %v", a.Kind, conn.info.RemoteAddr, err)
+		}
+	}
+}
+
+// Unregister removes the service registered under name once grace has elapsed,
+// announcing it right away to subscribed clients with rpc.serviceRemoved. It
+// doesn't wait for the removal.
+func (s *Server) Unregister(name string, grace time.Duration) error {
+	s.services.RLock()
+	svc, ok := s.serviceMap[name]
+	s.services.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("service '%s' not found", name)
+	}
+
+	s.announce(&Announcement{
+		Kind:     AnnounceServiceRemoved,
+		Service:  name,
+		Deadline: time.Now().Add(grace),
+	})
+
+	remove := func() {
+		s.services.Lock()
+		defer s.services.Unlock()
+
+		// the service may have been replaced in the meantime
+		if s.serviceMap[name] == svc {
+			delete(s.serviceMap, name)
+		}
+	}
+
+	if grace <= 0 {
+		remove()
+	} else {
+		time.AfterFunc(grace, remove)
+	}
+
+	return nil
+}
+
+// Drain announces to subscribed clients with rpc.draining that the server will
+// stop serving after grace, and returns that deadline. It only announces:
+// stopping the server is up to the caller.
+func (s *Server) Drain(grace time.Duration) time.Time {
+	deadline := time.Now().Add(grace)
+	s.announce(&Announcement{Kind: AnnounceDraining, Deadline: deadline})
+	return deadline
+}
+
+// SubscribeAnnouncements subscribes the client to the server's announcements,
+// handing each one to handler. handler runs on the goroutine reading responses
+// and must not block.
+func (c *Client) SubscribeAnnouncements(handler func(a *Announcement)) error {
+	c.m.Lock()
+	c.announcements = handler
+	c.m.Unlock()
+
+	return c.Call(builtinService+".announcements", nil, nil)
+}
+
+// announcementOf returns the announcement carried by frame, if it is one.
+func announcementOf(fields map[string]json.RawMessage) (a *Announcement, ok bool) {
+	for _, kind := range []string{AnnounceServiceRemoved, AnnounceDraining} {
+		params, ok := builtinParams(fields, builtinService+"."+kind)
+		if !ok {
+			continue
+		}
+
+		a = &Announcement{Kind: kind}
+		if err := json.Unmarshal(params, a); err != nil {
+			return nil, false
+		}
+		return a, true
+	}
+
+	return nil, false
+}
+
+// deliverAnnouncement hands a to the client's handler, if any.
+func (c *Client) deliverAnnouncement(a *Announcement) {
+	c.m.Lock()
+	handler := c.announcements
+	c.m.Unlock()
+
+	if handler != nil {
+		handler(a)
+	}
+}
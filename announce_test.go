@@ -0,0 +1,48 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestAnnounceToStalledSubscriber(t *testing.T) {
+	s := NewServer("")
+	s.Protocol = ProtocolJSONRPC2
+	s.SlowWriterTimeout = 5 * time.Second
+
+	subscribe := `{"jsonrpc":"2.0","id":1,"method":"rpc.announcements"}`
+
+	// a subscriber that stops reading
+	var resp json.RawMessage
+	newRawConn(t, s).call(subscribe, &resp)
+
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		for i := 0; i < controlQueueSize+4; i++ {
+			s.Drain(time.Minute)
+		}
+	}()
+
+	select {
+	case <-drained:
+		t.Fatal("announcements to a stalled connection didn't wait for it")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// others still subscribe while announce waits for the stalled one
+	subscribed := make(chan struct{})
+	go func() {
+		defer close(subscribed)
+
+		var resp json.RawMessage
+		newRawConn(t, s).call(subscribe, &resp)
+	}()
+
+	select {
+	case <-subscribed:
+	case <-time.After(time.Second):
+		t.Fatal("subscribing waited for an announcement to a stalled connection")
+	}
+}
@@ -0,0 +1,84 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"net"
+)
+
+// EncodedResponse is a response encoded by the codec of a connection, about to
+// be written, see Server.AuditResponse.
+type EncodedResponse struct {
+	// Methods are the methods of the requests answered, one per response of
+	// a batch. A method is empty if its request couldn't be read, there is
+	// none for the error rejecting a whole batch.
+	Methods []string
+
+	// Data are the bytes written for the response. They must not be modified
+	// or retained once the hook returns.
+	Data []byte
+
+	// Peer describes the connection.
+	Peer *ConnInfo
+}
+
+// Size returns the number of bytes written for the response.
+func (r *EncodedResponse) Size() int {
+	return len(r.Data)
+}
+
+// responseFrame is a response queued for a server with AuditResponse, along
+// with the methods it answers.
+type responseFrame struct {
+	frame   interface{}
+	methods []string
+}
+
+// audited returns frame, the response to calls of methods, as queued for the
+// writer.
+func (conn *Connection) audited(frame interface{}, methods ...string) interface{} {
+	if conn.s.AuditResponse == nil || frame == nil {
+		return frame
+	}
+
+	return &responseFrame{frame: frame, methods: methods}
+}
+
+// auditConn holds the bytes written while a response is encoded, so that
+// AuditResponse sees them before they are sent.
+type auditConn struct {
+	net.Conn
+	capturing bool
+	buf       bytes.Buffer
+}
+
+func (c *auditConn) Write(p []byte) (int, error) {
+	if c.capturing {
+		return c.buf.Write(p)
+	}
+	return c.Conn.Write(p)
+}
+
+// writeAudited encodes the response rf, passes it to the server's
+// AuditResponse and writes it unless the hook refused it, closing the
+// connection then.
+func (conn *Connection) writeAudited(rf *responseFrame) error {
+	audit := conn.audit
+	defer audit.buf.Reset()
+
+	audit.capturing = true
+	err := conn.codec.Encode(rf.frame)
+	audit.capturing = false
+	if err != nil {
+		return err
+	}
+
+	resp := &EncodedResponse{Methods: rf.methods, Data: audit.buf.Bytes(), Peer: conn.info}
+	if err = conn.s.AuditResponse(resp); err != nil {
+		conn.s.logf("jsonrpc: closing connection to %s: response of %d bytes refused: %v", conn.info.RemoteAddr, resp.Size(), err)
+		_ = conn.c.Close()
+		return err
+	}
+
+	_, err = audit.Conn.Write(resp.Data)
+	return err
+}
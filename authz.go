@@ -0,0 +1,210 @@
+package jsonrpc
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAuthzTimeout   = time.Second
+	defaultAuthzCacheSize = 10000
+)
+
+// AuthzRequest describes a call for an Authorizer.
+type AuthzRequest struct {
+	Method     string
+	Meta       map[string]string
+	RemoteAddr net.Addr
+
+	// Peer is the verified identity of the client, for TLS connections whose
+	// client presented a certificate.
+	Peer *PeerIdentity
+}
+
+// Authorizer decides whether a call is allowed, typically by asking an external
+// policy service. An error means no decision could be made.
+type Authorizer interface {
+	Authorize(ctx context.Context, r *AuthzRequest) (allowed bool, err error)
+}
+
+// AuthorizerFunc adapts a function to the Authorizer interface.
+type AuthorizerFunc func(ctx context.Context, r *AuthzRequest) (bool, error)
+
+// Authorize implements Authorizer.
+func (f AuthorizerFunc) Authorize(ctx context.Context, r *AuthzRequest) (bool, error) {
+	return f(ctx, r)
+}
+
+// Authz asks an Authorizer about every call to a registered method before it
+// is handled, see Server.Authz. Denied calls fail with an error coded
+// CodePermissionDenied.
+type Authz struct {
+	Authorizer Authorizer
+
+	// Timeout bounds each decision, a second if zero.
+	Timeout time.Duration
+
+	// FailOpen allows the calls the Authorizer fails to decide on, which are
+	// denied otherwise.
+	FailOpen bool
+
+	// CacheTTL, if set, reuses decisions for that long, for up to CacheSize
+	// (10000 if zero) calls. Decisions are cached by CacheKey, by default the
+	// method, the client's address and identity and the request's meta apart
+	// from signatures.
+	CacheTTL  time.Duration
+	CacheSize int
+	CacheKey  func(r *AuthzRequest) string
+
+	m     sync.Mutex
+	cache map[string]authzDecision
+}
+
+type authzDecision struct {
+	allowed bool
+	expires time.Time
+}
+
+func (a *Authz) timeout() time.Duration {
+	if a.Timeout > 0 {
+		return a.Timeout
+	}
+	return defaultAuthzTimeout
+}
+
+func (a *Authz) cacheSize() int {
+	if a.CacheSize > 0 {
+		return a.CacheSize
+	}
+	return defaultAuthzCacheSize
+}
+
+// authorize returns the error denying req, nil if it is allowed. Calls the
+// Authorizer denies are protocol violations, not those it fails to decide on.
+func (s *Server) authorize(ctx context.Context, conn *Connection, req *Request) error {
+	a := s.Authz
+	if a == nil || a.Authorizer == nil {
+		return nil
+	}
+
+	r := &AuthzRequest{
+		Method:     req.Method,
+		Meta:       req.Meta,
+		RemoteAddr: conn.info.RemoteAddr,
+		Peer:       conn.info.Peer,
+	}
+
+	key := ""
+	cached := false
+	allowed := false
+	if a.CacheTTL > 0 {
+		key = a.cacheKey(r)
+		allowed, cached = a.cached(key)
+	}
+
+	if !cached {
+		ctx, cancel := context.WithTimeout(ctx, a.timeout())
+		defer cancel()
+
+		var err error
+		if allowed, err = a.Authorizer.Authorize(ctx, r); err != nil {
+			s.logf("jsonrpc: authorizing %s from %s: %v", req.Method, conn.info.RemoteAddr, err)
+			return denial(a.FailOpen)
+		}
+
+		if a.CacheTTL > 0 {
+			a.store(key, allowed)
+		}
+	}
+
+	err := denial(allowed)
+	if err != nil {
+		conn.violation(ViolationAuth, err)
+	}
+	return err
+}
+
+func denial(allowed bool) error {
+	if allowed {
+		return nil
+	}
+	return newError(CodePermissionDenied, "permission denied")
+}
+
+func (a *Authz) cacheKey(r *AuthzRequest) string {
+	if a.CacheKey != nil {
+		return a.CacheKey(r)
+	}
+
+	var b strings.Builder
+	b.WriteString(r.Method)
+	b.WriteByte(0)
+	b.WriteString(remoteIP(r.RemoteAddr))
+	b.WriteByte(0)
+	if r.Peer != nil {
+		b.WriteString(r.Peer.Subject)
+	}
+
+	keys := make([]string, 0, len(r.Meta))
+	for k := range r.Meta {
+		switch k {
+		case MetaSignature, MetaSignatureKey, MetaSignatureTime:
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		b.WriteByte(0)
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(r.Meta[k])
+	}
+
+	return b.String()
+}
+
+func (a *Authz) cached(key string) (allowed, ok bool) {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	d, ok := a.cache[key]
+	if !ok || time.Now().After(d.expires) {
+		return false, false
+	}
+
+	return d.allowed, true
+}
+
+func (a *Authz) store(key string, allowed bool) {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	if a.cache == nil {
+		a.cache = make(map[string]authzDecision)
+	}
+
+	now := time.Now()
+	if len(a.cache) >= a.cacheSize() {
+		for k, d := range a.cache {
+			if now.After(d.expires) {
+				delete(a.cache, k)
+			}
+		}
+	}
+
+	// still full: forget any decision
+	for k := range a.cache {
+		if len(a.cache) < a.cacheSize() {
+			break
+		}
+		delete(a.cache, k)
+	}
+
+	a.cache[key] = authzDecision{allowed: allowed, expires: now.Add(a.CacheTTL)}
+}
@@ -0,0 +1,150 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingAuthorizer allows the calls whose tenant is "acme", recording the
+// requests it is asked about.
+type recordingAuthorizer struct {
+	m        sync.Mutex
+	requests []*AuthzRequest
+	err      error
+	delay    time.Duration
+}
+
+func (a *recordingAuthorizer) Authorize(ctx context.Context, r *AuthzRequest) (bool, error) {
+	a.m.Lock()
+	a.requests = append(a.requests, r)
+	err, delay := a.err, a.delay
+	a.m.Unlock()
+
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+	return r.Meta["tenant"] == "acme", err
+}
+
+func (a *recordingAuthorizer) asked() int {
+	a.m.Lock()
+	defer a.m.Unlock()
+	return len(a.requests)
+}
+
+func newAuthzPair(t *testing.T, authz *Authz) *Client {
+	s := NewServer("")
+	s.Authz = authz
+	err := s.RegisterFunc("Echo.Int", func(ctx context.Context, in int) (int, error) { return in, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, c := NewLocalPair(s)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func callAs(c *Client, tenant string) error {
+	var out int
+	return c.Method("Echo.Int").Meta("tenant", tenant).Do(context.Background(), 1, &out)
+}
+
+func TestAuthz(t *testing.T) {
+	authorizer := &recordingAuthorizer{}
+	c := newAuthzPair(t, &Authz{Authorizer: authorizer})
+
+	if err := callAs(c, "acme"); err != nil {
+		t.Errorf("allowed call: %v", err)
+	}
+	if err := callAs(c, "globex"); err == nil || err.Error() != "permission denied" {
+		t.Errorf("denied call: %v", err)
+	}
+
+	// builtins aren't authorized
+	if err := c.Call("rpc.ping", nil, nil); err != nil {
+		t.Errorf("rpc.ping: %v", err)
+	}
+
+	if n := authorizer.asked(); n != 2 {
+		t.Fatalf("authorizer asked %d times", n)
+	}
+	r := authorizer.requests[0]
+	if r.Method != "Echo.Int" || r.Meta["tenant"] != "acme" || r.RemoteAddr == nil || r.Peer != nil {
+		t.Errorf("authorizer asked about %+v", r)
+	}
+}
+
+func TestAuthzUndecided(t *testing.T) {
+	for _, failOpen := range []bool{false, true} {
+		authorizer := &recordingAuthorizer{err: errors.New("policy service down")}
+		c := newAuthzPair(t, &Authz{Authorizer: authorizer, FailOpen: failOpen})
+
+		if err := callAs(c, "acme"); (err == nil) != failOpen {
+			t.Errorf("FailOpen %v: call failing to be decided returned %v", failOpen, err)
+		}
+	}
+
+	// decisions taking longer than the timeout aren't waited for
+	authorizer := &recordingAuthorizer{delay: time.Minute}
+	c := newAuthzPair(t, &Authz{Authorizer: authorizer, Timeout: 50 * time.Millisecond})
+
+	start := time.Now()
+	if err := callAs(c, "acme"); err == nil {
+		t.Error("call allowed without a decision")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("decision waited for %v", elapsed)
+	}
+}
+
+func TestAuthzCache(t *testing.T) {
+	authorizer := &recordingAuthorizer{}
+	authz := &Authz{Authorizer: authorizer, CacheTTL: time.Hour, CacheSize: 2}
+	c := newAuthzPair(t, authz)
+
+	for i := 0; i < 3; i++ {
+		callAs(c, "acme")
+		callAs(c, "globex")
+	}
+	if n := authorizer.asked(); n != 2 {
+		t.Errorf("authorizer asked %d times for 2 distinct calls", n)
+	}
+
+	// signatures aren't part of the default key
+	key := (&Authz{}).cacheKey
+	signed := &AuthzRequest{Method: "Echo.Int", Meta: map[string]string{"tenant": "acme", MetaSignature: "abc", MetaSignatureTime: "1"}}
+	plain := &AuthzRequest{Method: "Echo.Int", Meta: map[string]string{"tenant": "acme"}}
+	if key(signed) != key(plain) {
+		t.Error("signature meta in the cache key")
+	}
+
+	// the cache holds at most CacheSize decisions
+	callAs(c, "initech")
+	authz.m.Lock()
+	defer authz.m.Unlock()
+	if n := len(authz.cache); n != 2 {
+		t.Errorf("%d decisions cached", n)
+	}
+}
+
+func TestAuthzCacheExpiry(t *testing.T) {
+	authorizer := &recordingAuthorizer{}
+	c := newAuthzPair(t, &Authz{Authorizer: authorizer, CacheTTL: 20 * time.Millisecond})
+
+	callAs(c, "acme")
+	callAs(c, "acme")
+	time.Sleep(50 * time.Millisecond)
+	callAs(c, "acme")
+
+	if n := authorizer.asked(); n != 2 {
+		t.Errorf("authorizer asked %d times", n)
+	}
+}
@@ -0,0 +1,270 @@
+package jsonrpc
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Kinds of protocol violations counted by a BanPolicy.
+const (
+	// ViolationBadFrame is a frame that isn't valid JSON or fails its checksum.
+	ViolationBadFrame = "bad-frame"
+
+	// ViolationInvalidRequest is a malformed request envelope, id or method.
+	ViolationInvalidRequest = "invalid-request"
+
+	// ViolationOversized is a batch over the server's limits or an HTTP body
+	// too large to be read.
+	ViolationOversized = "oversized"
+
+	// ViolationAuth is a failed TLS handshake, an invalid request signature or
+	// a call denied by Server.Authz or WithAuthorizer.
+	ViolationAuth = "auth"
+)
+
+const (
+	defaultBanWindow   = time.Minute
+	defaultBanDuration = 10 * time.Minute
+
+	// maxTrackedIPs bounds the addresses whose violations are tracked.
+	maxTrackedIPs = 10000
+)
+
+// Violation is a protocol violation committed by a client.
+type Violation struct {
+	Kind       string
+	RemoteAddr net.Addr
+	Err        error
+}
+
+// BanPolicy disconnects clients that keep violating the protocol and bans
+// their address for a while. Violations are only counted per address for TCP
+// connections and HTTP requests.
+type BanPolicy struct {
+	// MaxConnViolations closes a connection once it has committed that many
+	// violations, if set.
+	MaxConnViolations int
+
+	// MaxIPViolations bans an address for BanDuration (10 minutes if zero) once
+	// its connections have committed that many violations within Window (a
+	// minute if zero), if set. The connections of a banned address are closed
+	// and new ones are refused.
+	MaxIPViolations int
+	Window          time.Duration
+	BanDuration     time.Duration
+
+	// OnViolation, if set, is called for every violation, and OnBan whenever
+	// an address is banned.
+	OnViolation func(v Violation)
+	OnBan       func(ip string, until time.Time)
+
+	m      sync.Mutex
+	ips    map[string]*ipRecord
+	swept  time.Time
+	counts map[string]uint64
+}
+
+// ipRecord holds the violations of an address in the current window.
+type ipRecord struct {
+	windowStart time.Time
+	violations  int
+	bannedUntil time.Time
+}
+
+func (p *BanPolicy) window() time.Duration {
+	if p.Window > 0 {
+		return p.Window
+	}
+	return defaultBanWindow
+}
+
+func (p *BanPolicy) banDuration() time.Duration {
+	if p.BanDuration > 0 {
+		return p.BanDuration
+	}
+	return defaultBanDuration
+}
+
+// Banned reports whether ip is banned.
+func (p *BanPolicy) Banned(ip string) bool {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	rec, ok := p.ips[ip]
+	return ok && time.Now().Before(rec.bannedUntil)
+}
+
+// Unban lifts the ban of ip and forgets its violations.
+func (p *BanPolicy) Unban(ip string) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	delete(p.ips, ip)
+}
+
+// Violations returns the number of violations counted by kind.
+func (p *BanPolicy) Violations() map[string]uint64 {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	counts := make(map[string]uint64, len(p.counts))
+	for kind, n := range p.counts {
+		counts[kind] = n
+	}
+
+	return counts
+}
+
+// record counts v, committed from ip if not empty, and returns until when ip
+// is banned if it is, and whether v got it banned.
+func (p *BanPolicy) record(v Violation, ip string) (until time.Time, banned bool) {
+	p.m.Lock()
+
+	if p.counts == nil {
+		p.counts = make(map[string]uint64)
+	}
+	p.counts[v.Kind]++
+
+	if ip != "" && p.MaxIPViolations > 0 {
+		until, banned = p.recordIP(ip, time.Now())
+	}
+
+	p.m.Unlock()
+
+	if p.OnViolation != nil {
+		p.OnViolation(v)
+	}
+
+	if banned && p.OnBan != nil {
+		p.OnBan(ip, until)
+	}
+
+	return
+}
+
+func (p *BanPolicy) recordIP(ip string, now time.Time) (until time.Time, banned bool) {
+	if p.ips == nil {
+		p.ips = make(map[string]*ipRecord)
+	}
+
+	rec, ok := p.ips[ip]
+	if !ok {
+		if now.Sub(p.swept) > p.window() {
+			p.sweep(now)
+		}
+		if len(p.ips) >= maxTrackedIPs {
+			p.evict(now)
+		}
+
+		rec = &ipRecord{}
+		p.ips[ip] = rec
+	}
+
+	if now.Before(rec.bannedUntil) {
+		return rec.bannedUntil, false
+	}
+
+	if now.Sub(rec.windowStart) > p.window() {
+		rec.windowStart, rec.violations = now, 0
+	}
+
+	if rec.violations++; rec.violations < p.MaxIPViolations {
+		return
+	}
+
+	rec.bannedUntil = now.Add(p.banDuration())
+	rec.violations = 0
+	return rec.bannedUntil, true
+}
+
+// sweep forgets the addresses that aren't banned and whose window is over.
+func (p *BanPolicy) sweep(now time.Time) {
+	for ip, rec := range p.ips {
+		if now.After(rec.bannedUntil) && now.Sub(rec.windowStart) > p.window() {
+			delete(p.ips, ip)
+		}
+	}
+	p.swept = now
+}
+
+// evict makes room for an address in a full table, forgetting an address that
+// isn't banned, or the ban ending first if all are.
+func (p *BanPolicy) evict(now time.Time) {
+	var first string
+	for ip, rec := range p.ips {
+		if !now.Before(rec.bannedUntil) {
+			delete(p.ips, ip)
+			return
+		}
+		if first == "" || rec.bannedUntil.Before(p.ips[first].bannedUntil) {
+			first = ip
+		}
+	}
+	delete(p.ips, first)
+}
+
+// remoteIP returns the IP address of addr, or "" if it has none.
+func remoteIP(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return ""
+	}
+
+	return host
+}
+
+// banned reports whether the client of conn is banned.
+func (conn *Connection) banned() bool {
+	p := conn.s.Bans
+	if p == nil {
+		return false
+	}
+
+	ip := remoteIP(conn.info.RemoteAddr)
+	return ip != "" && p.Banned(ip)
+}
+
+// violation records a protocol violation committed on conn, closing the
+// connection if the server's BanPolicy says so, and all the connections of its
+// address once that is banned.
+func (conn *Connection) violation(kind string, err error) {
+	p := conn.s.Bans
+	if p == nil {
+		return
+	}
+
+	ip := remoteIP(conn.info.RemoteAddr)
+	until, banned := p.record(Violation{Kind: kind, RemoteAddr: conn.info.RemoteAddr, Err: err}, ip)
+
+	if !until.IsZero() {
+		if banned {
+			conn.s.logf("jsonrpc: banning %s until %s: too many protocol violations", ip, until.Format(time.RFC3339))
+		}
+		conn.s.closeConnsFrom(ip)
+		return
+	}
+
+	n := atomic.AddInt32(&conn.violations, 1)
+	if p.MaxConnViolations > 0 && int(n) >= p.MaxConnViolations && conn.c != nil {
+		conn.s.logf("jsonrpc: closing connection to %s: too many protocol violations", conn.info.RemoteAddr)
+		_ = conn.c.Close()
+	}
+}
+
+// closeConnsFrom closes the connections of the client at ip.
+func (s *Server) closeConnsFrom(ip string) {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+
+	for conn := range s.conns {
+		if remoteIP(conn.info.RemoteAddr) == ip {
+			_ = conn.c.Close()
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// serveTCP serves s on a loopback address, which violations are counted for.
+func serveTCP(t *testing.T, s *Server) (addr string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Listener = l
+	go s.Serve()
+	t.Cleanup(func() { l.Close() })
+
+	return l.Addr().String()
+}
+
+func dialRaw(t *testing.T, addr string) *rawConn {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return &rawConn{t: t, conn: conn, dec: json.NewDecoder(conn)}
+}
+
+// closed reports whether the server closed rc without sending anything more.
+func (rc *rawConn) closed() bool {
+	rc.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var frame json.RawMessage
+	return rc.dec.Decode(&frame) == io.EOF
+}
+
+func TestBanClosesConnections(t *testing.T) {
+	bans := make(chan string, 10)
+	s := NewServer("")
+	s.Protocol = ProtocolJSONRPC2
+	s.Bans = &BanPolicy{
+		MaxIPViolations: 2,
+		OnBan:           func(ip string, until time.Time) { bans <- ip },
+	}
+	addr := serveTCP(t, s)
+
+	offender, bystander := dialRaw(t, addr), dialRaw(t, addr)
+
+	var resp json.RawMessage
+	offender.call(`{"jsonrpc":"2.0","id":1}`, &resp)
+	io.WriteString(offender.conn, `{"jsonrpc":"2.0","id":2}`+"\n")
+
+	if !bystander.closed() {
+		t.Error("live connection of a banned address kept open")
+	}
+	if !dialRaw(t, addr).closed() {
+		t.Error("new connection of a banned address served")
+	}
+	if !s.Bans.Banned("127.0.0.1") || len(bans) != 1 {
+		t.Errorf("%d bans", len(bans))
+	}
+	if n := s.Bans.Violations()[ViolationInvalidRequest]; n != 2 {
+		t.Errorf("%d invalid requests counted", n)
+	}
+}
+
+func TestBanAuthorizationDenials(t *testing.T) {
+	deny := errors.New("not allowed")
+	broken := errors.New("policy service down")
+
+	s := NewServer("")
+	s.Protocol = ProtocolJSONRPC2
+	s.Bans = &BanPolicy{MaxIPViolations: 3}
+	s.Authz = &Authz{Authorizer: AuthorizerFunc(func(ctx context.Context, r *AuthzRequest) (bool, error) {
+		switch r.Method {
+		case "Echo.Broken":
+			return false, broken
+		case "Echo.Denied":
+			return false, nil
+		}
+		return true, nil
+	})}
+
+	echo := func(ctx context.Context, in int) (int, error) { return in, nil }
+	for _, name := range []string{"Echo.Int", "Echo.Denied", "Echo.Broken"} {
+		if err := s.RegisterFunc(name, echo); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := s.RegisterFunc("Guarded.Echo", echo, WithAuthorizer(func(ctx context.Context, req *Request) error { return deny }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := serveTCP(t, s)
+
+	rc := dialRaw(t, addr)
+	call := func(method string) (code int) {
+		var resp struct {
+			Error *Error `json:"error"`
+		}
+		rc.call(fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":%q,"params":[1]}`, method), &resp)
+		if resp.Error != nil {
+			code = resp.Error.Code
+		}
+		return
+	}
+
+	// undecided calls aren't held against the client
+	for i := 0; i < 5; i++ {
+		if code := call("Echo.Broken"); code != CodePermissionDenied {
+			t.Fatalf("undecided call: code %d", code)
+		}
+	}
+
+	call("Echo.Denied")
+	call("Echo.Denied")
+	if n := s.Bans.Violations()[ViolationAuth]; n != 2 {
+		t.Fatalf("%d Authz denials counted", n)
+	}
+
+	// the third denial bans the address, closing the connection before the
+	// call is answered
+	io.WriteString(rc.conn, `{"jsonrpc":"2.0","id":2,"method":"Guarded.Echo","params":[1]}`+"\n")
+	if !rc.closed() {
+		t.Error("connection kept after its address got banned")
+	}
+	if n := s.Bans.Violations()[ViolationAuth]; n != 3 {
+		t.Errorf("%d denials counted", n)
+	}
+}
+
+func TestBanTableBounded(t *testing.T) {
+	p := &BanPolicy{MaxIPViolations: 2}
+	now := time.Now()
+
+	p.recordIP("10.0.0.1", now)
+	if _, banned := p.recordIP("10.0.0.1", now); !banned {
+		t.Fatal("address not banned")
+	}
+
+	for i := 0; i < 2*maxTrackedIPs; i++ {
+		p.recordIP(fmt.Sprintf("10.1.%d.%d", i/256, i%256), now)
+		if len(p.ips) > maxTrackedIPs {
+			t.Fatalf("%d addresses tracked", len(p.ips))
+		}
+	}
+
+	if !p.Banned("10.0.0.1") {
+		t.Error("ban forgotten for addresses that merely committed a violation")
+	}
+}
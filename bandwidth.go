@@ -0,0 +1,120 @@
+package jsonrpc
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// Bandwidth limits the bytes read and written per second, zero meaning no
+// limit, with bursts of up to Burst bytes, a second's worth if zero.
+type Bandwidth struct {
+	Read  float64
+	Write float64
+	Burst int
+}
+
+// buckets returns the buckets limiting reads and writes to b, nil for those
+// without a limit.
+func (b Bandwidth) buckets() (read, write *tokenBucket) {
+	if b.Read > 0 {
+		read = newTokenBucket(b.Read, b.burst(b.Read))
+	}
+	if b.Write > 0 {
+		write = newTokenBucket(b.Write, b.burst(b.Write))
+	}
+	return
+}
+
+func (b Bandwidth) burst(rate float64) int {
+	if b.Burst > 0 {
+		return b.Burst
+	}
+	return int(rate)
+}
+
+// throttledConn is a connection whose reads and writes are limited by token
+// buckets, one token per byte. Writes wait for all their tokens, past the
+// burst if need be, and are then written whole: a frame is never split, which
+// would turn it into several messages on a WebSocket.
+type throttledConn struct {
+	net.Conn
+	read, write *tokenBucket
+}
+
+// throttle returns rw limited to the server's Bandwidth.
+func (s *Server) throttle(rw net.Conn) net.Conn {
+	read, write := s.Bandwidth.buckets()
+	if read == nil && write == nil {
+		return rw
+	}
+
+	return &throttledConn{Conn: rw, read: read, write: write}
+}
+
+func (c *throttledConn) Read(p []byte) (n int, err error) {
+	if c.read == nil {
+		return c.Conn.Read(p)
+	}
+
+	if max := int(c.read.burst); len(p) > max {
+		p = p[:max]
+	}
+
+	n, err = c.Conn.Read(p)
+	time.Sleep(c.read.reserve(n))
+	return
+}
+
+func (c *throttledConn) Write(p []byte) (n int, err error) {
+	if c.write != nil {
+		time.Sleep(c.write.reserve(len(p)))
+	}
+	return c.Conn.Write(p)
+}
+
+// WithBandwidth limits the params read and the results written by method of
+// the service, across all connections. Calls over the limit are held back,
+// not failed: their params aren't handled, and their results not sent, until
+// the bandwidth allows.
+func WithBandwidth(method string, limit Bandwidth) ServiceOption {
+	return func(opts *serviceOptions) {
+		if opts.bandwidth == nil {
+			opts.bandwidth = make(map[string]*methodBandwidth)
+		}
+
+		read, write := limit.buckets()
+		opts.bandwidth[method] = &methodBandwidth{read: read, write: write}
+	}
+}
+
+type methodBandwidth struct {
+	read, write *tokenBucket
+}
+
+// bandwidthInterceptor holds calls back to the bandwidth of their method.
+func bandwidthInterceptor(limits map[string]*methodBandwidth) Interceptor {
+	return func(ctx context.Context, req *Request, next Handler) (*Response, error) {
+		_, methodName, _ := splitMethod(req.Method)
+
+		limit, ok := limits[methodName]
+		if !ok {
+			return next(ctx, req)
+		}
+
+		if err := limit.read.wait(ctx, len(req.Param)); err != nil {
+			return nil, err
+		}
+
+		resp, err := next(ctx, req)
+		if err != nil || resp == nil {
+			return resp, err
+		}
+
+		if err := limit.write.wait(ctx, len(resp.Result)); err != nil {
+			return nil, err
+		}
+
+		return resp, nil
+	}
+}
@@ -0,0 +1,73 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeCounter counts the writes made to a connection.
+type writeCounter struct {
+	net.Conn
+	writes int
+}
+
+func (c *writeCounter) Write(p []byte) (int, error) {
+	c.writes++
+	return len(p), nil
+}
+
+func TestThrottledWrite(t *testing.T) {
+	counter := &writeCounter{}
+	s := &Server{Bandwidth: Bandwidth{Write: 1000, Burst: 100}}
+	conn := s.throttle(counter)
+
+	start := time.Now()
+	if n, err := conn.Write(make([]byte, 300)); n != 300 || err != nil {
+		t.Fatalf("Write = %d, %v", n, err)
+	}
+
+	// the burst is spent at once, the 200 bytes past it take 200ms
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("300 bytes written in %v at 1000 bytes/s with a burst of 100", elapsed)
+	}
+	if counter.writes != 1 {
+		t.Errorf("frame written in %d writes", counter.writes)
+	}
+}
+
+func TestThrottledWSMessages(t *testing.T) {
+	s := NewServer("")
+	s.Protocol = ProtocolJSONRPC2
+	s.Bandwidth = Bandwidth{Write: 1 << 20, Burst: 64}
+	err := s.RegisterFunc("Echo.String", func(ctx context.Context, in string) (string, error) { return in, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := newWSServer(t, s)
+
+	ws, status := wsUpgrade(t, addr, "")
+	if ws == nil {
+		t.Fatalf("upgrade: status %d", status)
+	}
+
+	long := strings.Repeat("x", 1000)
+	if _, err = ws.Write([]byte(`{"jsonrpc":"2.0","id":1,"method":"Echo.String","params":["` + long + `"]}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the response comes whole in a single message
+	fin, opcode, payload, err := ws.readFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp struct {
+		Result string `json:"result"`
+	}
+	if !fin || opcode != wsText || json.Unmarshal(payload, &resp) != nil || resp.Result != long {
+		t.Fatalf("response frame fin=%v opcode=%d: %.80s", fin, opcode, payload)
+	}
+}
@@ -0,0 +1,120 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+)
+
+// serveBatch handles a JSON array of requests and returns a single array of
+// responses, in the order of the requests, or nil if there is none.
+func (conn *Connection) serveBatch(raw json.RawMessage, scalars *Scalars) interface{} {
+	var frames []json.RawMessage
+	if err := json.Unmarshal(raw, &frames); err != nil || len(frames) == 0 {
+		err := newError(CodeInvalidRequest, "invalid batch: expected a non-empty array of requests")
+		conn.violation(ViolationInvalidRequest, err)
+		return conn.rejectBatch(err)
+	}
+
+	if max := conn.s.MaxBatchSize; max > 0 && len(frames) > max {
+		err := newError(CodeInvalidRequest, "invalid batch: %d requests, at most %d allowed", len(frames), max)
+		conn.violation(ViolationOversized, err)
+		return conn.rejectBatch(err)
+	}
+
+	if max := conn.s.MaxBatchBytes; max > 0 && len(raw) > max {
+		err := newError(CodeInvalidRequest, "invalid batch: %d bytes, at most %d allowed", len(raw), max)
+		conn.violation(ViolationOversized, err)
+		return conn.rejectBatch(err)
+	}
+
+	reqs := make([]*Request, len(frames))
+	resps := make([]*Response, len(frames))
+	rejected := make([]bool, len(frames))
+
+	// failed is set once a request fails when BatchFailFast is on
+	var failed int32
+	run := func(i int) {
+		if atomic.LoadInt32(&failed) != 0 {
+			resps[i] = newErrorResponse(reqs[i], newError(CodeBatchAborted, "request not run: an earlier request of the batch failed"))
+			return
+		}
+
+		resps[i] = conn.handle(reqs[i])
+		if conn.s.BatchFailFast && resps[i].Error != "" {
+			atomic.StoreInt32(&failed, 1)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i, frame := range frames {
+		req, err := conn.parseRequest(frame)
+		req.scalars = scalars
+		if err == nil && req.Method == scalarsMethod {
+			// the items of a batch are read together, there is no frame
+			// after rpc.scalars for it to apply to
+			err = newError(CodeInvalidRequest, "invalid request: %s can't be batched", scalarsMethod)
+		}
+		reqs[i] = req
+		if err != nil {
+			conn.violation(ViolationInvalidRequest, err)
+			resps[i] = newErrorResponse(req, err)
+			rejected[i] = true
+			if conn.s.BatchFailFast {
+				atomic.StoreInt32(&failed, 1)
+			}
+			continue
+		}
+
+		if !conn.s.ConcurrentBatch || !conn.tryHandler() {
+			run(i)
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-conn.handlers }()
+			run(i)
+		}(i)
+	}
+	wg.Wait()
+
+	out := make([]interface{}, 0, len(resps))
+	methods := make([]string, 0, len(resps))
+	for i, resp := range resps {
+		// notifications get no response unless they were invalid
+		if reqs[i].notification && !rejected[i] {
+			continue
+		}
+
+		out = append(out, conn.response(reqs[i], resp))
+		methods = append(methods, reqs[i].Method)
+	}
+
+	// a batch made only of notifications gets no response at all
+	if len(out) == 0 {
+		return nil
+	}
+
+	return conn.audited(out, methods...)
+}
+
+// tryHandler takes a free request slot of the connection if there is one. The
+// items of concurrent batches run on the slots free when they are read, the
+// others on the batch's own, so that a batch doesn't start more goroutines
+// than a connection may run requests.
+func (conn *Connection) tryHandler() bool {
+	select {
+	case conn.handlers <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// rejectBatch returns the single error response to a batch that isn't run.
+func (conn *Connection) rejectBatch(err *Error) interface{} {
+	req := &Request{}
+	return conn.audited(conn.response(req, newErrorResponse(req, err)))
+}
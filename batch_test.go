@@ -0,0 +1,117 @@
+package jsonrpc
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func batchOf(n int, method string) string {
+	items := make([]string, n)
+	for i := range items {
+		items[i] = fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":%q,"params":[%d]}`, i, method, i)
+	}
+	return "[" + strings.Join(items, ",") + "]"
+}
+
+func TestConcurrentBatchBounded(t *testing.T) {
+	var running, peak int32
+
+	s := NewServer("")
+	s.Protocol = ProtocolJSONRPC2
+	s.ConcurrentBatch = true
+	err := s.RegisterFunc("Slow.Echo", func(in int) (int, error) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return in, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rc := newRawConn(t, s)
+
+	const items = 500
+
+	var resps []response2
+	rc.call(batchOf(items, "Slow.Echo"), &resps)
+
+	if len(resps) != items {
+		t.Fatalf("%d responses, want %d", len(resps), items)
+	}
+	for i, resp := range resps {
+		if string(resp.Id) != fmt.Sprint(i) || fmt.Sprint(resp.Result) != fmt.Sprint(i) {
+			t.Errorf("response %d: id %s, result %v", i, resp.Id, resp.Result)
+		}
+	}
+
+	if p := atomic.LoadInt32(&peak); p > maxConcurrentRequests || p < 2 {
+		t.Errorf("%d requests of the batch ran at once, want 2 to %d", p, maxConcurrentRequests)
+	}
+}
+
+func TestBatchLimits(t *testing.T) {
+	s := NewServer("")
+	s.Protocol = ProtocolJSONRPC2
+	s.MaxBatchSize = 3
+	s.MaxBatchBytes = 400
+	if err := s.RegisterFunc("Echo.Int", func(in int) (int, error) { return in, nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	rc := newRawConn(t, s)
+
+	var resp response2
+	rc.call(batchOf(4, "Echo.Int"), &resp)
+	if resp.Error == nil || resp.Error.Code != CodeInvalidRequest {
+		t.Errorf("batch over MaxBatchSize: %+v", resp)
+	}
+
+	padded := `[{"jsonrpc":"2.0","id":1,"method":"Echo.Int","params":[1]` + strings.Repeat(" ", 400) + `}]`
+	resp = response2{}
+	rc.call(padded, &resp)
+	if resp.Error == nil || resp.Error.Code != CodeInvalidRequest {
+		t.Errorf("batch over MaxBatchBytes: %+v", resp)
+	}
+
+	var resps []response2
+	rc.call(batchOf(3, "Echo.Int"), &resps)
+	if len(resps) != 3 {
+		t.Errorf("batch within the limits: %d responses", len(resps))
+	}
+}
+
+func TestBatchFailFast(t *testing.T) {
+	s := NewServer("")
+	s.Protocol = ProtocolJSONRPC2
+	s.BatchFailFast = true
+	if err := s.RegisterFunc("Echo.Int", func(in int) (int, error) { return in, nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	rc := newRawConn(t, s)
+
+	var resps []response2
+	rc.call(`[{"jsonrpc":"2.0","id":1,"method":"Echo.Int","params":[1]},`+
+		`{"jsonrpc":"2.0","id":2,"method":"Echo.Missing","params":[2]},`+
+		`{"jsonrpc":"2.0","id":3,"method":"Echo.Int","params":[3]}]`, &resps)
+
+	if len(resps) != 3 {
+		t.Fatalf("%d responses, want 3", len(resps))
+	}
+	if resps[0].Error != nil || resps[1].Error == nil {
+		t.Errorf("first responses: %+v, %+v", resps[0], resps[1])
+	}
+	if resps[2].Error == nil || resps[2].Error.Code != CodeBatchAborted {
+		t.Errorf("request after the failure: %+v", resps[2])
+	}
+}
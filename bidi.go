@@ -0,0 +1,222 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+// ErrConnectionClosed is returned by Connection.Call when the connection ends
+// before the peer answered.
+var ErrConnectionClosed = errors.New("connection has closed")
+
+type connKey struct{}
+
+// ConnectionFromContext returns the connection a context-aware handler is
+// serving, so it can call back into the client with Connection.Call.
+func ConnectionFromContext(ctx context.Context) (*Connection, bool) {
+	conn, ok := ctx.Value(connKey{}).(*Connection)
+	return conn, ok
+}
+
+// frameFields returns the top-level members of raw, or nil if it isn't an object.
+func frameFields(raw json.RawMessage) map[string]json.RawMessage {
+	if firstByte(raw) != '{' {
+		return nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil
+	}
+
+	return fields
+}
+
+// isResponse reports whether the members of a frame are those of a response: it
+// has a result or an error member but no method.
+func isResponse(fields map[string]json.RawMessage) bool {
+	if fields == nil {
+		return false
+	}
+
+	_, hasMethod := fields["method"]
+	_, hasResult := fields["result"]
+	_, hasError := fields["error"]
+	return !hasMethod && (hasResult || hasError)
+}
+
+// Call calls method on the client at the other end of the connection, which
+// must have registered a callback service for it with Client.Register.
+func (conn *Connection) Call(ctx context.Context, method string, in, out interface{}) (err error) {
+	if err = checkMethod(method); err != nil {
+		return
+	}
+
+	done := make(chan *Response, 1)
+
+	// ids wrap around, skipping those of the calls still pending
+	conn.cm.Lock()
+	if conn.calls == nil {
+		conn.calls = make(map[uint32]chan *Response)
+	}
+	for {
+		conn.callSeq++
+		if _, pending := conn.calls[conn.callSeq]; !pending {
+			break
+		}
+	}
+	id := conn.callSeq
+	conn.calls[id] = done
+	conn.cm.Unlock()
+
+	defer func() {
+		conn.cm.Lock()
+		delete(conn.calls, id)
+		conn.cm.Unlock()
+	}()
+
+	req := &Request{
+		Id:     json.RawMessage(uintToString(id)),
+		Method: method,
+	}
+
+	if in, err = conn.scalars().encode(in); err != nil {
+		return
+	}
+
+	if err = conn.protocol.setParams(req, conn.codec, in); err != nil {
+		return
+	}
+
+	if err = conn.send(conn.protocol.wireRequest(req)); err != nil {
+		return
+	}
+
+	select {
+	case resp := <-done:
+		if err = resp.error(); err != nil {
+			return
+		}
+
+		if out == nil {
+			return
+		}
+
+		err = conn.scalars().unmarshal(resp.Result, out)
+		return
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-conn.ctx.Done():
+		return ErrConnectionClosed
+	}
+}
+
+// send writes frame to the peer.
+func (conn *Connection) send(frame interface{}) error {
+	return conn.sendOn(conn.out, frame)
+}
+
+// sendOn writes frame to the peer through queue, the connection's data or
+// control queue.
+func (conn *Connection) sendOn(queue chan interface{}, frame interface{}) error {
+	if conn.client != nil {
+		return conn.client.writeFrame(frame)
+	}
+
+	if conn.c == nil {
+		return ErrNoPeerChannel
+	}
+
+	conn.outMu.RLock()
+	defer conn.outMu.RUnlock()
+
+	if conn.closed {
+		return ErrConnectionClosed
+	}
+
+	conn.enqueueOn(queue, frame)
+	return nil
+}
+
+// notify sends a notification of method with params to the peer.
+func (conn *Connection) notify(method string, params interface{}) (err error) {
+	req := &Request{
+		Method:       method,
+		notification: true,
+	}
+
+	if err = conn.protocol.setParams(req, conn.codec, params); err != nil {
+		return
+	}
+
+	queue := conn.out
+	if controlNotifications[method] {
+		queue = conn.control
+	}
+
+	err = conn.sendOn(queue, conn.protocol.wireRequest(req))
+	return
+}
+
+// deliver hands a response frame received from the client to the pending Call.
+// Duplicate responses are dropped rather than blocking the reader.
+func (conn *Connection) deliver(raw json.RawMessage) {
+	var cr clientResponse
+	if err := json.Unmarshal(raw, &cr); err != nil {
+		return
+	}
+
+	id, err := strconv.ParseUint(string(cr.Id), 10, 32)
+	if err != nil {
+		return
+	}
+
+	conn.cm.Lock()
+	done, ok := conn.calls[uint32(id)]
+	conn.cm.Unlock()
+
+	if !ok {
+		return
+	}
+
+	select {
+	case done <- cr.response():
+	default:
+	}
+}
+
+// Register publishes the methods of receiver as a callback service the server
+// can call over this client's connection. Callback services must be registered
+// before the server calls them.
+func (c *Client) Register(receiver interface{}, opts ...ServiceOption) error {
+	return c.callbacks.s.Register(receiver, opts...)
+}
+
+// serveCallback handles a request sent by the server to callbacks.
+func (c *Client) serveCallback(callbacks *Connection, raw json.RawMessage) {
+	protocol := detectProtocol(raw)
+
+	req, err := parseRequestAs(raw, protocol, false)
+
+	var resp *Response
+	if err != nil {
+		resp = newErrorResponse(req, err)
+	} else {
+		resp = callbacks.handle(req)
+		if req.notification {
+			return
+		}
+	}
+
+	_ = c.writeFrame(protocol.wireResponse(resp))
+}
+
+// writeFrame encodes frame on the connection.
+func (c *Client) writeFrame(frame interface{}) error {
+	c.reqMutex.Lock()
+	defer c.reqMutex.Unlock()
+
+	return c.codec.Encode(frame)
+}
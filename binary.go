@@ -0,0 +1,584 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"unicode/utf8"
+)
+
+// binaryFormat writes the items of a binary form of JSON, such as MessagePack
+// or CBOR.
+type binaryFormat interface {
+	writeNull(buf *bytes.Buffer)
+	writeBool(buf *bytes.Buffer, b bool)
+	writeInt(buf *bytes.Buffer, i int64)
+	writeUint(buf *bytes.Buffer, u uint64)
+	writeFloat(buf *bytes.Buffer, f float64, bits int)
+	writeNumber(buf *bytes.Buffer, n json.Number) error
+	writeString(buf *bytes.Buffer, s string)
+	writeText(buf *bytes.Buffer, text []byte)
+	writeBytes(buf *bytes.Buffer, b []byte)
+	writeArray(buf *bytes.Buffer, n int)
+	writeMap(buf *bytes.Buffer, n int)
+}
+
+// binaryEncoder is implemented by codecs encoding values in a binary format
+// of their own, such as the results of handlers, see Connection.resultEncoder,
+// and the params of calls, see Client.write.
+type binaryEncoder interface {
+	encodeBinary(v interface{}) (encodedValue, error)
+}
+
+// encodedValue is a value in the format of the connection's codec, which
+// writes it as it is.
+type encodedValue []byte
+
+var (
+	typeOfNumber       = reflect.TypeOf(json.Number(""))
+	typeOfEncodedValue = reflect.TypeOf(encodedValue(nil))
+)
+
+// writeBinary writes v to buf in format f as encoding/json would encode it,
+// straight from the Go value: struct fields are named and omitted as their
+// json tags say, and types implementing json.Marshaler or
+// encoding.TextMarshaler are encoded as such. Byte slices are written as
+// binary rather than base64 strings. Values that are already JSON, such as a
+// json.RawMessage or the output of a json.Marshaler, are translated.
+func writeBinary(buf *bytes.Buffer, f binaryFormat, v reflect.Value, depth int) error {
+	if depth > maxFrameDepth {
+		return fmt.Errorf("exceeded max depth")
+	}
+
+	if !v.IsValid() {
+		f.writeNull(buf)
+		return nil
+	}
+
+	t := v.Type()
+
+	if t == typeOfEncodedValue {
+		buf.Write(v.Bytes())
+		return nil
+	}
+
+	if t == typeOfRawMessage {
+		if v.Len() == 0 {
+			f.writeNull(buf)
+			return nil
+		}
+		return writeBinaryJSON(buf, f, v.Bytes())
+	}
+
+	if t == typeOfNumber {
+		n := json.Number(v.String())
+		if n == "" {
+			n = "0"
+		}
+		return f.writeNumber(buf, n)
+	}
+
+	bt := binaryTypeOf(t)
+
+	if bt.addrMarshaler && v.CanAddr() {
+		v, bt = v.Addr(), &marshalerType
+	}
+
+	if bt.marshaler {
+		m, ok := v.Interface().(json.Marshaler)
+		if !ok || v.Kind() == reflect.Ptr && v.IsNil() {
+			f.writeNull(buf)
+			return nil
+		}
+
+		data, err := m.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		return writeBinaryJSON(buf, f, data)
+	}
+
+	if bt.addrText && v.CanAddr() {
+		v, bt = v.Addr(), &textMarshalerType
+	}
+
+	if bt.text {
+		tm, ok := v.Interface().(encoding.TextMarshaler)
+		if !ok || v.Kind() == reflect.Ptr && v.IsNil() {
+			f.writeNull(buf)
+			return nil
+		}
+
+		text, err := tm.MarshalText()
+		if err != nil {
+			return err
+		}
+		f.writeString(buf, string(text))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		f.writeBool(buf, v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		f.writeInt(buf, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		f.writeUint(buf, v.Uint())
+	case reflect.Float32, reflect.Float64:
+		x := v.Float()
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			return fmt.Errorf("unsupported value %v", x)
+		}
+		f.writeFloat(buf, x, t.Bits())
+	case reflect.String:
+		f.writeString(buf, v.String())
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			f.writeNull(buf)
+			return nil
+		}
+		return writeBinary(buf, f, v.Elem(), depth+1)
+	case reflect.Slice:
+		if v.IsNil() {
+			f.writeNull(buf)
+			return nil
+		}
+		if bt.bytes {
+			f.writeBytes(buf, v.Bytes())
+			return nil
+		}
+		fallthrough
+	case reflect.Array:
+		f.writeArray(buf, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if err := writeBinary(buf, f, v.Index(i), depth+1); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			f.writeNull(buf)
+			return nil
+		}
+		return writeBinaryMap(buf, f, v, depth)
+	case reflect.Struct:
+		return writeBinaryStruct(buf, f, v, depth)
+	default:
+		return fmt.Errorf("unsupported type %s", t)
+	}
+
+	return nil
+}
+
+// binaryType is how writeBinary writes the values of a type.
+type binaryType struct {
+	// set if the type, or a pointer to it, implements json.Marshaler or
+	// encoding.TextMarshaler
+	marshaler, addrMarshaler bool
+	text, addrText           bool
+
+	// set for byte slices written as binary rather than as arrays
+	bytes bool
+}
+
+var (
+	binaryTypes sync.Map
+
+	marshalerType     = binaryType{marshaler: true}
+	textMarshalerType = binaryType{text: true}
+)
+
+func binaryTypeOf(t reflect.Type) *binaryType {
+	if bt, ok := binaryTypes.Load(t); ok {
+		return bt.(*binaryType)
+	}
+
+	bt := &binaryType{
+		marshaler: t.Implements(typeOfJSONMarshaler),
+		text:      t.Implements(typeOfTextMarshaler),
+	}
+
+	if t.Kind() != reflect.Ptr {
+		ptr := reflect.PtrTo(t)
+		bt.addrMarshaler = !bt.marshaler && ptr.Implements(typeOfJSONMarshaler)
+		bt.addrText = !bt.text && ptr.Implements(typeOfTextMarshaler)
+	}
+
+	if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+		elem := reflect.PtrTo(t.Elem())
+		bt.bytes = !elem.Implements(typeOfJSONMarshaler) && !elem.Implements(typeOfTextMarshaler)
+	}
+
+	binaryTypes.Store(t, bt)
+	return bt
+}
+
+// writeBinaryMap writes the map v with its keys sorted, as encoding/json does.
+func writeBinaryMap(buf *bytes.Buffer, f binaryFormat, v reflect.Value, depth int) error {
+	type entry struct {
+		name  string
+		value reflect.Value
+	}
+
+	entries := make([]entry, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		name, err := mapKeyName(iter.Key())
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry{name, iter.Value()})
+	}
+	if len(entries) > 1 {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	}
+
+	f.writeMap(buf, len(entries))
+	for _, e := range entries {
+		f.writeString(buf, e.name)
+		if err := writeBinary(buf, f, e.value, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mapKeyName returns the member name encoding/json gives the map key k.
+func mapKeyName(k reflect.Value) (string, error) {
+	if k.Kind() == reflect.String {
+		return k.String(), nil
+	}
+
+	if tm, ok := k.Interface().(encoding.TextMarshaler); ok {
+		if k.Kind() == reflect.Ptr && k.IsNil() {
+			return "", nil
+		}
+		text, err := tm.MarshalText()
+		return string(text), err
+	}
+
+	switch k.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10), nil
+	}
+
+	return "", fmt.Errorf("unsupported map key type %s", k.Type())
+}
+
+// writeBinaryStruct writes the fields of the struct v that encoding/json
+// encodes.
+func writeBinaryStruct(buf *bytes.Buffer, f binaryFormat, v reflect.Value, depth int) error {
+	fields := jsonFields(v.Type())
+
+	n := 0
+	for i := range fields {
+		if _, ok := structField(v, &fields[i]); ok {
+			n++
+		}
+	}
+
+	f.writeMap(buf, n)
+	for i := range fields {
+		field := &fields[i]
+
+		value, ok := structField(v, field)
+		if !ok {
+			continue
+		}
+
+		f.writeString(buf, field.name)
+
+		if field.quoted && quotable(value) {
+			data, err := json.Marshal(value.Interface())
+			if err != nil {
+				return err
+			}
+			f.writeString(buf, string(data))
+			continue
+		}
+
+		if err := writeBinary(buf, f, value, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// structField returns the value of field in v, reporting false if it isn't
+// written.
+func structField(v reflect.Value, field *jsonField) (reflect.Value, bool) {
+	value, ok := fieldByIndex(v, field.index)
+	if !ok || field.omitEmpty && isEmptyValue(value) {
+		return value, false
+	}
+	return value, true
+}
+
+// quotable reports whether the string option of a json tag applies to v.
+func quotable(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// writeBinaryJSON translates the JSON value data to format f.
+func writeBinaryJSON(buf *bytes.Buffer, f binaryFormat, data []byte) error {
+	s := &jsonScanner{data: data}
+	if err := s.value(buf, f, 0); err != nil {
+		return err
+	}
+
+	if s.skipSpace(); s.i != len(s.data) {
+		return s.syntaxError()
+	}
+	return nil
+}
+
+// jsonScanner reads JSON text, writing its values in a binary format.
+type jsonScanner struct {
+	data []byte
+	i    int
+}
+
+func (s *jsonScanner) syntaxError() error {
+	if s.i >= len(s.data) {
+		return fmt.Errorf("unexpected end of JSON input")
+	}
+	return fmt.Errorf("invalid character %q in JSON at offset %d", s.data[s.i], s.i)
+}
+
+func (s *jsonScanner) skipSpace() {
+	for s.i < len(s.data) {
+		switch s.data[s.i] {
+		case ' ', '\t', '\n', '\r':
+			s.i++
+		default:
+			return
+		}
+	}
+}
+
+// next skips spaces and returns the next byte, zero at the end of the input.
+func (s *jsonScanner) next() byte {
+	s.skipSpace()
+	if s.i >= len(s.data) {
+		return 0
+	}
+	return s.data[s.i]
+}
+
+func (s *jsonScanner) value(buf *bytes.Buffer, f binaryFormat, depth int) error {
+	if depth > maxFrameDepth {
+		return fmt.Errorf("exceeded max depth")
+	}
+
+	switch c := s.next(); {
+	case c == '{':
+		n, err := s.count('}')
+		if err != nil {
+			return err
+		}
+
+		f.writeMap(buf, n)
+		s.i++
+		for i := 0; i < n; i++ {
+			if i > 0 {
+				s.i++ // the comma
+			}
+
+			if s.next() != '"' {
+				return s.syntaxError()
+			}
+			if err := s.string(buf, f); err != nil {
+				return err
+			}
+
+			if s.next() != ':' {
+				return s.syntaxError()
+			}
+			s.i++
+
+			if err := s.value(buf, f, depth+1); err != nil {
+				return err
+			}
+			s.skipSpace()
+		}
+		s.skipSpace()
+		s.i++
+	case c == '[':
+		n, err := s.count(']')
+		if err != nil {
+			return err
+		}
+
+		f.writeArray(buf, n)
+		s.i++
+		for i := 0; i < n; i++ {
+			if i > 0 {
+				s.i++ // the comma
+			}
+
+			if err := s.value(buf, f, depth+1); err != nil {
+				return err
+			}
+			s.skipSpace()
+		}
+		s.skipSpace()
+		s.i++
+	case c == '"':
+		return s.string(buf, f)
+	case c == 't':
+		return s.literal("true", func() { f.writeBool(buf, true) })
+	case c == 'f':
+		return s.literal("false", func() { f.writeBool(buf, false) })
+	case c == 'n':
+		return s.literal("null", func() { f.writeNull(buf) })
+	case c == '-' || c >= '0' && c <= '9':
+		start := s.i
+		for s.i < len(s.data) && isNumberByte(s.data[s.i]) {
+			s.i++
+		}
+
+		if i, ok := smallInt(s.data[start:s.i]); ok {
+			f.writeInt(buf, i)
+			return nil
+		}
+		return f.writeNumber(buf, json.Number(s.data[start:s.i]))
+	default:
+		return s.syntaxError()
+	}
+
+	return nil
+}
+
+// smallInt parses the integers of up to 18 digits, which can't overflow.
+func smallInt(number []byte) (i int64, ok bool) {
+	digits := number
+	if len(digits) > 0 && digits[0] == '-' {
+		digits = digits[1:]
+	}
+
+	if len(digits) == 0 || len(digits) > 18 || len(digits) > 1 && digits[0] == '0' {
+		return 0, false
+	}
+
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		i = i*10 + int64(c-'0')
+	}
+
+	if len(digits) < len(number) {
+		i = -i
+	}
+	return i, true
+}
+
+func isNumberByte(c byte) bool {
+	return c >= '0' && c <= '9' || c == '-' || c == '+' || c == '.' || c == 'e' || c == 'E'
+}
+
+func (s *jsonScanner) literal(lit string, write func()) error {
+	if !bytes.HasPrefix(s.data[s.i:], []byte(lit)) {
+		return s.syntaxError()
+	}
+	s.i += len(lit)
+	write()
+	return nil
+}
+
+// string writes the string starting at the current quote. Strings with
+// escapes or invalid UTF-8 are decoded by encoding/json.
+func (s *jsonScanner) string(buf *bytes.Buffer, f binaryFormat) error {
+	start := s.i
+	plain := true
+	for s.i++; s.i < len(s.data); s.i++ {
+		switch c := s.data[s.i]; {
+		case c == '\\':
+			plain = false
+			s.i++
+		case c == '"':
+			s.i++
+			if text := s.data[start+1 : s.i-1]; plain && utf8.Valid(text) {
+				f.writeText(buf, text)
+				return nil
+			}
+
+			var str string
+			if err := json.Unmarshal(s.data[start:s.i], &str); err != nil {
+				return err
+			}
+			f.writeString(buf, str)
+			return nil
+		case c < ' ':
+			return s.syntaxError()
+		}
+	}
+
+	return s.syntaxError()
+}
+
+// count returns the number of elements of the array or object starting at the
+// current bracket, closed by end.
+func (s *jsonScanner) count(end byte) (int, error) {
+	n, depth, inString := 0, 0, false
+	for i := s.i + 1; i < len(s.data); i++ {
+		c := s.data[i]
+
+		if inString {
+			switch c {
+			case '\\':
+				i++
+			case '"':
+				inString = false
+			}
+			continue
+		}
+
+		switch c {
+		case ' ', '\t', '\n', '\r':
+		case '"':
+			inString = true
+			if n == 0 {
+				n = 1
+			}
+		case '{', '[':
+			depth++
+			if n == 0 {
+				n = 1
+			}
+		case '}', ']':
+			if depth == 0 {
+				if c != end {
+					return 0, fmt.Errorf("invalid character %q in JSON at offset %d", c, i)
+				}
+				return n, nil
+			}
+			depth--
+		case ',':
+			if depth == 0 {
+				n++
+			}
+		default:
+			if n == 0 {
+				n = 1
+			}
+		}
+	}
+
+	return 0, fmt.Errorf("unexpected end of JSON input")
+}
@@ -0,0 +1,245 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBreakerRatio    = 0.5
+	defaultBreakerMinCalls = 10
+	defaultBreakerWindow   = 10 * time.Second
+	defaultBreakerOpenFor  = 5 * time.Second
+)
+
+// ErrCircuitOpen is returned for the calls a CircuitBreaker fails without
+// sending them.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitState is the state of a CircuitBreaker.
+type CircuitState int
+
+const (
+	// CircuitClosed lets calls through.
+	CircuitClosed CircuitState = iota
+
+	// CircuitOpen fails calls with ErrCircuitOpen.
+	CircuitOpen
+
+	// CircuitHalfOpen lets a single probe call through, whose outcome closes
+	// or opens the circuit again.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// CircuitBreaker fails the calls to an endpoint fast once too many of them
+// fail, see Client.SetCircuitBreaker. Once FailureRatio (0.5 if zero) of the
+// calls made over Window (10s if zero) failed, at least MinCalls (10 if zero)
+// having been made, the circuit opens for OpenFor (5s if zero). A probe call is
+// then let through: the circuit closes if it succeeds and opens again if not.
+//
+// A CircuitBreaker may be shared by the clients of one endpoint, such as those
+// of a Pool.
+type CircuitBreaker struct {
+	FailureRatio float64
+	MinCalls     int
+	Window       time.Duration
+	OpenFor      time.Duration
+
+	// Failure, if set, reports whether a call failing with err counts as a
+	// failure. By default timeouts, lost connections and errors of
+	// CategoryServer and CategoryUnavailable do, application errors don't.
+	Failure func(err error) bool
+
+	// OnStateChange, if set, is called when the circuit changes state, outside
+	// the breaker's lock.
+	OnStateChange func(from, to CircuitState)
+
+	m           sync.Mutex
+	state       CircuitState
+	openedAt    time.Time
+	probing     bool
+	windowStart time.Time
+	calls       int
+	failures    int
+
+	// the changes of state to report once the lock is released
+	changes []stateChange
+}
+
+type stateChange struct {
+	from, to CircuitState
+}
+
+// SetCircuitBreaker makes b guard the calls of the client, nil removing it. It
+// must be called before the first call.
+func (c *Client) SetCircuitBreaker(b *CircuitBreaker) {
+	c.breaker = b
+}
+
+// WithCircuitBreaker guards the calls of the client with b.
+func WithCircuitBreaker(b *CircuitBreaker) DialOption {
+	return func(opts *dialOptions) {
+		opts.breaker = b
+	}
+}
+
+// State returns the state of the circuit.
+func (b *CircuitBreaker) State() CircuitState {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if b.state == CircuitOpen && time.Since(b.openedAt) >= b.openFor() {
+		return CircuitHalfOpen
+	}
+	return b.state
+}
+
+// allow reports whether a call may be sent, failing with ErrCircuitOpen if
+// not. done must be called with the outcome of the calls allowed.
+func (b *CircuitBreaker) allow() (done func(err error), err error) {
+	b.m.Lock()
+	defer b.unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if time.Since(b.openedAt) < b.openFor() {
+			return nil, ErrCircuitOpen
+		}
+		b.setState(CircuitHalfOpen)
+		fallthrough
+	case CircuitHalfOpen:
+		if b.probing {
+			return nil, ErrCircuitOpen
+		}
+		b.probing = true
+		return b.probed, nil
+	}
+
+	return b.record, nil
+}
+
+// record counts the outcome of a call let through the closed circuit.
+func (b *CircuitBreaker) record(err error) {
+	b.m.Lock()
+	defer b.unlock()
+
+	if b.state != CircuitClosed {
+		return
+	}
+
+	now := time.Now()
+	if now.Sub(b.windowStart) >= b.window() {
+		b.windowStart, b.calls, b.failures = now, 0, 0
+	}
+
+	b.calls++
+	if b.failed(err) {
+		b.failures++
+	}
+
+	if b.calls >= b.minCalls() && float64(b.failures) >= b.ratio()*float64(b.calls) {
+		b.open(now)
+	}
+}
+
+// probed closes or opens the circuit again after the probe call.
+func (b *CircuitBreaker) probed(err error) {
+	b.m.Lock()
+	defer b.unlock()
+
+	b.probing = false
+
+	if b.failed(err) {
+		b.open(time.Now())
+		return
+	}
+
+	b.windowStart, b.calls, b.failures = time.Now(), 0, 0
+	b.setState(CircuitClosed)
+}
+
+func (b *CircuitBreaker) open(now time.Time) {
+	b.openedAt = now
+	b.setState(CircuitOpen)
+}
+
+func (b *CircuitBreaker) setState(state CircuitState) {
+	from := b.state
+	b.state = state
+
+	if from != state && b.OnStateChange != nil {
+		b.changes = append(b.changes, stateChange{from, state})
+	}
+}
+
+// unlock releases the lock, then calls OnStateChange with the changes of state
+// made while it was held, so that it may use the breaker.
+func (b *CircuitBreaker) unlock() {
+	changes := b.changes
+	b.changes = nil
+	b.m.Unlock()
+
+	for _, change := range changes {
+		b.OnStateChange(change.from, change.to)
+	}
+}
+
+func (b *CircuitBreaker) failed(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	if b.Failure != nil {
+		return b.Failure(err)
+	}
+
+	var rpcErr *Error
+	if errors.As(err, &rpcErr) {
+		category := rpcErr.Category()
+		return category == CategoryServer || category == CategoryUnavailable
+	}
+
+	var lost *connError
+	return errors.Is(err, ErrTimeout) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, ErrNoConnection) || errors.As(err, &lost)
+}
+
+func (b *CircuitBreaker) ratio() float64 {
+	if b.FailureRatio > 0 {
+		return b.FailureRatio
+	}
+	return defaultBreakerRatio
+}
+
+func (b *CircuitBreaker) minCalls() int {
+	if b.MinCalls > 0 {
+		return b.MinCalls
+	}
+	return defaultBreakerMinCalls
+}
+
+func (b *CircuitBreaker) window() time.Duration {
+	if b.Window > 0 {
+		return b.Window
+	}
+	return defaultBreakerWindow
+}
+
+func (b *CircuitBreaker) openFor() time.Duration {
+	if b.OpenFor > 0 {
+		return b.OpenFor
+	}
+	return defaultBreakerOpenFor
+}
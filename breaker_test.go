@@ -0,0 +1,30 @@
+package jsonrpc
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStateChangeOutsideLock(t *testing.T) {
+	var states []CircuitState
+
+	b := &CircuitBreaker{MinCalls: 1}
+	b.OnStateChange = func(from, to CircuitState) {
+		// State takes the breaker's lock
+		states = append(states, b.State())
+	}
+
+	done, err := b.allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	done(ErrTimeout)
+
+	if _, err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("got %v, want ErrCircuitOpen", err)
+	}
+
+	if len(states) != 1 || states[0] != CircuitOpen {
+		t.Errorf("states %v, want [open]", states)
+	}
+}
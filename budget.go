@@ -0,0 +1,67 @@
+package jsonrpc
+
+import (
+	"context"
+	"time"
+)
+
+// Budget is what a request may spend, so that handlers can adapt, for example by
+// truncating their result or skipping optional work, instead of running into
+// the server's limits.
+type Budget struct {
+	// Deadline is when the request's context expires, zero if it has no
+	// deadline.
+	Deadline time.Time
+
+	// Received is when the request was received.
+	Received time.Time
+
+	// MaxResultBytes is the encoded size the result should stay within, zero if
+	// unbounded: the smaller of Server.MaxResultBytes and the size the caller
+	// declared with MetaMaxResultSize.
+	MaxResultBytes int
+}
+
+// BudgetFromContext returns the budget of the request a context-aware handler
+// is serving.
+func BudgetFromContext(ctx context.Context) (b Budget) {
+	b.Deadline, _ = ctx.Deadline()
+
+	if conn, ok := ConnectionFromContext(ctx); ok {
+		b.MaxResultBytes = conn.s.MaxResultBytes
+	}
+
+	if req, ok := ctx.Value(requestKey{}).(*Request); ok {
+		b.Received = req.received
+
+		if max := maxResultSize(req); max > 0 && (b.MaxResultBytes <= 0 || max < b.MaxResultBytes) {
+			b.MaxResultBytes = max
+		}
+	}
+
+	return
+}
+
+// Remaining returns the time left before the deadline, and false if there is
+// no deadline.
+func (b Budget) Remaining() (time.Duration, bool) {
+	if b.Deadline.IsZero() {
+		return 0, false
+	}
+
+	return time.Until(b.Deadline), true
+}
+
+// Elapsed returns the time spent since the request was received.
+func (b Budget) Elapsed() time.Duration {
+	if b.Received.IsZero() {
+		return 0
+	}
+
+	return time.Since(b.Received)
+}
+
+// Fits reports whether a result of n encoded bytes stays within MaxResultBytes.
+func (b Budget) Fits(n int) bool {
+	return b.MaxResultBytes <= 0 || n <= b.MaxResultBytes
+}
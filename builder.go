@@ -0,0 +1,100 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// CallBuilder sets the options of a call one by one, see Client.Method:
+//
+//	err := c.Method("User.Get").Meta("tenant", id).Timeout(2*time.Second).Retry(3).Do(ctx, in, &out)
+//
+// A builder may be kept to make several calls with the same options, but
+// must not be modified while they run.
+type CallBuilder struct {
+	c        *Client
+	method   string
+	meta     map[string]string
+	timeout  time.Duration
+	retry    *RetryPolicy
+	progress func(value json.RawMessage)
+}
+
+// Method starts building a call of method.
+func (c *Client) Method(method string) *CallBuilder {
+	return &CallBuilder{c: c, method: method}
+}
+
+// Meta sends the meta key with value along with the request.
+func (b *CallBuilder) Meta(key, value string) *CallBuilder {
+	if b.meta == nil {
+		b.meta = make(map[string]string)
+	}
+	b.meta[key] = value
+	return b
+}
+
+// Timeout gives up on the call after timeout, which then fails with
+// ErrTimeout.
+func (b *CallBuilder) Timeout(timeout time.Duration) *CallBuilder {
+	b.timeout = timeout
+	return b
+}
+
+// Retry declares the call safe to run more than once and retries it up to
+// retries times on transient errors, with the backoff of the client's
+// RetryPolicy or the default one. Retry(0) disables the retries of the call.
+func (b *CallBuilder) Retry(retries int) *CallBuilder {
+	policy := RetryPolicy{}
+	if b.c.retry != nil {
+		policy = *b.c.retry
+	}
+	policy.MaxAttempts = retries + 1
+
+	b.retry = &policy
+	return b
+}
+
+// Progress calls progress with each value the handler reports with Progress,
+// as CallWithProgress does.
+func (b *CallBuilder) Progress(progress func(value json.RawMessage)) *CallBuilder {
+	b.progress = progress
+	return b
+}
+
+// Logs calls logs with each line the handler logs with Logf, as CallWithLogs
+// does.
+func (b *CallBuilder) Logs(logs func(line string)) *CallBuilder {
+	b.progress = logProgress(logs)
+	return b.Meta(MetaStreamLogs, "1")
+}
+
+// Do makes the call with params in, decoding its result into out, giving up
+// when ctx is done as CallContext does.
+func (b *CallBuilder) Do(ctx context.Context, in, out interface{}) (err error) {
+	newCall, err := b.c.parseCall(b.method, in)
+	if err != nil {
+		return
+	}
+	newCall.meta = b.meta
+	newCall.progress = b.progress
+	newCall.retry = b.retry
+
+	if b.retry != nil {
+		ctx = Idempotent(ctx)
+	}
+
+	if b.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.timeout)
+		defer cancel()
+	}
+
+	err = b.c.callContext(ctx, newCall, out)
+	if b.timeout > 0 && errors.Is(err, context.DeadlineExceeded) {
+		err = ErrTimeout
+	}
+	return
+}
@@ -0,0 +1,101 @@
+package jsonrpc
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// builtinService is the service name reserved for methods provided by the server
+// itself.
+const builtinService = "rpc"
+
+type builtinMethod func(conn *Connection, req *Request) (interface{}, error)
+
+var builtinMethods = map[string]builtinMethod{
+	"info":   (*Connection).infoBuiltin,
+	"cancel": (*Connection).cancelBuiltin,
+	"discover": func(conn *Connection, req *Request) (interface{}, error) {
+		return conn.s.discover()
+	},
+	"announcements": (*Connection).subscribeBuiltin,
+	"scalars":       (*Connection).scalarsBuiltin,
+	"ping":          pingBuiltin,
+}
+
+// ServerInfo is the result of the built-in rpc.info method.
+type ServerInfo struct {
+	Version   string `json:"version"`
+	GoVersion string `json:"goVersion"`
+
+	// ProtocolVersion and Codecs name the protocol and the wire format of the
+	// connection rpc.info was called on.
+	ProtocolVersion string   `json:"protocolVersion"`
+	Features        []string `json:"features"`
+	Codecs          []string `json:"codecs"`
+
+	// Scalars names the format of the types whose encoding the server
+	// overrides on the connection, see Server.Scalars and rpc.scalars.
+	Scalars map[string]string `json:"scalars,omitempty"`
+}
+
+func (conn *Connection) infoBuiltin(req *Request) (interface{}, error) {
+	s := conn.s
+	version := s.Version
+	if version == "" {
+		if bi, ok := debug.ReadBuildInfo(); ok {
+			version = bi.Main.Version
+		}
+	}
+
+	return &ServerInfo{
+		Version:         version,
+		GoVersion:       runtime.Version(),
+		ProtocolVersion: conn.protocol.String(),
+		Features:        s.features(),
+		Codecs:          []string{codecName(conn.codec)},
+		Scalars:         conn.scalarsOf(req).Formats(),
+	}, nil
+}
+
+// features lists the optional features enabled on the server.
+func (s *Server) features() []string {
+	features := []string{"batching", "notifications", "callbacks", "cancellation", "progress", "discovery", "announcements", "scalars", "ping"}
+
+	if len(s.resultTransformers) > 0 {
+		features = append(features, "resultTransformers")
+	}
+
+	if s.Tracer != nil {
+		features = append(features, "tracing")
+	}
+
+	if s.Metrics != nil {
+		features = append(features, "metrics")
+	}
+
+	if s.Checksum {
+		features = append(features, "checksum")
+	}
+
+	if s.Authz != nil {
+		features = append(features, "authorization")
+	}
+
+	if s.Diagnostics {
+		features = append(features, "diagnostics")
+	}
+
+	if s.ProfileLabels {
+		features = append(features, "profileLabels")
+	}
+
+	if s.Mirror != nil {
+		features = append(features, "mirroring")
+	}
+
+	if s.StrictEnvelope {
+		features = append(features, "strictEnvelope")
+	}
+
+	return features
+}
@@ -0,0 +1,29 @@
+package jsonrpc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInfoReportsConnection(t *testing.T) {
+	s := NewServer("")
+	s.Protocol = ProtocolAuto
+
+	for _, p := range []Protocol{ProtocolJSONRPC2, ProtocolJSONRPC1} {
+		_, c := NewLocalPair(s)
+		c.SetProtocol(p)
+
+		var info ServerInfo
+		if err := c.Call("rpc.info", nil, &info); err != nil {
+			t.Fatal(err)
+		}
+		c.Close()
+
+		if info.ProtocolVersion != p.String() {
+			t.Errorf("protocol %q, want %q", info.ProtocolVersion, p)
+		}
+		if !reflect.DeepEqual(info.Codecs, []string{"json"}) {
+			t.Errorf("codecs %q, want json", info.Codecs)
+		}
+	}
+}
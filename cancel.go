@@ -0,0 +1,129 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// cancelMethod is the built-in notification a client sends to cancel one of its
+// pending requests.
+const cancelMethod = builtinService + ".cancel"
+
+// maxEarlyCancels bounds the cancellations remembered for requests that haven't
+// started yet.
+const maxEarlyCancels = 1024
+
+// cancelParams are the params of rpc.cancel.
+type cancelParams struct {
+	Id json.RawMessage `json:"id"`
+}
+
+// cancelTarget returns the id of the request canceled by frame, if it is an
+// rpc.cancel notification.
+func cancelTarget(fields map[string]json.RawMessage) (id string, ok bool) {
+	params, ok := builtinParams(fields, cancelMethod)
+	if !ok {
+		return
+	}
+
+	var p cancelParams
+	if err := decodeParams(params, &p); err != nil || len(p.Id) == 0 {
+		return "", false
+	}
+
+	return string(p.Id), true
+}
+
+// builtinParams returns the params of frame if it is a request for the built-in
+// method.
+func builtinParams(fields map[string]json.RawMessage, method string) (params json.RawMessage, ok bool) {
+	var m string
+	if json.Unmarshal(fields["method"], &m) != nil || m != method {
+		return
+	}
+
+	params, hasParams := fields["params"]
+	if !hasParams {
+		params = fields["param"]
+	}
+
+	// JSON-RPC 1.0 peers send the params object as the only element of an
+	// array
+	var elems []json.RawMessage
+	if firstByte(params) == '[' && json.Unmarshal(params, &elems) == nil && len(elems) == 1 && firstByte(elems[0]) == '{' {
+		params = elems[0]
+	}
+
+	return params, true
+}
+
+// requestContext returns the context of a request, canceled when the client
+// sends rpc.cancel for it. The returned function must be called once the
+// request is done.
+func (conn *Connection) requestContext(req *Request) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.WithValue(conn.ctx, requestKey{}, req))
+	if req.notification {
+		return ctx, cancel
+	}
+
+	id := string(req.Id)
+
+	conn.cancelMu.Lock()
+	if conn.earlyCancels[id] {
+		delete(conn.earlyCancels, id)
+		cancel()
+	}
+	if conn.inflight == nil {
+		conn.inflight = make(map[string]context.CancelFunc)
+	}
+	conn.inflight[id] = cancel
+	conn.cancelMu.Unlock()
+
+	return ctx, func() {
+		conn.cancelMu.Lock()
+		delete(conn.inflight, id)
+		conn.cancelMu.Unlock()
+		cancel()
+	}
+}
+
+// cancelRequest cancels the context of the request with the given id. Requests
+// that haven't started yet are canceled as soon as they do.
+func (conn *Connection) cancelRequest(id string) {
+	conn.cancelMu.Lock()
+	defer conn.cancelMu.Unlock()
+
+	if cancel, ok := conn.inflight[id]; ok {
+		cancel()
+		return
+	}
+
+	if conn.earlyCancels == nil {
+		conn.earlyCancels = make(map[string]bool)
+	}
+
+	if len(conn.earlyCancels) >= maxEarlyCancels {
+		for early := range conn.earlyCancels {
+			delete(conn.earlyCancels, early)
+			break
+		}
+	}
+	conn.earlyCancels[id] = true
+}
+
+// cancelBuiltin handles rpc.cancel sent inside a batch; standalone ones are handled as
+// soon as they are read.
+func (conn *Connection) cancelBuiltin(req *Request) (interface{}, error) {
+	var p cancelParams
+	if err := decodeParams(req.Param, &p); err != nil || len(p.Id) == 0 {
+		return nil, newError(CodeInvalidParams, "invalid params: expected {\"id\": <request id>}")
+	}
+
+	conn.cancelRequest(string(p.Id))
+	return nil, nil
+}
+
+// cancelRemote asks the server to cancel the call with the given id.
+func (c *Client) cancelRemote(id uint32) {
+	_ = c.Notify(cancelMethod, &cancelParams{Id: json.RawMessage(uintToString(id))})
+}
@@ -0,0 +1,743 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Major types of CBOR items.
+const (
+	cborUint   = 0
+	cborNegint = 1
+	cborBytes  = 2
+	cborText   = 3
+	cborArray  = 4
+	cborMap    = 5
+	cborTag    = 6
+	cborSimple = 7
+)
+
+// cborBreak ends the items of indefinite length.
+const cborBreak = 0xff
+
+// CBORCodec reads and writes frames in CBOR (RFC 8949), a compact binary form
+// of JSON common on constrained devices, for servers and clients using it on
+// both ends:
+//
+//	s.Codec = jsonrpc.NewCBORCodec
+//	c, err := jsonrpc.DialContext(ctx, addr, jsonrpc.WithCodec(jsonrpc.NewCBORCodec))
+//
+// As with MessagePackCodec, frames are written straight from their Go values,
+// byte slices as CBOR byte strings, and integers beyond 64 bits as bignums.
+// Decode reads byte strings back into []byte, and into interface{} values as
+// []byte, other items as encoding/json would decode their JSON. Frames read
+// by the connection are read as JSON, byte strings as base64 strings, which
+// decode into []byte, bignums as numbers, which *big.Int params and results
+// decode, and epoch timestamps as RFC 3339 strings. Items of indefinite
+// length are accepted, other tags are ignored. Frames don't carry checksums.
+type CBORCodec struct {
+	Conn   net.Conn
+	reader *bufio.Reader
+	out    bytes.Buffer
+	in     bytes.Buffer
+}
+
+// NewCBORCodec returns a CBORCodec reading and writing conn.
+func NewCBORCodec(conn net.Conn) Codec {
+	return &CBORCodec{
+		Conn:   conn,
+		reader: bufio.NewReader(conn),
+	}
+}
+
+func (codec *CBORCodec) Encode(input interface{}) error {
+	codec.out.Reset()
+	if err := writeBinary(&codec.out, cborFormat{}, reflect.ValueOf(input), 0); err != nil {
+		return fmt.Errorf("cbor: %w", err)
+	}
+
+	_, err := codec.Conn.Write(codec.out.Bytes())
+	return err
+}
+
+func (codec *CBORCodec) encodeBinary(v interface{}) (encodedValue, error) {
+	var buf bytes.Buffer
+	if err := writeBinary(&buf, cborFormat{}, reflect.ValueOf(v), 0); err != nil {
+		return nil, fmt.Errorf("cbor: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (codec *CBORCodec) Decode(output interface{}) error {
+	if _, err := codec.reader.Peek(1); err != nil {
+		return err
+	}
+
+	if out, ok := output.(*json.RawMessage); ok {
+		codec.in.Reset()
+		if err := readCBOR(codec.reader, &codec.in, 0); err != nil {
+			return unexpectedEOF(err)
+		}
+
+		*out = append(json.RawMessage(nil), codec.in.Bytes()...)
+		return nil
+	}
+
+	v := reflect.ValueOf(output)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return &json.InvalidUnmarshalError{Type: reflect.TypeOf(output)}
+	}
+	return unexpectedEOF(readCBORValue(codec.reader, v.Elem(), 0))
+}
+
+// unexpectedEOF returns io.ErrUnexpectedEOF for io.EOF, the end of the stream
+// in the middle of a frame.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// cborFormat writes CBOR items.
+type cborFormat struct{}
+
+func (cborFormat) writeNull(buf *bytes.Buffer) {
+	buf.WriteByte(cborSimple<<5 | 22)
+}
+
+func (cborFormat) writeBool(buf *bytes.Buffer, b bool) {
+	if b {
+		buf.WriteByte(cborSimple<<5 | 21)
+	} else {
+		buf.WriteByte(cborSimple<<5 | 20)
+	}
+}
+
+func (cborFormat) writeInt(buf *bytes.Buffer, i int64) {
+	if i < 0 {
+		// negative integers are coded as -1 - n
+		writeCBORHead(buf, cborNegint, uint64(-(i + 1)))
+		return
+	}
+	writeCBORHead(buf, cborUint, uint64(i))
+}
+
+func (cborFormat) writeUint(buf *bytes.Buffer, u uint64) {
+	writeCBORHead(buf, cborUint, u)
+}
+
+func (cborFormat) writeFloat(buf *bytes.Buffer, f float64, bits int) {
+	if bits == 32 {
+		buf.WriteByte(cborSimple<<5 | 26)
+		writeBigEndian(buf, uint64(math.Float32bits(float32(f))), 4)
+		return
+	}
+
+	buf.WriteByte(cborSimple<<5 | 27)
+	writeBigEndian(buf, math.Float64bits(f), 8)
+}
+
+// writeNumber writes integers beyond 64 bits as bignums.
+func (format cborFormat) writeNumber(buf *bytes.Buffer, n json.Number) error {
+	if !strings.ContainsAny(string(n), ".eE") {
+		i, ok := new(big.Int).SetString(string(n), 10)
+		if !ok {
+			return fmt.Errorf("invalid number %s", n)
+		}
+
+		major, tag := byte(cborUint), uint64(2)
+		if i.Sign() < 0 {
+			major, tag = cborNegint, 3
+			i.Neg(i).Sub(i, big.NewInt(1))
+		}
+
+		if i.IsUint64() {
+			writeCBORHead(buf, major, i.Uint64())
+			return nil
+		}
+
+		b := i.Bytes()
+		writeCBORHead(buf, cborTag, tag)
+		format.writeBytes(buf, b)
+		return nil
+	}
+
+	f, err := strconv.ParseFloat(string(n), 64)
+	if err != nil {
+		return fmt.Errorf("number %s out of range", n)
+	}
+
+	format.writeFloat(buf, f, 64)
+	return nil
+}
+
+func (cborFormat) writeString(buf *bytes.Buffer, s string) {
+	writeCBORHead(buf, cborText, uint64(len(s)))
+	buf.WriteString(s)
+}
+
+func (cborFormat) writeText(buf *bytes.Buffer, text []byte) {
+	writeCBORHead(buf, cborText, uint64(len(text)))
+	buf.Write(text)
+}
+
+func (cborFormat) writeBytes(buf *bytes.Buffer, b []byte) {
+	writeCBORHead(buf, cborBytes, uint64(len(b)))
+	buf.Write(b)
+}
+
+func (cborFormat) writeArray(buf *bytes.Buffer, n int) {
+	writeCBORHead(buf, cborArray, uint64(n))
+}
+
+func (cborFormat) writeMap(buf *bytes.Buffer, n int) {
+	writeCBORHead(buf, cborMap, uint64(n))
+}
+
+// writeCBORHead writes the head of an item of major type with argument n.
+func writeCBORHead(buf *bytes.Buffer, major byte, n uint64) {
+	switch {
+	case n < 24:
+		buf.WriteByte(major<<5 | byte(n))
+	case n <= math.MaxUint8:
+		buf.Write([]byte{major<<5 | 24, byte(n)})
+	case n <= math.MaxUint16:
+		buf.WriteByte(major<<5 | 25)
+		writeBigEndian(buf, n, 2)
+	case n <= math.MaxUint32:
+		buf.WriteByte(major<<5 | 26)
+		writeBigEndian(buf, n, 4)
+	default:
+		buf.WriteByte(major<<5 | 27)
+		writeBigEndian(buf, n, 8)
+	}
+}
+
+// malformedCBOR returns an error wrapping ErrMalformedFrame.
+func malformedCBOR(format string, args ...interface{}) error {
+	return fmt.Errorf("cbor: %s: %w", fmt.Sprintf(format, args...), ErrMalformedFrame)
+}
+
+// readCBORHead reads the head of the next item: its major type, additional
+// information and argument. The argument of items of indefinite length is
+// zero, their info 31.
+func readCBORHead(r *bufio.Reader) (major, info byte, n uint64, err error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return
+	}
+
+	major, info = b>>5, b&0x1f
+	switch {
+	case info < 24:
+		n = uint64(info)
+	case info <= 27:
+		n, err = readBigEndian(r, 1<<(info-24))
+	case info == 31 && (major >= cborBytes && major <= cborMap || major == cborSimple):
+	default:
+		err = malformedCBOR("invalid additional information %d", info)
+	}
+	return
+}
+
+// readCBOR reads the next item of r and writes it as JSON to out, depth being
+// the number of arrays, maps and tags it is nested in.
+func readCBOR(r *bufio.Reader, out *bytes.Buffer, depth int) error {
+	if depth > maxFrameDepth {
+		return malformedCBOR("exceeded max depth")
+	}
+
+	major, info, n, err := readCBORHead(r)
+	if err != nil {
+		return err
+	}
+	return readCBORItem(r, out, major, info, n, depth)
+}
+
+// readCBORItem writes as JSON to out the item whose head was read.
+func readCBORItem(r *bufio.Reader, out *bytes.Buffer, major, info byte, n uint64, depth int) error {
+	switch major {
+	case cborUint:
+		out.WriteString(strconv.FormatUint(n, 10))
+	case cborNegint:
+		out.WriteString(new(big.Int).Sub(big.NewInt(-1), new(big.Int).SetUint64(n)).String())
+	case cborBytes:
+		data, err := readCBORString(r, major, info, n)
+		if err != nil {
+			return err
+		}
+		out.WriteByte('"')
+		out.WriteString(base64.StdEncoding.EncodeToString(data))
+		out.WriteByte('"')
+	case cborText:
+		data, err := readCBORString(r, major, info, n)
+		if err != nil {
+			return err
+		}
+		b, _ := json.Marshal(string(data))
+		out.Write(b)
+	case cborArray:
+		out.WriteByte('[')
+		for i := 0; info == 31 || uint64(i) < n; i++ {
+			if info == 31 {
+				if end, err := cborEnd(r); end || err != nil {
+					if err != nil {
+						return err
+					}
+					break
+				}
+			}
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			if err := readCBOR(r, out, depth+1); err != nil {
+				return err
+			}
+		}
+		out.WriteByte(']')
+	case cborMap:
+		out.WriteByte('{')
+		for i := 0; info == 31 || uint64(i) < n; i++ {
+			if info == 31 {
+				if end, err := cborEnd(r); end || err != nil {
+					if err != nil {
+						return err
+					}
+					break
+				}
+			}
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			if err := readCBORKey(r, out, depth+1); err != nil {
+				return err
+			}
+			out.WriteByte(':')
+			if err := readCBOR(r, out, depth+1); err != nil {
+				return err
+			}
+		}
+		out.WriteByte('}')
+	case cborTag:
+		return readCBORTag(r, out, n, depth)
+	default:
+		return readCBORSimple(r, out, info, n)
+	}
+
+	return nil
+}
+
+// cborEnd consumes the break ending an item of indefinite length, reporting
+// whether there was one.
+func cborEnd(r *bufio.Reader) (bool, error) {
+	b, err := r.Peek(1)
+	if err != nil {
+		return false, err
+	}
+	if b[0] != cborBreak {
+		return false, nil
+	}
+
+	_, err = r.ReadByte()
+	return true, err
+}
+
+// readCBORString reads the content of a byte or text string whose head was
+// read, joining the chunks of strings of indefinite length.
+func readCBORString(r *bufio.Reader, major, info byte, n uint64) ([]byte, error) {
+	if info != 31 {
+		return readBytes(r, int(n))
+	}
+
+	var data []byte
+	for {
+		if end, err := cborEnd(r); end || err != nil {
+			return data, err
+		}
+
+		chunkMajor, chunkInfo, chunkLen, err := readCBORHead(r)
+		if err != nil {
+			return nil, err
+		}
+		if chunkMajor != major || chunkInfo == 31 {
+			return nil, malformedCBOR("invalid chunk of a string of indefinite length")
+		}
+
+		chunk, err := readBytes(r, int(chunkLen))
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, chunk...)
+	}
+}
+
+// readCBORKey reads a map key, which must be a string or an integer.
+func readCBORKey(r *bufio.Reader, out *bytes.Buffer, depth int) error {
+	start := out.Len()
+	if err := readCBOR(r, out, depth); err != nil {
+		return err
+	}
+
+	switch key := out.Bytes()[start:]; {
+	case firstByte(key) == '"':
+	case firstByte(key) == '-' || firstByte(key) >= '0' && firstByte(key) <= '9':
+		quoted := strconv.Quote(string(key))
+		out.Truncate(start)
+		out.WriteString(quoted)
+	default:
+		return malformedCBOR("map key %s is not a string", key)
+	}
+	return nil
+}
+
+// readCBORTag reads the item tagged n: bignums are read as numbers, epoch
+// timestamps as RFC 3339 strings, the tags of other items are ignored.
+func readCBORTag(r *bufio.Reader, out *bytes.Buffer, n uint64, depth int) error {
+	switch n {
+	case 2, 3:
+		major, info, length, err := readCBORHead(r)
+		if err != nil {
+			return err
+		}
+		if major != cborBytes {
+			return malformedCBOR("bignum is not a byte string")
+		}
+
+		data, err := readCBORString(r, major, info, length)
+		if err != nil {
+			return err
+		}
+
+		i := new(big.Int).SetBytes(data)
+		if n == 3 {
+			i.Neg(i).Sub(i, big.NewInt(1))
+		}
+		out.WriteString(i.String())
+	case 1:
+		var epoch bytes.Buffer
+		if err := readCBOR(r, &epoch, depth+1); err != nil {
+			return err
+		}
+
+		f, err := strconv.ParseFloat(epoch.String(), 64)
+		if err != nil {
+			return malformedCBOR("invalid epoch timestamp %s", epoch.String())
+		}
+
+		sec, frac := math.Modf(f)
+		out.WriteByte('"')
+		out.WriteString(time.Unix(int64(sec), int64(frac*1e9)).UTC().Format(time.RFC3339Nano))
+		out.WriteByte('"')
+	default:
+		return readCBOR(r, out, depth+1)
+	}
+
+	return nil
+}
+
+// readCBORSimple writes the simple value or float whose head was read.
+func readCBORSimple(r *bufio.Reader, out *bytes.Buffer, info byte, n uint64) error {
+	var f float64
+	switch info {
+	case 20:
+		out.WriteString("false")
+		return nil
+	case 21:
+		out.WriteString("true")
+		return nil
+	case 22, 23:
+		// null and undefined
+		out.WriteString("null")
+		return nil
+	case 25:
+		f = halfFloat(uint16(n))
+	case 26:
+		f = float64(math.Float32frombits(uint32(n)))
+	case 27:
+		f = math.Float64frombits(n)
+	default:
+		return malformedCBOR("unsupported simple value %d", n)
+	}
+
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return malformedCBOR("unsupported float %v", f)
+	}
+
+	// floats are written with the precision they were sent with
+	var b []byte
+	if info == 27 {
+		b, _ = json.Marshal(f)
+	} else {
+		b, _ = json.Marshal(float32(f))
+	}
+	out.Write(b)
+	return nil
+}
+
+// halfFloat returns the value of the IEEE 754 half-precision float h.
+func halfFloat(h uint16) (f float64) {
+	exp, mant := int(h>>10&0x1f), float64(h&0x3ff)
+
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 0x1f:
+		f = math.Inf(1)
+		if mant != 0 {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+
+	if h&0x8000 != 0 {
+		f = -f
+	}
+	return
+}
+
+var (
+	typeOfJSONUnmarshaler = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	typeOfTextUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// unmarshalsJSON reports whether values of t decode themselves from JSON.
+func unmarshalsJSON(t reflect.Type) bool {
+	ptr := reflect.PtrTo(t)
+	return ptr.Implements(typeOfJSONUnmarshaler) || ptr.Implements(typeOfTextUnmarshaler)
+}
+
+// readCBORValue reads the next item of r into v, which must be settable, as
+// encoding/json unmarshals its JSON, except that byte strings are read into
+// []byte and interface{} values as they are rather than as base64 strings.
+// Other items, and values of types unmarshaling themselves, are decoded from
+// their JSON.
+func readCBORValue(r *bufio.Reader, v reflect.Value, depth int) error {
+	if depth > maxFrameDepth {
+		return malformedCBOR("exceeded max depth")
+	}
+
+	major, info, n, err := readCBORHead(r)
+	if err != nil {
+		return err
+	}
+
+	if major != cborBytes && major != cborArray && major != cborMap {
+		return readCBORJSON(r, v, major, info, n, depth)
+	}
+
+	for v.Kind() == reflect.Ptr && !unmarshalsJSON(v.Type()) {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+
+	generic := v.Kind() == reflect.Interface && v.NumMethod() == 0 &&
+		(v.IsNil() || v.Elem().Kind() != reflect.Ptr)
+	if !generic && (v.Kind() == reflect.Interface || unmarshalsJSON(v.Type())) {
+		return readCBORJSON(r, v, major, info, n, depth)
+	}
+
+	switch major {
+	case cborBytes:
+		data, err := readCBORString(r, major, info, n)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case generic:
+			v.Set(reflect.ValueOf(data))
+		case v.Kind() == reflect.Slice && binaryTypeOf(v.Type()).bytes:
+			v.SetBytes(data)
+		default:
+			b, _ := json.Marshal(data)
+			return json.Unmarshal(b, v.Addr().Interface())
+		}
+	case cborArray:
+		if generic {
+			array := reflect.New(reflect.TypeOf([]interface{}(nil))).Elem()
+			if err := readCBORArray(r, array, info, n, depth); err != nil {
+				return err
+			}
+			v.Set(array)
+			return nil
+		}
+		if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+			return readCBORJSON(r, v, major, info, n, depth)
+		}
+		return readCBORArray(r, v, info, n, depth)
+	case cborMap:
+		if generic {
+			object := reflect.New(reflect.TypeOf(map[string]interface{}(nil))).Elem()
+			if err := readCBORMap(r, object, info, n, depth); err != nil {
+				return err
+			}
+			v.Set(object)
+			return nil
+		}
+		if v.Kind() == reflect.Struct {
+			return readCBORStruct(r, v, info, n, depth)
+		}
+		if v.Kind() != reflect.Map || v.Type().Key().Kind() != reflect.String || unmarshalsJSON(v.Type().Key()) {
+			return readCBORJSON(r, v, major, info, n, depth)
+		}
+		return readCBORMap(r, v, info, n, depth)
+	}
+
+	return nil
+}
+
+// readCBORJSON decodes into v the JSON of the item whose head was read.
+func readCBORJSON(r *bufio.Reader, v reflect.Value, major, info byte, n uint64, depth int) error {
+	var item bytes.Buffer
+	if err := readCBORItem(r, &item, major, info, n, depth); err != nil {
+		return err
+	}
+	return json.Unmarshal(item.Bytes(), v.Addr().Interface())
+}
+
+// readCBORArray reads the elements of an array whose head was read into the
+// slice or array v.
+func readCBORArray(r *bufio.Reader, v reflect.Value, info byte, n uint64, depth int) error {
+	if v.Kind() == reflect.Slice {
+		// the length read is only a hint, the elements may not follow
+		hint := n
+		if hint > 64 {
+			hint = 64
+		}
+		v.Set(reflect.MakeSlice(v.Type(), 0, int(hint)))
+	}
+
+	i := 0
+	for ; info == 31 || uint64(i) < n; i++ {
+		if info == 31 {
+			if end, err := cborEnd(r); end || err != nil {
+				if err != nil {
+					return err
+				}
+				break
+			}
+		}
+
+		var elem reflect.Value
+		switch {
+		case v.Kind() == reflect.Slice:
+			v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+			elem = v.Index(i)
+		case i < v.Len():
+			elem = v.Index(i)
+		default:
+			// elements beyond the length of arrays are dropped
+			elem = reflect.New(typeOfRawMessage).Elem()
+		}
+
+		if err := readCBORValue(r, elem, depth+1); err != nil {
+			return err
+		}
+	}
+
+	for ; v.Kind() == reflect.Array && i < v.Len(); i++ {
+		v.Index(i).Set(reflect.Zero(v.Type().Elem()))
+	}
+	return nil
+}
+
+// readCBORMap reads the members of a map whose head was read into v, a map
+// with string keys.
+func readCBORMap(r *bufio.Reader, v reflect.Value, info byte, n uint64, depth int) error {
+	if v.IsNil() {
+		v.Set(reflect.MakeMap(v.Type()))
+	}
+
+	return readCBORMembers(r, info, n, depth, func(name string) error {
+		elem := reflect.New(v.Type().Elem()).Elem()
+		if err := readCBORValue(r, elem, depth+1); err != nil {
+			return err
+		}
+
+		v.SetMapIndex(reflect.ValueOf(name).Convert(v.Type().Key()), elem)
+		return nil
+	})
+}
+
+// readCBORStruct reads the members of a map whose head was read into the
+// fields of struct v, matched by name as encoding/json does.
+func readCBORStruct(r *bufio.Reader, v reflect.Value, info byte, n uint64, depth int) error {
+	fields := jsonFields(v.Type())
+
+	return readCBORMembers(r, info, n, depth, func(name string) error {
+		var field *jsonField
+		for i := range fields {
+			if fields[i].name == name {
+				field = &fields[i]
+				break
+			}
+			if field == nil && strings.EqualFold(fields[i].name, name) {
+				field = &fields[i]
+			}
+		}
+
+		var member json.RawMessage
+		switch {
+		case field == nil:
+			return readCBORValue(r, reflect.ValueOf(&member).Elem(), depth+1)
+		case field.quoted || len(field.index) > 1:
+			// let encoding/json unquote the value, or allocate the embedded
+			// structs on the way to the field
+			if err := readCBORValue(r, reflect.ValueOf(&member).Elem(), depth+1); err != nil {
+				return err
+			}
+
+			object, err := json.Marshal(map[string]json.RawMessage{field.name: member})
+			if err != nil {
+				return err
+			}
+			return json.Unmarshal(object, v.Addr().Interface())
+		}
+
+		return readCBORValue(r, v.Field(field.index[0]), depth+1)
+	})
+}
+
+// readCBORMembers reads the members of a map whose head was read, calling
+// value with the name of each to read its value.
+func readCBORMembers(r *bufio.Reader, info byte, n uint64, depth int, value func(name string) error) error {
+	for i := 0; info == 31 || uint64(i) < n; i++ {
+		if info == 31 {
+			if end, err := cborEnd(r); end || err != nil {
+				return err
+			}
+		}
+
+		var key bytes.Buffer
+		if err := readCBORKey(r, &key, depth+1); err != nil {
+			return err
+		}
+
+		var name string
+		if err := json.Unmarshal(key.Bytes(), &name); err != nil {
+			return err
+		}
+
+		if err := value(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestCBORMatchesJSON(t *testing.T) {
+	for _, v := range binaryValues() {
+		want, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		if err := writeBinary(&buf, cborFormat{}, reflect.ValueOf(v), 0); err != nil {
+			t.Fatalf("%s: %v", want, err)
+		}
+
+		var got bytes.Buffer
+		if err := readCBOR(bufio.NewReader(&buf), &got, 0); err != nil {
+			t.Fatalf("%s: %v", want, err)
+		}
+
+		var a, b interface{}
+		if err := json.Unmarshal(want, &a); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(got.Bytes(), &b); err != nil {
+			t.Fatalf("%s: %v", got.Bytes(), err)
+		}
+		if !reflect.DeepEqual(a, b) {
+			t.Errorf("got %s, want %s", got.Bytes(), want)
+		}
+	}
+}
+
+func TestCBORByteStrings(t *testing.T) {
+	encoded, err := (&CBORCodec{}).encodeBinary([]byte{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []byte{cborBytes<<5 | 2, 1, 2}; !bytes.Equal(encoded, want) {
+		t.Errorf("got % x, want % x", encoded, want)
+	}
+
+	var out interface{}
+	codec := &CBORCodec{reader: bufio.NewReader(bytes.NewReader(encoded))}
+	if err := codec.Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, []byte{1, 2}) {
+		t.Errorf("decoded %#v, want the byte string", out)
+	}
+}
+
+func TestCBORDecodeMatchesJSON(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	in := &record{
+		B: []byte{0, 255},
+		C: map[string]int{"a": 1},
+		D: map[string]interface{}{"x": []interface{}{1.5, "y", nil}},
+		G: json.RawMessage(`{"k":[1,2]}`),
+		J: 0.1,
+		K: 42,
+		M: map[int]string{3: "c"},
+		N: "12.5",
+		Q: [3]uint8{1, 2},
+		U: 1 << 63,
+	}
+	go NewCBORCodec(client).Encode(in)
+
+	var got record
+	if err := NewCBORCodec(server).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+
+	frame, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want record
+	if err := json.Unmarshal(frame, &want); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,121 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"sync/atomic"
+)
+
+// checksumMember is the member carrying the CRC32 of a frame. It is appended as
+// the last member of each object, "crc32":"<8 hex digits>", and covers the
+// bytes of the object without it. The requests and responses of a batch carry
+// their own.
+const checksumMember = `"crc32":"`
+
+// ErrChecksumMismatch ends a connection on which a frame with a missing or
+// invalid checksum was received.
+var ErrChecksumMismatch = errors.New("frame checksum mismatch")
+
+// appendChecksum adds the checksum member to frame, an object or an array of
+// objects.
+func appendChecksum(frame []byte) ([]byte, error) {
+	if firstByte(frame) == '[' {
+		return mapBatch(frame, appendChecksum)
+	}
+
+	if firstByte(frame) != '{' || frame[len(frame)-1] != '}' {
+		return nil, fmt.Errorf("checksum: frame is not an object")
+	}
+
+	sum := fmt.Sprintf(`%s%08x"}`, checksumMember, crc32.ChecksumIEEE(frame))
+
+	out := make([]byte, 0, len(frame)+len(sum)+1)
+	out = append(out, frame[:len(frame)-1]...)
+	if !bytes.Equal(frame, []byte("{}")) {
+		out = append(out, ',')
+	}
+	return append(out, sum...), nil
+}
+
+// verifyChecksum checks the checksum of raw, an object or an array of objects,
+// and returns it without the checksum members.
+func verifyChecksum(raw []byte) ([]byte, error) {
+	raw = bytes.TrimSpace(raw)
+	if firstByte(raw) == '[' {
+		return mapBatch(raw, verifyChecksum)
+	}
+
+	// "crc32":"xxxxxxxx"}
+	sumLen := len(checksumMember) + 8 + 2
+	if len(raw) < sumLen+1 || !bytes.HasPrefix(raw[len(raw)-sumLen:], []byte(checksumMember)) {
+		return nil, ErrChecksumMismatch
+	}
+
+	want, err := strconv.ParseUint(string(raw[len(raw)-10:len(raw)-2]), 16, 32)
+	if err != nil {
+		return nil, ErrChecksumMismatch
+	}
+
+	body := raw[:len(raw)-sumLen]
+	switch body[len(body)-1] {
+	case ',':
+		body = body[:len(body)-1]
+	case '{':
+	default:
+		return nil, ErrChecksumMismatch
+	}
+
+	frame := append(append([]byte{}, body...), '}')
+	if crc32.ChecksumIEEE(frame) != uint32(want) {
+		return nil, ErrChecksumMismatch
+	}
+
+	return frame, nil
+}
+
+// mapBatch applies f to each element of the batch raw.
+func mapBatch(raw []byte, f func([]byte) ([]byte, error)) ([]byte, error) {
+	var elems []json.RawMessage
+	if err := json.Unmarshal(raw, &elems); err != nil {
+		return nil, err
+	}
+
+	out := []byte{'['}
+	for i, elem := range elems {
+		mapped, err := f(elem)
+		if err != nil {
+			return nil, err
+		}
+
+		if i > 0 {
+			out = append(out, ',')
+		}
+		out = append(out, mapped...)
+	}
+	return append(out, ']'), nil
+}
+
+// checksumMismatch records a frame received on conn with an invalid checksum.
+func (s *Server) checksumMismatch(conn *Connection) {
+	atomic.AddUint64(&s.checksumMismatches, 1)
+	s.logf("jsonrpc: closing connection to %s: %v", conn.info.RemoteAddr, ErrChecksumMismatch)
+}
+
+// ChecksumMismatches returns the number of frames received with an invalid
+// checksum since the server started.
+func (s *Server) ChecksumMismatches() uint64 {
+	return atomic.LoadUint64(&s.checksumMismatches)
+}
+
+// SetChecksum makes the client add a CRC32 to every frame it sends and require
+// one on every frame it receives, for servers with Checksum set. A frame with
+// an invalid checksum fails the pending calls and closes the client. The
+// client's codec must be a ChecksumCodec, as the default one is. It must be
+// called before the first call.
+func (c *Client) SetChecksum(on bool) {
+	setChecksum(c.codec, on)
+}
@@ -6,9 +6,8 @@ import (
 	"errors"
 	"fmt"
 	"net"
-	"strings"
+	"strconv"
 	"sync"
-	"sync/atomic"
 	"time"
 )
 
@@ -25,66 +24,215 @@ var (
 type Client struct {
 	addr     string
 	conn     net.Conn
-	codec    *Codec
+	codec    Codec
+	newCodec CodecFactory
 	calls    map[uint32]*Call
 	closing  bool
 	shutdown bool
-	seqId    uint32
-	reqMutex sync.Mutex
-	m        sync.Mutex
+	seqId    uint32 // the id of the last call, guarded by m
+	protocol Protocol
+	scalars  *Scalars
+	sem      chan struct{}
+	pages    PageLimits
+	info     *ServerInfo
+	signer   Signer
+
+	connectedAt time.Time
+
+	// bounds the calls made without a deadline, see WithCallTimeout
+	callTimeout time.Duration
+
+	retry   *RetryPolicy
+	breaker *CircuitBreaker
+
+	interceptors []ClientInterceptor
+
+	// the context values sent as metadata, see SetContextMeta
+	contextMeta []MetaKey
+
+	// receives the server's announcements, see SubscribeAnnouncements
+	announcements func(a *Announcement)
+	reqMutex      sync.Mutex
+	m             sync.Mutex
+
+	// serves the callback services the server may call
+	callbacks *Connection
+
+	// closed once the connection is lost or closed, or for clients that
+	// reconnect once they are closed
+	done chan struct{}
+
+	// set for clients that reconnect, see WithReconnect
+	reconnect    *Reconnect
+	connect      func(ctx context.Context) (net.Conn, error)
+	reconnecting bool
+
+	// set for clients handed out by a Registry
+	shared *registryEntry
 }
 
+// Call is a call made by a client. Those made with Go report their outcome in
+// their exported fields.
 type Call struct {
+	// Reply is the value the result is decoded into, Err the error of the
+	// call, set once it is sent on Done.
+	Reply interface{}
+	Err   error
+	Done  chan *Call
+
 	id     uint32
 	method string
 	req    interface{}
 	done   chan *Response
 	ctx    context.Context
+	meta   map[string]string
+
+	// progress receives the values reported with Progress, see CallWithProgress
+	progress func(value json.RawMessage)
+
+	// overrides the client's retry policy, see CallBuilder.Retry
+	retry *RetryPolicy
+
+	// set once the call is sent, an interceptor sending it again sends a copy
+	sent bool
+
+	// reported by PendingCalls
+	started  time.Time
+	deadline time.Time
+
+	once    sync.Once
+	release func()
+}
+
+// resend returns a new call of method with the params, meta and progress
+// callback of call, to send call again.
+func (call *Call) resend(method string) *Call {
+	return &Call{
+		method:   method,
+		req:      call.req,
+		meta:     call.meta,
+		done:     make(chan *Response, 1),
+		progress: call.progress,
+	}
+}
+
+// finish delivers the response of the call and frees its in-flight slot. Only the
+// first response is delivered.
+func (call *Call) finish(resp *Response) {
+	call.once.Do(func() {
+		call.done <- resp
+		if call.release != nil {
+			call.release()
+		}
+	})
 }
 
 func (c *Client) recv() {
 	var err error
 
+	// replaced when the client reconnects
+	conn, codec, callbacks := c.conn, c.codec, c.callbacks
+
 	for {
-		var resp *Response
-		err = c.codec.decoder.Decode(&resp)
+		var raw json.RawMessage
+		err = codec.Decode(&raw)
 		if err != nil {
 			break
 		}
 
-		call, ok := c.calls[resp.Id]
-		if !ok {
+		fields := frameFields(raw)
+		if id, value, ok := progressTarget(fields); ok {
+			c.deliverProgress(id, value)
 			continue
 		}
 
-		call.done <- resp
+		if a, ok := announcementOf(fields); ok {
+			c.deliverAnnouncement(a)
+			continue
+		}
+
+		if !isResponse(fields) {
+			go c.serveCallback(callbacks, raw)
+			continue
+		}
+
+		var cr clientResponse
+		if json.Unmarshal(raw, &cr) != nil {
+			continue
+		}
+
+		// this client only sends numeric ids, responses with other ids
+		// can't belong to one of its calls
+		id, parseErr := strconv.ParseUint(string(cr.Id), 10, 32)
+		if parseErr != nil {
+			continue
+		}
 
 		c.m.Lock()
-		delete(c.calls, resp.Id)
+		call, ok := c.calls[uint32(id)]
+		delete(c.calls, uint32(id))
 		c.m.Unlock()
+
+		if !ok {
+			continue
+		}
+
+		call.finish(cr.response())
 	}
 
 	c.reqMutex.Lock()
 	c.m.Lock()
 	c.shutdown = true
-	for _, call := range c.calls {
-		call.done <- &Response{Error: err.Error()}
+	for id, call := range c.calls {
+		call.finish(&Response{Error: err.Error(), err: &connError{err}})
+		delete(c.calls, id)
 	}
+	c.reconnecting = c.reconnect != nil && !c.closing
+	reconnecting := c.reconnecting
 	c.m.Unlock()
 	c.reqMutex.Unlock()
 
+	// the stream can't be resumed after a decoding error
+	_ = conn.Close()
+
+	callbacks.cancel()
+
+	if reconnecting {
+		go c.redial()
+		return
+	}
+
+	close(c.done)
 	return
 }
 
+// connError is the error of the calls pending when the connection of their
+// client is lost.
+type connError struct {
+	err error
+}
+
+func (e *connError) Error() string { return e.err.Error() }
+func (e *connError) Unwrap() error { return e.err }
+
+func uintToString(id uint32) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+func checkMethod(method string) error {
+	if _, _, ok := splitMethod(method); !ok {
+		return fmt.Errorf("invalid method '%s'", method)
+	}
+
+	return nil
+}
+
 func (c *Client) parseCall(method string, in interface{}) (newCall *Call, err error) {
-	parts := strings.Split(method, ".")
-	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
-		err = fmt.Errorf("invalid method '%s'", method)
+	if err = checkMethod(method); err != nil {
 		return
 	}
 
 	newCall = &Call{
-		id:     atomic.AddUint32(&c.seqId, 1),
 		method: method,
 		req:    in,
 		done:   make(chan *Response, 1),
@@ -93,148 +241,394 @@ func (c *Client) parseCall(method string, in interface{}) (newCall *Call, err er
 	return
 }
 
+// SetMaxInFlight caps the number of calls awaiting a response; further calls
+// block until one completes (or, for CallWithTimeout, until the timeout
+// expires). Zero removes the cap. It must be called before the first call.
+func (c *Client) SetMaxInFlight(n int) {
+	c.sem = nil
+	if n > 0 {
+		c.sem = make(chan struct{}, n)
+	}
+}
+
+// acquire takes an in-flight slot for call, waiting at most until ctx is done.
+func (c *Client) acquire(ctx context.Context, call *Call) error {
+	if c.sem == nil {
+		return nil
+	}
+
+	select {
+	case c.sem <- struct{}{}:
+		call.release = func() { <-c.sem }
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func (c *Client) Call(method string, in, out interface{}) (err error) {
 	newCall, err := c.parseCall(method, in)
 	if err != nil {
 		return
 	}
 
-	go c.do(newCall)
+	err = c.call(newCall, out)
+	return
+}
+
+// Go starts calling method without waiting for the response: the returned
+// call is sent on its Done channel once it completes, with its result decoded
+// into out.
+func (c *Client) Go(method string, in, out interface{}) *Call {
+	newCall, err := c.parseCall(method, in)
+	if err != nil {
+		newCall = &Call{method: method, req: in}
+	}
 
-	resp := <-newCall.done
+	newCall.Reply = out
+	newCall.Done = make(chan *Call, 1)
 
-	if resp.Error != "" {
-		err = errors.New(resp.Error)
-		return
+	if err != nil {
+		newCall.Err = err
+		newCall.Done <- newCall
+		return newCall
 	}
 
-	if out == nil {
-		return
+	go func() {
+		newCall.Err = c.call(newCall, out)
+		newCall.Done <- newCall
+	}()
+
+	return newCall
+}
+
+// call runs newCall and waits for its response, decoded into out.
+func (c *Client) call(newCall *Call, out interface{}) (err error) {
+	return c.callContext(context.Background(), newCall, out)
+}
+
+// callContext is like call, giving up on the call and asking the server to
+// cancel it when ctx is done.
+func (c *Client) callContext(ctx context.Context, newCall *Call, out interface{}) (err error) {
+	if _, ok := ctx.Deadline(); !ok && c.callTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.callTimeout)
+		defer cancel()
+
+		defer func() {
+			if errors.Is(err, context.DeadlineExceeded) {
+				err = ErrTimeout
+			}
+		}()
 	}
 
-	// parse resp.Result to out
-	if err = json.Unmarshal(resp.Result, out); err != nil {
+	resp, err := c.invoke(ctx, newCall)
+	if err != nil || out == nil {
 		return
 	}
 
+	err = c.scalars.unmarshal(resp.Result, out)
 	return
 }
 
-func (c *Client) CallWithTimeout(method string, in, out interface{}, timeout time.Duration) (err error) {
+// CallContext is like Call, giving up when ctx is done: the call is then
+// forgotten, the server asked to cancel it and ctx.Err() returned.
+func (c *Client) CallContext(ctx context.Context, method string, in, out interface{}) (err error) {
 	newCall, err := c.parseCall(method, in)
 	if err != nil {
 		return
 	}
 
-	go c.do(newCall)
+	err = c.callContext(ctx, newCall, out)
+	return
+}
+
+func (c *Client) CallWithTimeout(method string, in, out interface{}, timeout time.Duration) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
-	select {
-	case <-time.After(timeout):
+	err = c.CallContext(ctx, method, in, out)
+	if errors.Is(err, context.DeadlineExceeded) {
 		err = ErrTimeout
-		return
-	case resp := <-newCall.done:
-		if resp.Error != "" {
-			err = errors.New(resp.Error)
+	}
+	return
+}
+
+// invoke sends newCall through the client's interceptors and returns its
+// response, failing with the error the response carries if any. Failed calls
+// are retried as the call's or the client's retry policy says.
+func (c *Client) invoke(ctx context.Context, newCall *Call) (*Response, error) {
+	newCall.meta = c.withContextMeta(ctx, newCall.meta)
+
+	retry := c.retry
+	if newCall.retry != nil {
+		retry = newCall.retry
+	}
+
+	if retry == nil {
+		return c.invokeOnce(ctx, newCall)
+	}
+
+	return retry.do(ctx, func() (*Response, error) {
+		return c.invokeOnce(ctx, newCall)
+	})
+}
+
+func (c *Client) invokeOnce(ctx context.Context, newCall *Call) (resp *Response, err error) {
+	if c.breaker != nil {
+		var done func(err error)
+		if done, err = c.breaker.allow(); err != nil {
 			return
 		}
+		defer func() { done(err) }()
+	}
 
-		if out == nil {
-			return
+	if len(c.interceptors) == 0 {
+		call := newCall
+		if call.sent {
+			call = newCall.resend(newCall.method)
 		}
+		return c.roundTrip(ctx, call)
+	}
 
-		// parse resp.Result to out
-		if err = json.Unmarshal(resp.Result, out); err != nil {
-			return
+	send := func(ctx context.Context, out *OutgoingCall) (*Response, error) {
+		call := newCall
+		if out.Method != call.method || call.sent {
+			if err := checkMethod(out.Method); err != nil {
+				return nil, err
+			}
+			call = newCall.resend(out.Method)
 		}
+		call.req, call.meta = out.Params, out.Meta
+
+		return c.roundTrip(ctx, call)
 	}
 
-	return
+	return chainClient(send, c.interceptors)(ctx, &OutgoingCall{
+		Method: newCall.method,
+		Params: newCall.req,
+		Meta:   newCall.meta,
+	})
 }
 
-func (c *Client) do(call *Call) {
-	c.m.Lock()
-	closing, shutdown := c.closing, c.shutdown
-	if closing || shutdown {
-		c.m.Unlock()
-		call.done <- &Response{Error: ErrClientClosed.Error()}
+// roundTrip sends call and waits for its response. When ctx is done first,
+// the call is abandoned and the server asked to cancel it.
+func (c *Client) roundTrip(ctx context.Context, call *Call) (resp *Response, err error) {
+	call.sent = true
+
+	if err = c.acquire(ctx, call); err != nil {
 		return
 	}
 
+	call.started = time.Now()
+	call.deadline, _ = ctx.Deadline()
+
+	if err = c.register(call); err != nil {
+		call.finish(&Response{Error: err.Error(), err: err})
+		return nil, err
+	}
+
+	go c.do(call)
+
+	select {
+	case <-ctx.Done():
+		c.abandon(call)
+		go c.cancelRemote(call.id)
+		return nil, ctx.Err()
+	case resp = <-call.done:
+		return resp, resp.error()
+	}
+}
+
+// register gives call an id and records it as pending. Ids wrap around after
+// 2^32 calls, skipping those of the calls still pending, so that a long-lived
+// client never sends two pending calls with one id.
+func (c *Client) register(call *Call) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.closing || c.shutdown {
+		if c.reconnecting && !c.closing {
+			return ErrNoConnection
+		}
+		return ErrClientClosed
+	}
+
+	for {
+		c.seqId++
+		if _, pending := c.calls[c.seqId]; !pending {
+			break
+		}
+	}
+
+	call.id = c.seqId
 	c.calls[call.id] = call
-	c.m.Unlock()
+	return nil
+}
 
+// do sends call, registered as pending.
+func (c *Client) do(call *Call) {
 	err := c.send(call)
 	if err != nil {
-		c.m.Lock()
-		delete(c.calls, call.id)
-		c.m.Unlock()
-		call.done <- &Response{Error: err.Error()}
+		c.forget(call)
+		call.finish(&Response{Error: err.Error()})
 		return
 	}
 
 	return
 }
 
+// forget removes call from the pending calls, unless its id was already
+// reused.
+func (c *Client) forget(call *Call) {
+	c.m.Lock()
+	if c.calls[call.id] == call {
+		delete(c.calls, call.id)
+	}
+	c.m.Unlock()
+}
+
+// abandon forgets a call whose caller stopped waiting, freeing its slot.
+func (c *Client) abandon(call *Call) {
+	c.forget(call)
+
+	call.finish(&Response{Error: ErrTimeout.Error()})
+}
+
 func (c *Client) send(call *Call) (err error) {
-	c.reqMutex.Lock()
-	body, _ := json.Marshal(call.req)
 	req := &Request{
-		Id:     call.id,
+		Id:     json.RawMessage(uintToString(call.id)),
 		Method: call.method,
-		Param:  body,
+		Meta:   call.meta,
 	}
 
-	err = c.codec.encoder.Encode(req)
-	c.reqMutex.Unlock()
+	err = c.write(req, call.req)
 	return
 }
 
-func (c *Client) Close() {
+// write encodes req with in as its params.
+func (c *Client) write(req *Request, in interface{}) (err error) {
+	c.reqMutex.Lock()
+	defer c.reqMutex.Unlock()
 
-	c.m.Lock()
-	if c.shutdown || c.closing {
-		c.m.Unlock()
+	if in, err = c.scalars.encode(in); err != nil {
 		return
 	}
 
-	_ = c.conn.Close()
-	c.m.Unlock()
+	// signatures cover the JSON of the params
+	if c.signer != nil {
+		if req.Param, err = c.protocol.marshalParams(in); err != nil {
+			return
+		}
+		if err = sign(c.protocol, req, c.signer); err != nil {
+			return
+		}
+	} else if err = c.protocol.setParams(req, c.codec, in); err != nil {
+		return
+	}
+
+	err = c.codec.Encode(c.protocol.wireRequest(req))
 	return
 }
 
-func DialWithTimeout(addr string, timeout time.Duration) (c *Client, err error) {
-	dialer := &net.Dialer{
-		Timeout: timeout,
+// Notify sends a notification: the server runs the method but sends no
+// response, so Notify returns as soon as the request is written.
+func (c *Client) Notify(method string, in interface{}) (err error) {
+	if err = checkMethod(method); err != nil {
+		return
 	}
-	conn, err := dialer.Dial("tcp", addr)
-	if err != nil {
+
+	if c.isShutdown() {
+		err = ErrClientClosed
 		return
 	}
 
-	c = &Client{
-		addr:  addr,
-		calls: make(map[uint32]*Call),
-		conn:  conn,
-		codec: NewCodec(conn),
+	req := &Request{
+		Method:       method,
+		notification: true,
 	}
 
-	go c.recv()
+	err = c.write(req, in)
 	return
 }
 
-func Dial(addr string) (c *Client, err error) {
-	conn, err := net.Dial("tcp", addr)
-	if err != nil {
+// SetProtocol selects the envelope format used for requests; it must be called
+// before the first call. Responses are understood in every format.
+func (c *Client) SetProtocol(p Protocol) {
+	c.reqMutex.Lock()
+	c.protocol = p
+	c.reqMutex.Unlock()
+}
+
+// SetScalars overrides how values of some types are encoded in params and
+// decoded from results, and in the callback services of the client. It must
+// be called before the first call.
+func (c *Client) SetScalars(s *Scalars) {
+	c.reqMutex.Lock()
+	c.scalars = s
+	c.callbacks.s.Scalars = s
+	c.reqMutex.Unlock()
+}
+
+func (c *Client) isShutdown() bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.closing || c.shutdown
+}
+
+// Close closes the connection of the client, that of a shared client once
+// every holder closed it, see Registry.
+func (c *Client) Close() {
+	if c.shared != nil && !c.shared.release() {
 		return
 	}
+	c.close()
+}
 
-	c = &Client{
-		addr:  addr,
-		calls: make(map[uint32]*Call),
-		conn:  conn,
-		codec: NewCodec(conn),
+func (c *Client) close() {
+	c.m.Lock()
+	if c.closing {
+		c.m.Unlock()
+		return
 	}
 
-	go c.recv()
+	c.closing = true
+	_ = c.conn.Close()
+	c.m.Unlock()
 	return
 }
+
+func newClient(addr string, conn net.Conn, codec CodecFactory) *Client {
+	if codec == nil {
+		codec = NewCodec
+	}
+
+	c := &Client{
+		addr:      addr,
+		calls:     make(map[uint32]*Call),
+		conn:      conn,
+		codec:     codec(conn),
+		newCodec:  codec,
+		callbacks: newConnection(&Server{}, conn),
+		done:      make(chan struct{}),
+
+		connectedAt: time.Now(),
+	}
+	c.callbacks.client = c
+
+	go c.recv()
+	return c
+}
+
+// DialWithTimeout is DialContext giving up on connecting after timeout.
+func DialWithTimeout(addr string, timeout time.Duration) (c *Client, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return DialContext(ctx, addr)
+}
+
+// Dial is DialContext without options.
+func Dial(addr string) (c *Client, err error) {
+	return DialContext(context.Background(), addr)
+}
@@ -0,0 +1,79 @@
+package jsonrpc
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRegisterWrapsAroundPendingIds(t *testing.T) {
+	_, c := NewLocalPair(NewServer(""))
+	defer c.Close()
+
+	// a client that has made close to 2^32 calls, some of them still pending
+	pending := []uint32{math.MaxUint32, 0, 2}
+
+	c.m.Lock()
+	c.seqId = math.MaxUint32 - 2
+	for _, id := range pending {
+		c.calls[id] = &Call{id: id}
+	}
+	c.m.Unlock()
+
+	want := []uint32{math.MaxUint32 - 1, 1, 3, 4}
+	for i, id := range want {
+		call := &Call{}
+		if err := c.register(call); err != nil {
+			t.Fatal(err)
+		}
+
+		if call.id != id {
+			t.Errorf("call %d got id %d, want %d", i, call.id, id)
+		}
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	for _, id := range pending {
+		if c.calls[id].id != id {
+			t.Errorf("pending call %d was replaced", id)
+		}
+	}
+}
+
+func TestCallsAcrossIdWraparound(t *testing.T) {
+	s := NewServer("")
+	if err := s.RegisterFunc("Echo.Int", func(in int) (int, error) { return in, nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	_, c := NewLocalPair(s)
+	defer c.Close()
+
+	c.m.Lock()
+	c.seqId = math.MaxUint32 - 3
+	c.calls[math.MaxUint32-1] = &Call{id: math.MaxUint32 - 1}
+	c.m.Unlock()
+
+	for i := 0; i < 8; i++ {
+		var out int
+		if err := c.Call("Echo.Int", i, &out); err != nil {
+			t.Fatal(err)
+		}
+		if out != i {
+			t.Errorf("Echo.Int(%d) = %d", i, out)
+		}
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	// MaxUint32-2, MaxUint32, then 0 to 5
+	if c.seqId != 5 {
+		t.Errorf("last id %d, want 5", c.seqId)
+	}
+
+	if _, ok := c.calls[math.MaxUint32-1]; !ok {
+		t.Error("pending call was forgotten")
+	}
+}
@@ -0,0 +1,88 @@
+// Command jsonrpc-codegen generates client artifacts for the services of a
+// running server from its rpc.discover description: a TypeScript client or the
+// JSON Schema definitions of the params and results. Given an OpenRPC document
+// instead, it generates Go code calling or implementing the API it describes.
+//
+//	jsonrpc-codegen -addr host:port [-lang ts|jsonschema] [-o file]
+//	jsonrpc-codegen -openrpc file [-package name] [-o file]
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+
+	"github.com/grearter/jsonrpc"
+)
+
+func main() {
+	addr := flag.String("addr", "", "address of the server to describe")
+	lang := flag.String("lang", "ts", "artifact to generate: ts or jsonschema")
+	openRPC := flag.String("openrpc", "", "OpenRPC document to generate Go code from, instead of a server")
+	pkg := flag.String("package", "api", "package of the Go code generated from -openrpc")
+	output := flag.String("o", "", "file to write; standard output if empty")
+	flag.Parse()
+
+	if *addr == "" && *openRPC == "" {
+		log.Fatal("-addr or -openrpc is required")
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if *openRPC != "" {
+		if err := generateGo(w, *openRPC, *pkg); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	c, err := jsonrpc.Dial(*addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+
+	var d jsonrpc.Discovery
+	if err = c.Call("rpc.discover", nil, &d); err != nil {
+		log.Fatal(err)
+	}
+
+	switch *lang {
+	case "ts":
+		err = d.WriteTypeScript(w)
+	case "jsonschema":
+		err = d.WriteJSONSchema(w)
+	default:
+		log.Fatalf("unknown -lang %q", *lang)
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// generateGo writes the Go code of package pkg for the OpenRPC document in the
+// file named path.
+func generateGo(w io.Writer, path, pkg string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	doc, err := jsonrpc.ReadOpenRPC(f)
+	if err != nil {
+		return err
+	}
+
+	return doc.WriteGo(w, pkg)
+}
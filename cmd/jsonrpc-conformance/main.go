@@ -0,0 +1,63 @@
+// Command jsonrpc-conformance runs the conformance fixtures against a JSON-RPC
+// 2.0 server exposing the Reference service, or against this package when no
+// address is given.
+//
+//	jsonrpc-conformance [-addr host:port] [-timeout 2s]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"time"
+
+	"github.com/grearter/jsonrpc"
+	"github.com/grearter/jsonrpc/conformance"
+)
+
+func main() {
+	addr := flag.String("addr", "", "address of the server under test; an in-process server is started if empty")
+	timeout := flag.Duration("timeout", 2*time.Second, "time allowed for each response")
+	flag.Parse()
+
+	if *addr == "" {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		s := jsonrpc.NewServer("")
+		s.Listener = l
+		s.Protocol = jsonrpc.ProtocolJSONRPC2
+		s.MustRegister(&conformance.Reference{})
+		go s.Serve()
+
+		*addr = l.Addr().String()
+	}
+
+	fixtures, err := conformance.Fixtures()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	dial := func() (net.Conn, error) {
+		return net.DialTimeout("tcp", *addr, *timeout)
+	}
+
+	failed := 0
+	for _, result := range conformance.Run(dial, fixtures, *timeout) {
+		if result.Err != nil {
+			failed++
+			fmt.Printf("FAIL %s: %v\n", result.Fixture.Name, result.Err)
+			continue
+		}
+		fmt.Printf("ok   %s\n", result.Fixture.Name)
+	}
+
+	if failed > 0 {
+		fmt.Printf("%d of %d fixtures failed\n", failed, len(fixtures))
+		os.Exit(1)
+	}
+}
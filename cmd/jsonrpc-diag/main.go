@@ -0,0 +1,71 @@
+// Command jsonrpc-diag checks a deployed server with Diagnostics enabled: it
+// measures round trips with rpc.echo, then finds the largest result that gets
+// through with rpc.payload, doubling the size from -min up to -max.
+//
+//	jsonrpc-diag -addr host:port [-n 10] [-min 1024] [-max 10485760]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/grearter/jsonrpc"
+)
+
+func main() {
+	addr := flag.String("addr", "", "address of the server to check")
+	n := flag.Int("n", 10, "number of round trips to measure")
+	min := flag.Int("min", 1<<10, "first payload size tried, in bytes")
+	max := flag.Int("max", 10<<20, "last payload size tried, in bytes")
+	flag.Parse()
+
+	if *addr == "" {
+		log.Fatal("-addr is required")
+	}
+
+	c, err := jsonrpc.Dial(*addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, err = c.Negotiate(); err != nil {
+		log.Fatalf("rpc.info: %v", err)
+	}
+
+	var fastest, slowest, total time.Duration
+	for i := 0; i < *n; i++ {
+		start := time.Now()
+		var echoed []int
+		if err = c.Call("rpc.echo", []int{i}, &echoed); err != nil {
+			log.Fatalf("rpc.echo: %v (is Diagnostics enabled?)", err)
+		}
+
+		rtt := time.Since(start)
+		total += rtt
+		if i == 0 || rtt < fastest {
+			fastest = rtt
+		}
+		if rtt > slowest {
+			slowest = rtt
+		}
+	}
+
+	if *n > 0 {
+		fmt.Printf("round trip: min %s, avg %s, max %s over %d calls\n", fastest, total/time.Duration(*n), slowest, *n)
+	}
+
+	largest := 0
+	for size := *min; size > 0 && size <= *max; size *= 2 {
+		var payload string
+		if err = c.Call("rpc.payload", map[string]int{"size": size}, &payload); err != nil || len(payload) != size {
+			fmt.Printf("payload of %d bytes failed: %v\n", size, err)
+			break
+		}
+		largest = size
+	}
+
+	fmt.Printf("largest payload: %d bytes\n", largest)
+}
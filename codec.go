@@ -2,18 +2,84 @@ package jsonrpc
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net"
+	"sync/atomic"
 )
 
-type Codec struct {
+// Codec reads and writes the frames of a connection in a wire format. The
+// frames are JSON-RPC messages: Encode is given values encoding/json marshals
+// to one, Decode is given a *json.RawMessage to fill with the next one.
+// Codecs of other formats translate between the JSON form and theirs. Encode
+// and Decode may run concurrently with each other, each one is never called
+// concurrently with itself.
+//
+// Decode reports malformed frames with a *json.SyntaxError or an error
+// wrapping ErrMalformedFrame, which are answered with a parse error.
+type Codec interface {
+	Encode(frame interface{}) error
+	Decode(frame interface{}) error
+}
+
+// CodecFactory returns the codec of a new connection, see Server.Codec and
+// WithCodec.
+type CodecFactory func(conn net.Conn) Codec
+
+// ChecksumCodec is implemented by codecs that can add a CRC32 to the frames
+// they encode and require a valid one on those they decode, see
+// Server.Checksum.
+type ChecksumCodec interface {
+	Codec
+	SetChecksum(on bool)
+	Checksum() bool
+}
+
+// ErrMalformedFrame is wrapped by the errors of codecs reading a frame that
+// isn't valid in their wire format.
+var ErrMalformedFrame = errors.New("malformed frame")
+
+// NewCodec returns the default codec, reading and writing newline-delimited
+// JSON on conn.
+func NewCodec(conn net.Conn) Codec {
+	return NewJSONCodec(conn)
+}
+
+// codecName returns the name of the wire format of codec, reported by
+// rpc.info. Connections without a codec, such as those of HTTP requests, use
+// JSON.
+func codecName(codec Codec) string {
+	switch codec.(type) {
+	case nil, *JSONCodec:
+		return "json"
+	case *MessagePackCodec:
+		return "msgpack"
+	case *CBORCodec:
+		return "cbor"
+	}
+	return fmt.Sprintf("%T", codec)
+}
+
+func (s *Server) codec() CodecFactory {
+	if s.Codec != nil {
+		return s.Codec
+	}
+	return NewCodec
+}
+
+// JSONCodec reads and writes newline-delimited JSON.
+type JSONCodec struct {
 	Conn    net.Conn
 	encoder *json.Encoder
 	decoder *json.Decoder
+
+	// checksum is set when frames carry a CRC32, see SetChecksum
+	checksum int32
 }
 
-func NewCodec(conn net.Conn) *Codec {
-	return &Codec{
+func NewJSONCodec(conn net.Conn) *JSONCodec {
+	return &JSONCodec{
 		Conn:    conn,
 		encoder: json.NewEncoder(conn.(io.Writer)),
 		decoder: json.NewDecoder(conn.(io.Reader)),
@@ -21,10 +87,83 @@ func NewCodec(conn net.Conn) *Codec {
 
 }
 
-func (codec *Codec) Encode(input interface{}) error {
-	return codec.encoder.Encode(input)
+// SetChecksum makes the codec append a CRC32 to the frames it encodes and
+// require a valid one on the frames it decodes.
+func (codec *JSONCodec) SetChecksum(on bool) {
+	var v int32
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32(&codec.checksum, v)
+}
+
+// Checksum reports whether frames carry a CRC32.
+func (codec *JSONCodec) Checksum() bool {
+	return atomic.LoadInt32(&codec.checksum) == 1
+}
+
+func (codec *JSONCodec) Encode(input interface{}) error {
+	if !codec.Checksum() {
+		return codec.encoder.Encode(input)
+	}
+
+	frame, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+
+	frame, err = appendChecksum(frame)
+	if err != nil {
+		return err
+	}
+
+	_, err = codec.Conn.Write(append(frame, '\n'))
+	return err
+}
+
+func (codec *JSONCodec) Decode(output interface{}) error {
+	if !codec.Checksum() {
+		return codec.decoder.Decode(output)
+	}
+
+	var raw json.RawMessage
+	if err := codec.decoder.Decode(&raw); err != nil {
+		return err
+	}
+
+	frame, err := verifyChecksum(raw)
+	if err != nil {
+		return err
+	}
+
+	if out, ok := output.(*json.RawMessage); ok {
+		*out = frame
+		return nil
+	}
+	return json.Unmarshal(frame, output)
+}
+
+// setChecksum turns the checksums of codec on or off, reporting false if it
+// can't carry them.
+func setChecksum(codec Codec, on bool) bool {
+	cc, ok := codec.(ChecksumCodec)
+	if !ok {
+		return !on
+	}
+
+	cc.SetChecksum(on)
+	return true
+}
+
+// checksumOn reports whether the frames of codec carry a CRC32.
+func checksumOn(codec Codec) bool {
+	cc, ok := codec.(ChecksumCodec)
+	return ok && cc.Checksum()
 }
 
-func (codec *Codec) Decode(output interface{}) error {
-	return codec.decoder.Decode(output)
+// malformedFrame reports whether err is a codec's error reading a malformed
+// frame.
+func malformedFrame(err error) bool {
+	var syntaxErr *json.SyntaxError
+	return errors.As(err, &syntaxErr) || errors.Is(err, ErrMalformedFrame)
 }
@@ -0,0 +1,210 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// codegenHeader starts the generated files.
+const codegenHeader = "Code generated from rpc.discover. DO NOT EDIT."
+
+// definitions returns the named object types used by the methods of d, by
+// title. Distinct types sharing a name are described by the first one found.
+func (d *Discovery) definitions() map[string]*Schema {
+	defs := make(map[string]*Schema)
+
+	var collect func(schema *Schema)
+	collect = func(schema *Schema) {
+		if schema == nil {
+			return
+		}
+
+		if schema.Type == "object" && schema.Title != "" && schema.Properties != nil {
+			if _, ok := defs[schema.Title]; ok {
+				return
+			}
+			defs[schema.Title] = schema
+		}
+
+		for _, name := range sortedProperties(schema) {
+			collect(schema.Properties[name])
+		}
+		collect(schema.Items)
+		collect(schema.AdditionalProperties)
+	}
+
+	for _, svc := range d.Services {
+		for _, m := range svc.Methods {
+			collect(m.Params)
+			collect(m.Result)
+		}
+	}
+
+	return defs
+}
+
+func sortedProperties(schema *Schema) []string {
+	names := make([]string, 0, len(schema.Properties))
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// typeDefinitions is the document written by WriteJSONSchema.
+type typeDefinitions struct {
+	Comment     string                       `json:"$comment"`
+	Definitions map[string]*Schema           `json:"definitions"`
+	Methods     map[string]MethodDescription `json:"methods"`
+}
+
+// WriteJSONSchema writes the named types used by the methods of d as JSON
+// Schema definitions, along with the params and result of every method by
+// "Service.Method" name.
+func (d *Discovery) WriteJSONSchema(w io.Writer) error {
+	doc := &typeDefinitions{
+		Comment:     codegenHeader,
+		Definitions: d.definitions(),
+		Methods:     make(map[string]MethodDescription),
+	}
+
+	for _, svc := range d.Services {
+		for _, m := range svc.Methods {
+			doc.Methods[svc.Name+"."+m.Name] = m
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(doc)
+}
+
+// WriteTypeScript writes a TypeScript module with an interface per named type
+// used by the methods of d and a client class per service. The clients send
+// their calls through a function given to their constructor, leaving the
+// transport to the application:
+//
+//	const arith = new ArithClient((method, params) => rpc.call(method, params));
+//	const product = await arith.Multiply({A: 6, B: 7});
+func (d *Discovery) WriteTypeScript(w io.Writer) error {
+	out := bufio.NewWriter(w)
+
+	fmt.Fprintf(out, "// %s\n\n", codegenHeader)
+	fmt.Fprintf(out, "export type Call = (method: string, params: unknown) => Promise<unknown>;\n")
+
+	defs := d.definitions()
+	names := make([]string, 0, len(defs))
+	for name := range defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(out, "\nexport interface %s ", name)
+		writeTSObject(out, defs[name], "")
+		fmt.Fprintf(out, "\n")
+	}
+
+	for _, svc := range d.Services {
+		fmt.Fprintf(out, "\nexport class %sClient {\n", tsClassName(svc.Name))
+		fmt.Fprintf(out, "  constructor(private readonly call: Call) {}\n")
+
+		for _, m := range svc.Methods {
+			params := "params"
+			if !structuredParams(m.Params) {
+				params = "[params]"
+			}
+
+			result := tsType(m.Result, "  ")
+			fmt.Fprintf(out, "\n  %s(params: %s): Promise<%s> {\n", m.Name, tsType(m.Params, "  "), result)
+			fmt.Fprintf(out, "    return this.call(%s, %s) as Promise<%s>;\n", strconv.Quote(svc.Name+"."+m.Name), params, result)
+			fmt.Fprintf(out, "  }\n")
+		}
+
+		fmt.Fprintf(out, "}\n")
+	}
+
+	return out.Flush()
+}
+
+// structuredParams reports whether values of schema are sent as params as
+// they are; other values are sent as the single positional param.
+func structuredParams(schema *Schema) bool {
+	return schema.Type == "object" || schema.Type == "array"
+}
+
+// tsType returns the TypeScript type of schema, indent being the indentation
+// of the line it appears on.
+func tsType(schema *Schema, indent string) (t string) {
+	switch schema.Type {
+	case "boolean":
+		t = "boolean"
+	case "integer", "number":
+		t = "number"
+	case "string":
+		t = "string"
+	case "array":
+		t = tsType(schema.Items, indent)
+		if strings.ContainsAny(t, " |") {
+			t = "(" + t + ")"
+		}
+		t += "[]"
+	case "object":
+		switch {
+		case schema.Title != "":
+			t = schema.Title
+		case schema.AdditionalProperties != nil:
+			t = "Record<string, " + tsType(schema.AdditionalProperties, indent) + ">"
+		default:
+			var b strings.Builder
+			writeTSObject(&b, schema, indent)
+			t = b.String()
+		}
+	default:
+		t = "unknown"
+	}
+
+	if schema.Nullable && t != "unknown" {
+		t += " | null"
+	}
+	return
+}
+
+func writeTSObject(w io.Writer, schema *Schema, indent string) {
+	fmt.Fprintf(w, "{\n")
+	for _, name := range sortedProperties(schema) {
+		fmt.Fprintf(w, "%s  %s: %s;\n", indent, tsPropertyName(name), tsType(schema.Properties[name], indent+"  "))
+	}
+	fmt.Fprintf(w, "%s}", indent)
+}
+
+// tsClassName returns the service name without its dots, the part after each
+// one capitalized: billing.v2 becomes billingV2.
+func tsClassName(serviceName string) string {
+	parts := strings.Split(serviceName, ".")
+	for i := 1; i < len(parts); i++ {
+		parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+	}
+
+	return strings.Join(parts, "")
+}
+
+// tsPropertyName quotes name unless it is a valid identifier.
+func tsPropertyName(name string) string {
+	for i, r := range name {
+		if !(r == '_' || r == '$' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || i > 0 && r >= '0' && r <= '9') {
+			return strconv.Quote(name)
+		}
+	}
+
+	if name == "" {
+		return `""`
+	}
+	return name
+}
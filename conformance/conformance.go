@@ -0,0 +1,250 @@
+// Package conformance holds JSON-RPC 2.0 request/response fixtures and a driver
+// running them against a server over a raw connection, so that
+// implementations in any language can check they behave like this one.
+//
+// The fixtures live in fixtures.json. They call a Reference service the server
+// under test must expose:
+//
+//	Reference.Subtract(minuend, subtrahend int) int  // also {"minuend", "subtrahend"}
+//	Reference.Echo(params) params                    // returns its params unchanged
+//	Reference.Fail({"code", "message"})              // fails with that error
+//
+// Each fixture is sent on a fresh connection. Members absent from an expected
+// response aren't checked, and the responses to a batch may come in any order.
+package conformance
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"time"
+)
+
+//go:embed fixtures.json
+var fixturesJSON []byte
+
+// Fixture is a request and the response expected for it.
+type Fixture struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+
+	// Request is the frame sent, or RequestText when it isn't valid JSON.
+	Request     json.RawMessage `json:"request,omitempty"`
+	RequestText string          `json:"requestText,omitempty"`
+
+	// Response is the expected response; none is expected when it is empty.
+	Response json.RawMessage `json:"response,omitempty"`
+}
+
+// Result is the outcome of a fixture, Err is nil when it passed.
+type Result struct {
+	Fixture *Fixture
+	Err     error
+}
+
+// sentinel is sent after fixtures expecting no response: its response must be
+// the first one received.
+const sentinel = `{"jsonrpc": "2.0", "method": "Reference.Echo", "params": ["sentinel"], "id": "conformance-sentinel"}`
+
+// Fixtures returns the published fixtures.
+func Fixtures() ([]Fixture, error) {
+	var fixtures []Fixture
+	if err := json.Unmarshal(fixturesJSON, &fixtures); err != nil {
+		return nil, err
+	}
+
+	return fixtures, nil
+}
+
+// Run runs fixtures, each on a connection returned by dial, waiting at most
+// timeout for each response.
+func Run(dial func() (net.Conn, error), fixtures []Fixture, timeout time.Duration) (results []Result) {
+	for i := range fixtures {
+		f := &fixtures[i]
+
+		conn, err := dial()
+		if err == nil {
+			err = f.Check(conn, timeout)
+			_ = conn.Close()
+		}
+
+		results = append(results, Result{Fixture: f, Err: err})
+	}
+
+	return
+}
+
+// Check sends the fixture's request on conn and checks the response.
+func (f *Fixture) Check(conn net.Conn, timeout time.Duration) (err error) {
+	request := []byte(f.RequestText)
+	if len(f.Request) > 0 {
+		request = f.Request
+	}
+
+	if err = conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return
+	}
+
+	if _, err = conn.Write(append(request, '\n')); err != nil {
+		return
+	}
+
+	decoder := json.NewDecoder(conn)
+	decoder.UseNumber()
+
+	if len(f.Response) == 0 {
+		if _, err = io.WriteString(conn, sentinel+"\n"); err != nil {
+			return
+		}
+		return expect(decoder, json.RawMessage(`{"jsonrpc": "2.0", "result": ["sentinel"], "id": "conformance-sentinel"}`))
+	}
+
+	return expect(decoder, f.Response)
+}
+
+// expect reads the next frame from decoder and matches it against want.
+func expect(decoder *json.Decoder, want json.RawMessage) error {
+	var got interface{}
+	if err := decoder.Decode(&got); err != nil {
+		return fmt.Errorf("reading response: %v", err)
+	}
+
+	var expected interface{}
+	if err := unmarshal(want, &expected); err != nil {
+		return fmt.Errorf("invalid fixture: %v", err)
+	}
+
+	if err := match(expected, got); err != nil {
+		gotJSON, _ := json.Marshal(got)
+		return fmt.Errorf("%v, got %s", err, gotJSON)
+	}
+
+	return nil
+}
+
+// match checks the response got against expected: a response or a batch of
+// responses in any order.
+func match(expected, got interface{}) error {
+	want, isBatch := expected.([]interface{})
+	if !isBatch {
+		if err := validResponse(got); err != nil {
+			return err
+		}
+		return subset("response", expected, got)
+	}
+
+	responses, ok := got.([]interface{})
+	if !ok {
+		return errors.New("expected a batch response")
+	}
+
+	if len(responses) != len(want) {
+		return fmt.Errorf("expected %d responses, got %d", len(want), len(responses))
+	}
+
+	used := make([]bool, len(responses))
+	for _, w := range want {
+		found := false
+		for i, resp := range responses {
+			if !used[i] && validResponse(resp) == nil && subset("response", w, resp) == nil {
+				used[i], found = true, true
+				break
+			}
+		}
+
+		if !found {
+			wantJSON, _ := json.Marshal(w)
+			return fmt.Errorf("no response matches %s", wantJSON)
+		}
+	}
+
+	return nil
+}
+
+// validResponse checks the members every JSON-RPC 2.0 response must have.
+func validResponse(got interface{}) error {
+	resp, ok := got.(map[string]interface{})
+	if !ok {
+		return errors.New("response is not an object")
+	}
+
+	if resp["jsonrpc"] != "2.0" {
+		return errors.New(`response member "jsonrpc" must be "2.0"`)
+	}
+
+	if _, ok := resp["id"]; !ok {
+		return errors.New(`response lacks the "id" member`)
+	}
+
+	_, hasResult := resp["result"]
+	_, hasError := resp["error"]
+	if hasResult == hasError {
+		return errors.New(`response must have exactly one of "result" and "error"`)
+	}
+
+	return nil
+}
+
+// subset checks that every member of expected is in got with the same value.
+// Arrays must match element by element.
+func subset(path string, expected, got interface{}) error {
+	switch e := expected.(type) {
+	case map[string]interface{}:
+		g, ok := got.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected an object", path)
+		}
+
+		for name, value := range e {
+			member, ok := g[name]
+			if !ok {
+				return fmt.Errorf("%s: missing member %q", path, name)
+			}
+			if err := subset(path+"."+name, value, member); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []interface{}:
+		g, ok := got.([]interface{})
+		if !ok || len(g) != len(e) {
+			return fmt.Errorf("%s: expected an array of %d elements", path, len(e))
+		}
+
+		for i := range e {
+			if err := subset(fmt.Sprintf("%s[%d]", path, i), e[i], g[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// numbers are equal if they have the same value, whatever their spelling
+	if e, ok := expected.(json.Number); ok {
+		if g, ok := got.(json.Number); ok {
+			ef, eErr := e.Float64()
+			gf, gErr := g.Float64()
+			if eErr == nil && gErr == nil && ef == gf {
+				return nil
+			}
+		}
+	}
+
+	if !reflect.DeepEqual(expected, got) {
+		return fmt.Errorf("%s: expected %v", path, expected)
+	}
+
+	return nil
+}
+
+// unmarshal decodes data keeping numbers as json.Number, like responses.
+func unmarshal(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
@@ -0,0 +1,38 @@
+package conformance
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/grearter/jsonrpc"
+)
+
+func TestFixtures(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := jsonrpc.NewServer("")
+	s.Listener = l
+	s.Protocol = jsonrpc.ProtocolJSONRPC2
+	s.MustRegister(&Reference{})
+	go s.Serve()
+	defer s.Close()
+
+	fixtures, err := Fixtures()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dial := func() (net.Conn, error) {
+		return net.DialTimeout("tcp", l.Addr().String(), 2*time.Second)
+	}
+
+	for _, result := range Run(dial, fixtures, 2*time.Second) {
+		if result.Err != nil {
+			t.Errorf("%s: %v", result.Fixture.Name, result.Err)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package conformance
+
+import (
+	"encoding/json"
+
+	"github.com/grearter/jsonrpc"
+)
+
+// Reference is this package's implementation of the service the fixtures call.
+type Reference struct{}
+
+// SubtractParams are the params of Reference.Subtract.
+type SubtractParams struct {
+	Minuend    int `json:"minuend"`
+	Subtrahend int `json:"subtrahend"`
+}
+
+// Subtract returns minuend - subtrahend.
+func (Reference) Subtract(p SubtractParams, out *int) error {
+	*out = p.Minuend - p.Subtrahend
+	return nil
+}
+
+// Echo returns its params unchanged.
+func (Reference) Echo(params json.RawMessage, out *json.RawMessage) error {
+	*out = params
+	return nil
+}
+
+// FailParams are the params of Reference.Fail.
+type FailParams struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Fail fails with the given error.
+func (Reference) Fail(p FailParams, out *struct{}) error {
+	return &jsonrpc.Error{Code: p.Code, Message: p.Message}
+}
@@ -0,0 +1,31 @@
+package jsonrpc
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"time"
+)
+
+var typeOfContext = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+type connInfoKey struct{}
+
+// ConnInfo describes the connection a request was received on.
+type ConnInfo struct {
+	RemoteAddr  net.Addr
+	LocalAddr   net.Addr
+	ConnectedAt time.Time
+
+	// Peer is the verified identity of the client, for TLS connections whose
+	// client presented a certificate, see PeerFromContext. In the ConnInfo of
+	// a Client, it is the identity of the server.
+	Peer *PeerIdentity
+}
+
+// ConnInfoFromContext returns the connection info stored in the context passed to
+// context-aware handlers.
+func ConnInfoFromContext(ctx context.Context) (*ConnInfo, bool) {
+	info, ok := ctx.Value(connInfoKey{}).(*ConnInfo)
+	return info, ok
+}
@@ -0,0 +1,60 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// pingMethod is the built-in method a client calls to check that the
+// connection and the server's reader are alive, see Client.Ping.
+const pingMethod = builtinService + ".ping"
+
+// controlQueueSize bounds the control frames waiting to be written on a
+// connection.
+const controlQueueSize = 16
+
+// controlNotifications are the notifications sent on the control channel of a
+// connection.
+var controlNotifications = map[string]bool{
+	cancelMethod:                                  true,
+	builtinService + "." + AnnounceDraining:       true,
+	builtinService + "." + AnnounceServiceRemoved: true,
+}
+
+// The control channel of a connection carries the frames that keep it
+// working: answers to pings, cancellations and drain notices. It has a queue
+// of its own, which the writer empties before taking the next response or
+// notification, so that those frames are never stuck behind large responses.
+// A frame being written is always written whole.
+
+func pingBuiltin(conn *Connection, req *Request) (interface{}, error) {
+	return "pong", nil
+}
+
+// isPing reports whether the members of a frame are those of an rpc.ping
+// request.
+func isPing(fields map[string]json.RawMessage) bool {
+	_, ok := builtinParams(fields, pingMethod)
+	return ok
+}
+
+// servePing answers the rpc.ping request raw on the control channel. It runs
+// on the reader, without taking a request slot, so that pings are answered
+// while every slot is held by running handlers.
+func (conn *Connection) servePing(raw json.RawMessage) {
+	if frame := conn.respond(raw, conn.scalars()); frame != nil {
+		_ = conn.sendOn(conn.control, frame)
+	}
+}
+
+// queued returns the number of frames waiting to be written.
+func (conn *Connection) queued() int {
+	return len(conn.out) + len(conn.control)
+}
+
+// Ping calls the server's rpc.ping, which is answered right away even while
+// the server is busy writing large responses or has every request slot of the
+// connection taken, to check that the connection is alive.
+func (c *Client) Ping(ctx context.Context) error {
+	return c.CallContext(ctx, pingMethod, nil, nil)
+}
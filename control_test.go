@@ -0,0 +1,59 @@
+package jsonrpc
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPingWithEverySlotTaken(t *testing.T) {
+	var running int32
+	release := make(chan struct{})
+
+	s := NewServer("")
+	err := s.RegisterFunc("Slow.Wait", func(ctx context.Context, in int) (int, error) {
+		atomic.AddInt32(&running, 1)
+		<-release
+		return in, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, c := NewLocalPair(s)
+	defer c.Close()
+
+	const calls = maxConcurrentRequests + 6
+
+	var wg sync.WaitGroup
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			if err := c.Call("Slow.Wait", i, nil); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&running) < maxConcurrentRequests {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d handlers running, want %d", atomic.LoadInt32(&running), maxConcurrentRequests)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := c.Ping(ctx); err != nil {
+		t.Errorf("Ping with every slot taken: %v", err)
+	}
+
+	close(release)
+	wg.Wait()
+}
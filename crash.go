@@ -0,0 +1,141 @@
+package jsonrpc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultCrashDumpMax is the number of crash dumps kept when CrashDumpMax is
+// zero.
+const defaultCrashDumpMax = 10
+
+// crashDumpMu serializes the writing and rotation of crash dumps.
+var crashDumpMu sync.Mutex
+
+// CrashRecord is the content of a crash dump, written as JSON.
+type CrashRecord struct {
+	Time   time.Time `json:"time"`
+	Method string    `json:"method"`
+
+	// ParamsSHA256 identifies the params without recording them.
+	ParamsSHA256 string `json:"paramsSHA256"`
+
+	Panic      string `json:"panic"`
+	Stack      string `json:"stack"`
+	Goroutines string `json:"goroutines"`
+}
+
+// call invokes fn, the handler of req, with args. A panic is recovered and
+// reported to the PanicHandler, or logged, and recorded in a crash dump when
+// CrashDumpDir is set; the call fails with an internal error.
+func (s *Server) call(req *Request, fn reflect.Value, args []reflect.Value) (results []reflect.Value, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			s.handlerPanicked(req, v, debug.Stack())
+			err = newError(CodeInternalError, "internal error")
+		}
+	}()
+
+	results = fn.Call(args)
+	return
+}
+
+func (s *Server) handlerPanicked(req *Request, v interface{}, stack []byte) {
+	if s.PanicHandler != nil {
+		s.PanicHandler(req, v, stack)
+	}
+
+	if s.CrashDumpDir != "" {
+		s.writeCrashDump(req, v, stack)
+		return
+	}
+
+	if s.PanicHandler == nil {
+		s.logf("jsonrpc: handler of %s panicked: %v\n%s", req.Method, v, stack)
+	}
+}
+
+// writeCrashDump records the panic v of the handler of req in CrashDumpDir,
+// removing the oldest dumps beyond CrashDumpMax.
+func (s *Server) writeCrashDump(req *Request, v interface{}, stack []byte) {
+	sum := sha256.Sum256(req.Param)
+
+	goroutines := make([]byte, 1<<20)
+	goroutines = goroutines[:runtime.Stack(goroutines, true)]
+
+	record := &CrashRecord{
+		Time:         time.Now(),
+		Method:       req.Method,
+		ParamsSHA256: hex.EncodeToString(sum[:]),
+		Panic:        fmt.Sprint(v),
+		Stack:        string(stack),
+		Goroutines:   string(goroutines),
+	}
+
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		s.logf("jsonrpc: crash dump: %v", err)
+		return
+	}
+
+	crashDumpMu.Lock()
+	defer crashDumpMu.Unlock()
+
+	name := fmt.Sprintf("crash-%d-%s.json", record.Time.UnixNano(), strings.ReplaceAll(req.Method, string(filepath.Separator), "_"))
+	path := filepath.Join(s.CrashDumpDir, name)
+
+	if err = os.MkdirAll(s.CrashDumpDir, 0o755); err == nil {
+		err = os.WriteFile(path, data, 0o600)
+	}
+	if err != nil {
+		s.logf("jsonrpc: crash dump: %v", err)
+		return
+	}
+
+	s.logf("jsonrpc: handler of %s panicked: %v, crash dump written to %s", req.Method, v, path)
+	s.rotateCrashDumps()
+}
+
+func (s *Server) rotateCrashDumps() {
+	max := s.CrashDumpMax
+	if max <= 0 {
+		max = defaultCrashDumpMax
+	}
+
+	dumps, err := filepath.Glob(filepath.Join(s.CrashDumpDir, "crash-*.json"))
+	if err != nil || len(dumps) <= max {
+		return
+	}
+
+	// names start with the time of the crash
+	sort.Strings(dumps)
+	for _, path := range dumps[:len(dumps)-max] {
+		_ = os.Remove(path)
+	}
+}
+
+// ErrCrashOutputUnsupported is returned by CaptureFatalErrors in programs
+// built with a Go release older than 1.23.
+var ErrCrashOutputUnsupported = errors.New("capturing fatal errors requires Go 1.23")
+
+// createFatalErrorFile creates the file in dir that CaptureFatalErrors makes
+// the runtime write the report of fatal errors to.
+func createFatalErrorFile(dir string) (*os.File, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return os.Create(filepath.Join(dir, fmt.Sprintf("fatal-%d.txt", time.Now().UnixNano())))
+}
@@ -0,0 +1,20 @@
+//go:build go1.23
+// +build go1.23
+
+package jsonrpc
+
+import "runtime/debug"
+
+// CaptureFatalErrors makes the runtime write the report of fatal errors, such
+// as unrecovered panics or concurrent map writes, to a file in dir in addition
+// to standard error. It applies to the whole process, and fails with
+// ErrCrashOutputUnsupported in programs built with Go older than 1.23.
+func CaptureFatalErrors(dir string) error {
+	f, err := createFatalErrorFile(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return debug.SetCrashOutput(f, debug.CrashOptions{})
+}
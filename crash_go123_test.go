@@ -0,0 +1,46 @@
+//go:build go1.23
+// +build go1.23
+
+package jsonrpc
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fatalDirEnv makes TestCaptureFatalErrors crash its process, capturing the
+// report in the directory it names.
+const fatalDirEnv = "JSONRPC_TEST_FATAL_DIR"
+
+func TestCaptureFatalErrors(t *testing.T) {
+	if dir := os.Getenv(fatalDirEnv); dir != "" {
+		if err := CaptureFatalErrors(dir); err != nil {
+			t.Fatal(err)
+		}
+		go panic("unrecovered in a goroutine")
+		select {}
+	}
+
+	dir := t.TempDir()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestCaptureFatalErrors$")
+	cmd.Env = append(os.Environ(), fatalDirEnv+"="+dir)
+	if out, err := cmd.CombinedOutput(); err == nil {
+		t.Fatalf("process didn't crash:\n%s", out)
+	}
+
+	reports, err := filepath.Glob(filepath.Join(dir, "fatal-*.txt"))
+	if err != nil || len(reports) != 1 {
+		t.Fatalf("fatal error reports %q, %v", reports, err)
+	}
+
+	report, err := os.ReadFile(reports[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(report), "panic: unrecovered in a goroutine") {
+		t.Errorf("report doesn't hold the panic:\n%s", report)
+	}
+}
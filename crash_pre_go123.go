@@ -0,0 +1,10 @@
+//go:build !go1.23
+// +build !go1.23
+
+package jsonrpc
+
+// CaptureFatalErrors fails with ErrCrashOutputUnsupported: the runtime can only
+// write the report of fatal errors to a file from Go 1.23 on.
+func CaptureFatalErrors(dir string) error {
+	return ErrCrashOutputUnsupported
+}
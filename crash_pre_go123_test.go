@@ -0,0 +1,12 @@
+//go:build !go1.23
+// +build !go1.23
+
+package jsonrpc
+
+import "testing"
+
+func TestCaptureFatalErrors(t *testing.T) {
+	if err := CaptureFatalErrors(t.TempDir()); err != ErrCrashOutputUnsupported {
+		t.Errorf("CaptureFatalErrors returned %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package jsonrpc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newPanicServer returns a server with Crash.Now, which panics with its param,
+// and Crash.Not, which doesn't.
+func newPanicServer(t *testing.T) *Server {
+	s := NewServer("")
+
+	err := s.RegisterFunc("Crash.Now", func(ctx context.Context, in string) (string, error) { panic(in) })
+	if err == nil {
+		err = s.RegisterFunc("Crash.Not", func(ctx context.Context, in string) (string, error) { return in, nil })
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestHandlerPanics(t *testing.T) {
+	s := newPanicServer(t)
+
+	var (
+		m      sync.Mutex
+		panics []string
+		stack  string
+	)
+	s.PanicHandler = func(req *Request, v interface{}, st []byte) {
+		m.Lock()
+		defer m.Unlock()
+		panics = append(panics, req.Method+": "+v.(string))
+		stack = string(st)
+	}
+
+	_, c := NewLocalPair(s)
+	defer c.Close()
+
+	var out string
+	err := c.Call("Crash.Now", "boom", &out)
+
+	if err == nil || err.Error() != "internal error" {
+		t.Fatalf("panicking call failed with %v", err)
+	}
+
+	// the connection is kept
+	if err = c.Call("Crash.Not", "fine", &out); err != nil || out != "fine" {
+		t.Fatalf("call after a panic: %q, %v", out, err)
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	if len(panics) != 1 || panics[0] != "Crash.Now: boom" {
+		t.Errorf("panics %q", panics)
+	}
+	if !strings.Contains(stack, "newPanicServer") {
+		t.Errorf("stack doesn't show the handler:\n%s", stack)
+	}
+}
+
+func TestCrashDumps(t *testing.T) {
+	s := newPanicServer(t)
+	s.CrashDumpDir = filepath.Join(t.TempDir(), "crashes")
+	s.CrashDumpMax = 3
+	s.ErrorLog = log.New(io.Discard, "", 0)
+
+	_, c := NewLocalPair(s)
+	defer c.Close()
+
+	for i := 0; i < 5; i++ {
+		if err := c.Call("Crash.Now", fmt.Sprintf("secret-%d", i), nil); err == nil {
+			t.Fatal("panicking call succeeded")
+		}
+	}
+
+	dumps, err := filepath.Glob(filepath.Join(s.CrashDumpDir, "crash-*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dumps) != 3 {
+		t.Fatalf("%d crash dumps kept", len(dumps))
+	}
+
+	// the most recent dumps are kept
+	sort.Strings(dumps)
+	data, err := os.ReadFile(dumps[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var record CrashRecord
+	if err = json.Unmarshal(data, &record); err != nil {
+		t.Fatal(err)
+	}
+
+	sum := sha256.Sum256([]byte(`"secret-4"`))
+	if record.Method != "Crash.Now" || record.Panic != "secret-4" || record.ParamsSHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("crash record %+v", record)
+	}
+	if !strings.Contains(record.Stack, "newPanicServer") || !strings.Contains(record.Goroutines, "goroutine ") {
+		t.Errorf("crash record without stacks: %s", data)
+	}
+
+	// params are only recorded as a hash, the panic value is what it is
+	if n := strings.Count(string(data), "secret-4"); n != 1 {
+		t.Errorf("params recorded in the crash dump:\n%s", data)
+	}
+}
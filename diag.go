@@ -0,0 +1,79 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"time"
+)
+
+// Bounds of the diagnostic methods.
+const (
+	maxDiagDelay   = time.Minute
+	maxDiagPayload = maxHTTPBodySize
+)
+
+// diagnosticMethods are the built-in methods served when Server.Diagnostics is
+// set, to check a deployment from a client such as jsonrpc-diag:
+//
+//   - rpc.echo returns its params, to measure round trips;
+//   - rpc.delay({"ms"}) answers after ms milliseconds, at most a minute;
+//   - rpc.payload({"size"}) returns a string of size bytes, at most 10MiB, to
+//     test the payload limits of proxies on the way.
+var diagnosticMethods = map[string]builtinMethod{
+	"echo":    (*Connection).echoBuiltin,
+	"delay":   (*Connection).delayBuiltin,
+	"payload": (*Connection).payloadBuiltin,
+}
+
+type delayParams struct {
+	Ms int64 `json:"ms"`
+}
+
+type payloadParams struct {
+	Size int `json:"size"`
+}
+
+func (conn *Connection) echoBuiltin(req *Request) (interface{}, error) {
+	if len(req.Param) == 0 {
+		return nil, nil
+	}
+
+	return req.Param, nil
+}
+
+func (conn *Connection) delayBuiltin(req *Request) (interface{}, error) {
+	var p delayParams
+	if err := decodeParams(req.Param, &p); err != nil || p.Ms < 0 {
+		return nil, newError(CodeInvalidParams, "invalid params: expected {\"ms\": <milliseconds>}")
+	}
+
+	delay := time.Duration(p.Ms) * time.Millisecond
+	if delay > maxDiagDelay {
+		return nil, newError(CodeInvalidParams, "invalid params: delay over %s", maxDiagDelay)
+	}
+
+	ctx, done := conn.requestContext(req)
+	defer done()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (conn *Connection) payloadBuiltin(req *Request) (interface{}, error) {
+	var p payloadParams
+	if err := decodeParams(req.Param, &p); err != nil || p.Size < 0 {
+		return nil, newError(CodeInvalidParams, "invalid params: expected {\"size\": <bytes>}")
+	}
+
+	if p.Size > maxDiagPayload {
+		return nil, newError(CodeInvalidParams, "invalid params: payload over %d bytes", maxDiagPayload)
+	}
+
+	return string(bytes.Repeat([]byte{'x'}, p.Size)), nil
+}
@@ -0,0 +1,146 @@
+package jsonrpc
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// connectionAttemptDelay is the delay between two staggered connection attempts,
+// as recommended by RFC 8305.
+const connectionAttemptDelay = 250 * time.Millisecond
+
+type dialResult struct {
+	conn net.Conn
+	err  error
+}
+
+// dialParallel dials addr, a "host:port" pair or a unix:// socket path. When
+// host resolves to several addresses they are tried per RFC 8305 (Happy
+// Eyeballs v2): families are interleaved, attempts are started
+// connectionAttemptDelay apart (or as soon as the previous one fails) and the
+// first connection to succeed is used. host is resolved with the dialer's
+// Resolver, if any.
+func dialParallel(ctx context.Context, dialer *net.Dialer, addr string) (conn net.Conn, err error) {
+	if network, address := splitNetwork(addr); network == "unix" {
+		return dialer.DialContext(ctx, network, address)
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return
+	}
+
+	if net.ParseIP(host) != nil {
+		return dialer.DialContext(ctx, "tcp", addr)
+	}
+
+	resolver := dialer.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	ipAddrs, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return
+	}
+
+	if len(ipAddrs) == 1 {
+		return dialer.DialContext(ctx, "tcp", net.JoinHostPort(ipAddrs[0].String(), port))
+	}
+
+	ipAddrs = interleaveFamilies(ipAddrs)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan dialResult, len(ipAddrs))
+	next, pending := 0, 0
+
+	launch := func() {
+		target := net.JoinHostPort(ipAddrs[next].String(), port)
+		next++
+		pending++
+
+		go func() {
+			c, e := dialer.DialContext(ctx, "tcp", target)
+			results <- dialResult{conn: c, err: e}
+		}()
+	}
+
+	launch()
+
+	for pending > 0 {
+		var (
+			timer *time.Timer
+			delay <-chan time.Time
+		)
+		if next < len(ipAddrs) {
+			timer = time.NewTimer(connectionAttemptDelay)
+			delay = timer.C
+		}
+
+		select {
+		case <-delay:
+			launch()
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				if timer != nil {
+					timer.Stop()
+				}
+				go closeLateConns(results, pending)
+				return res.conn, nil
+			}
+
+			if err == nil {
+				err = res.err
+			}
+
+			if next < len(ipAddrs) {
+				launch()
+			}
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+
+	return
+}
+
+// closeLateConns closes connections of attempts that succeeded after another
+// attempt already won.
+func closeLateConns(results <-chan dialResult, pending int) {
+	for ; pending > 0; pending-- {
+		if res := <-results; res.conn != nil {
+			_ = res.conn.Close()
+		}
+	}
+}
+
+// interleaveFamilies orders addrs IPv6 first, alternating between address
+// families and keeping the resolver order within each family.
+func interleaveFamilies(addrs []net.IPAddr) []net.IPAddr {
+	var v4, v6 []net.IPAddr
+	for _, a := range addrs {
+		if a.IP.To4() != nil {
+			v4 = append(v4, a)
+		} else {
+			v6 = append(v6, a)
+		}
+	}
+
+	out := make([]net.IPAddr, 0, len(addrs))
+	for i := 0; i < len(v4) || i < len(v6); i++ {
+		if i < len(v6) {
+			out = append(out, v6[i])
+		}
+		if i < len(v4) {
+			out = append(out, v4[i])
+		}
+	}
+
+	return out
+}
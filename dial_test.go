@@ -0,0 +1,29 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDialParallelResolver(t *testing.T) {
+	var queries int32
+	errNoDNS := errors.New("no DNS in tests")
+
+	dialer := &net.Dialer{Resolver: &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			atomic.AddInt32(&queries, 1)
+			return nil, errNoDNS
+		},
+	}}
+
+	if _, err := dialParallel(context.Background(), dialer, "rpc.example.invalid:4000"); err == nil {
+		t.Fatal("dialed a name that doesn't resolve")
+	}
+	if atomic.LoadInt32(&queries) == 0 {
+		t.Error("the dialer's resolver wasn't used")
+	}
+}
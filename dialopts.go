@@ -0,0 +1,182 @@
+package jsonrpc
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+)
+
+// ContextDialer dials connections, as *net.Dialer does.
+type ContextDialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// DialOption configures a client dialed with DialContext.
+type DialOption func(opts *dialOptions)
+
+type dialOptions struct {
+	dialer      ContextDialer
+	tls         *tls.Config
+	keepAlive   time.Duration
+	readBuffer  int
+	writeBuffer int
+	callTimeout time.Duration
+	reconnect   *Reconnect
+	breaker     *CircuitBreaker
+	codec       CodecFactory
+}
+
+// WithTLS connects over TLS. When config doesn't name the server, the host of
+// the address is verified.
+func WithTLS(config *tls.Config) DialOption {
+	return func(opts *dialOptions) {
+		opts.tls = config
+	}
+}
+
+// WithKeepAlive sets the period of the TCP keep-alive probes, negative to
+// disable them.
+func WithKeepAlive(period time.Duration) DialOption {
+	return func(opts *dialOptions) {
+		opts.keepAlive = period
+	}
+}
+
+// WithDialer connects with dialer. A *net.Dialer still tries the addresses of
+// the host as Dial does, other dialers are given the address as it is.
+func WithDialer(dialer ContextDialer) DialOption {
+	return func(opts *dialOptions) {
+		opts.dialer = dialer
+	}
+}
+
+// WithBufferSizes sets the sizes of the socket's receive and send buffers,
+// zero keeping the system's.
+func WithBufferSizes(read, write int) DialOption {
+	return func(opts *dialOptions) {
+		opts.readBuffer, opts.writeBuffer = read, write
+	}
+}
+
+// WithCallTimeout bounds the calls made without a deadline, which then fail
+// with ErrTimeout.
+func WithCallTimeout(timeout time.Duration) DialOption {
+	return func(opts *dialOptions) {
+		opts.callTimeout = timeout
+	}
+}
+
+// WithCodec reads and writes frames with the codecs returned by factory, for
+// servers whose Codec is the same.
+func WithCodec(factory CodecFactory) DialOption {
+	return func(opts *dialOptions) {
+		opts.codec = factory
+	}
+}
+
+// DialContext connects to the server at addr, a "host:port" pair or a unix://
+// socket path, configured by opts. ctx bounds the connection and the TLS
+// handshake, not the client's calls.
+func DialContext(ctx context.Context, addr string, opts ...DialOption) (c *Client, err error) {
+	options := applyDialOptions(opts)
+
+	conn, err := options.connect(ctx, addr)
+	if err != nil {
+		return
+	}
+
+	c = newClient(addr, conn, options.codec)
+	c.callTimeout = options.callTimeout
+	c.breaker = options.breaker
+
+	if options.reconnect != nil {
+		c.reconnect = options.reconnect
+		c.connect = func(ctx context.Context) (net.Conn, error) {
+			return options.connect(ctx, addr)
+		}
+	}
+	return
+}
+
+func applyDialOptions(opts []DialOption) *dialOptions {
+	options := &dialOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// connect dials addr, setting up the connection as opts say.
+func (opts *dialOptions) connect(ctx context.Context, addr string) (conn net.Conn, err error) {
+	if conn, err = opts.dial(ctx, addr); err != nil {
+		return
+	}
+
+	type bufferSetter interface {
+		SetReadBuffer(bytes int) error
+		SetWriteBuffer(bytes int) error
+	}
+	if bs, ok := conn.(bufferSetter); ok {
+		if opts.readBuffer > 0 {
+			err = bs.SetReadBuffer(opts.readBuffer)
+		}
+		if err == nil && opts.writeBuffer > 0 {
+			err = bs.SetWriteBuffer(opts.writeBuffer)
+		}
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+
+	if opts.tls != nil {
+		conn, err = handshakeTLS(ctx, conn, addr, opts.tls)
+	}
+	return
+}
+
+func (opts *dialOptions) dial(ctx context.Context, addr string) (net.Conn, error) {
+	dialer := opts.dialer
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+
+	d, ok := dialer.(*net.Dialer)
+	if !ok {
+		network, address := splitNetwork(addr)
+		return dialer.DialContext(ctx, network, address)
+	}
+
+	if opts.keepAlive != 0 {
+		copied := *d
+		copied.KeepAlive = opts.keepAlive
+		d = &copied
+	}
+
+	return dialParallel(ctx, d, addr)
+}
+
+// handshakeTLS runs the client side of the TLS handshake on conn, closing it
+// if the handshake fails. When config doesn't name the server, the host of
+// addr is verified.
+func handshakeTLS(ctx context.Context, conn net.Conn, addr string, config *tls.Config) (net.Conn, error) {
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+
+		config = config.Clone()
+		config.ServerName = host
+	}
+
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return tlsConn, nil
+}
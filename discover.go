@@ -0,0 +1,215 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	typeOfTime       = reflect.TypeOf(time.Time{})
+	typeOfRawMessage = reflect.TypeOf(json.RawMessage{})
+)
+
+// Discovery is the result of the built-in rpc.discover method.
+type Discovery struct {
+	Services []ServiceDescription `json:"services"`
+}
+
+// ServiceDescription describes a registered service.
+type ServiceDescription struct {
+	Name    string              `json:"name"`
+	Methods []MethodDescription `json:"methods"`
+}
+
+// MethodDescription describes a method with the JSON shapes of its params and
+// result.
+type MethodDescription struct {
+	Name   string  `json:"name"`
+	Params *Schema `json:"params"`
+	Result *Schema `json:"result"`
+
+	// Description and Examples are given with WithDoc.
+	Description string    `json:"description,omitempty"`
+	Examples    []Example `json:"examples,omitempty"`
+}
+
+// Schema is the JSON shape of a Go type, a subset of JSON Schema. An empty
+// schema accepts any value.
+type Schema struct {
+	Type                 string             `json:"type,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+}
+
+func (s *Server) discover() (interface{}, error) {
+	return s.Discover(), nil
+}
+
+// Discover describes the registered services, sorted by name, as rpc.discover
+// does.
+func (s *Server) Discover() *Discovery {
+	d := &Discovery{Services: []ServiceDescription{}}
+
+	fieldCase := GoCase
+	if s.Scalars != nil {
+		fieldCase = s.Scalars.fieldCase
+	}
+
+	s.services.RLock()
+	defer s.services.RUnlock()
+
+	for name, svc := range s.serviceMap {
+		desc := ServiceDescription{Name: name}
+
+		for methodName, mthd := range svc.methodMap {
+			method := MethodDescription{
+				Name:   methodName,
+				Params: schemaOf(mthd.inType, fieldCase, nil),
+				Result: schemaOf(mthd.outType.Elem(), fieldCase, nil),
+			}
+			if mthd.proto {
+				method.Params, method.Result = protoSchema(mthd.inType), protoSchema(mthd.outType.Elem())
+			}
+
+			if doc, ok := svc.docs[methodName]; ok {
+				method.Description = doc.Description
+				method.Examples = doc.Examples
+			}
+
+			desc.Methods = append(desc.Methods, method)
+		}
+
+		sort.Slice(desc.Methods, func(i, j int) bool { return desc.Methods[i].Name < desc.Methods[j].Name })
+		d.Services = append(d.Services, desc)
+	}
+
+	sort.Slice(d.Services, func(i, j int) bool { return d.Services[i].Name < d.Services[j].Name })
+	return d
+}
+
+// schemaOf returns the JSON shape encoding/json gives t, with untagged fields
+// named in case c. visiting holds the struct types being described, a
+// recursive reference is described by its title only.
+func schemaOf(t reflect.Type, c FieldCase, visiting map[reflect.Type]bool) *Schema {
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		t, nullable = t.Elem(), true
+	}
+
+	schema := schemaOfValue(t, c, visiting)
+	schema.Nullable = schema.Nullable || nullable
+	return schema
+}
+
+func schemaOfValue(t reflect.Type, c FieldCase, visiting map[reflect.Type]bool) *Schema {
+	switch {
+	case t == typeOfTime:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == typeOfRawMessage:
+		return &Schema{}
+	case t.Implements(typeOfJSONMarshaler) || reflect.PtrTo(t).Implements(typeOfJSONMarshaler):
+		return &Schema{Title: t.Name()}
+	case t.Implements(typeOfTextMarshaler) || reflect.PtrTo(t).Implements(typeOfTextMarshaler):
+		return &Schema{Type: "string", Title: t.Name()}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: schemaOf(t.Elem(), c, visiting), Nullable: true}
+	case reflect.Array:
+		return &Schema{Type: "array", Items: schemaOf(t.Elem(), c, visiting)}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: schemaOf(t.Elem(), c, visiting), Nullable: true}
+	case reflect.Struct:
+		return structSchema(t, c, visiting)
+	}
+
+	// interfaces accept anything
+	return &Schema{}
+}
+
+func structSchema(t reflect.Type, c FieldCase, visiting map[reflect.Type]bool) *Schema {
+	schema := &Schema{Type: "object", Title: t.Name()}
+	if visiting[t] {
+		return schema
+	}
+
+	if visiting == nil {
+		visiting = make(map[reflect.Type]bool)
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	schema.Properties = make(map[string]*Schema)
+	addFields(schema, t, c, visiting)
+	return schema
+}
+
+// addFields adds the fields of struct t encoded by encoding/json to schema,
+// promoting the fields of untagged embedded structs unless t has a field with
+// the same name.
+func addFields(schema *Schema, t reflect.Type, c FieldCase, visiting map[reflect.Type]bool) {
+	var embedded []reflect.Type
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name := strings.Split(tag, ",")[0]
+
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded = append(embedded, ft)
+				continue
+			}
+		}
+
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = c.name(field.Name)
+		}
+
+		schema.Properties[name] = schemaOf(field.Type, c, visiting)
+	}
+
+	for _, ft := range embedded {
+		promoted := &Schema{Properties: make(map[string]*Schema)}
+		addFields(promoted, ft, c, visiting)
+
+		for name, fs := range promoted.Properties {
+			if _, ok := schema.Properties[name]; !ok {
+				schema.Properties[name] = fs
+			}
+		}
+	}
+}
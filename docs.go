@@ -0,0 +1,202 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+)
+
+// MethodDoc documents a method for rpc.discover and DocsHandler.
+type MethodDoc struct {
+	Description string
+	Examples    []Example
+}
+
+// Example is a sample call of a method.
+type Example struct {
+	Name   string          `json:"name,omitempty"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result,omitempty"`
+}
+
+// WithDoc documents method, a method of the service, with a description and
+// examples.
+func WithDoc(method string, description string, examples ...Example) ServiceOption {
+	return func(opts *serviceOptions) {
+		if opts.docs == nil {
+			opts.docs = make(map[string]*MethodDoc)
+		}
+		opts.docs[method] = &MethodDoc{Description: description, Examples: examples}
+	}
+}
+
+// exampleOf returns a value of the shape of schema.
+func exampleOf(schema *Schema, depth int) interface{} {
+	if schema == nil || depth > 4 {
+		return nil
+	}
+
+	switch schema.Type {
+	case "boolean":
+		return false
+	case "integer", "number":
+		return 0
+	case "string":
+		switch schema.Format {
+		case "date-time":
+			return "2006-01-02T15:04:05Z"
+		case "byte":
+			return ""
+		}
+		return "string"
+	case "array":
+		return []interface{}{exampleOf(schema.Items, depth+1)}
+	case "object":
+		object := make(map[string]interface{})
+		for name, property := range schema.Properties {
+			object[name] = exampleOf(property, depth+1)
+		}
+		if schema.AdditionalProperties != nil {
+			object["key"] = exampleOf(schema.AdditionalProperties, depth+1)
+		}
+		return object
+	}
+
+	return nil
+}
+
+// docsMethod is a method as rendered by DocsHandler.
+type docsMethod struct {
+	MethodDescription
+	FullName string
+	Params   string
+	Result   string
+	Examples []docsExample
+}
+
+type docsExample struct {
+	Name    string
+	Request string
+	Result  string
+}
+
+var docsTemplate = template.Must(template.New("docs").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; max-width: 60em; margin: 2em auto; }
+pre { background: #f4f4f4; padding: .5em; overflow-x: auto; }
+h3 { font-family: monospace; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{range .Services}}
+<h2 id="{{.Name}}">{{.Name}}</h2>
+{{range .Methods}}
+<h3 id="{{.FullName}}">{{.FullName}}</h3>
+{{if .Description}}<p>{{.Description}}</p>{{end}}
+<h4>Params</h4>
+<pre>{{.Params}}</pre>
+<h4>Result</h4>
+<pre>{{.Result}}</pre>
+{{range .Examples}}
+<h4>Example{{if .Name}}: {{.Name}}{{end}}</h4>
+<pre>{{.Request}}</pre>
+{{if .Result}}<pre>{{.Result}}</pre>{{end}}
+{{end}}
+{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+type docsService struct {
+	Name    string
+	Methods []docsMethod
+}
+
+// DocsHandler returns an HTTP handler rendering the documentation of the
+// registered services as HTML: the JSON schemas of the params and result of
+// every method, and examples, generated from the schemas for methods not
+// documented with WithDoc.
+func (s *Server) DocsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d := s.Discover()
+
+		title := "JSON-RPC API"
+		if s.Version != "" {
+			title += " " + s.Version
+		}
+
+		data := struct {
+			Title    string
+			Services []docsService
+		}{Title: title}
+
+		for _, svc := range d.Services {
+			ds := docsService{Name: svc.Name}
+			for _, m := range svc.Methods {
+				ds.Methods = append(ds.Methods, docsMethodOf(svc.Name, m))
+			}
+			data.Services = append(data.Services, ds)
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := docsTemplate.Execute(w, data); err != nil {
+			s.logf("jsonrpc: render docs: %v", err)
+		}
+	})
+}
+
+func docsMethodOf(service string, m MethodDescription) docsMethod {
+	dm := docsMethod{
+		MethodDescription: m,
+		FullName:          service + "." + m.Name,
+		Params:            indentJSON(m.Params),
+		Result:            indentJSON(m.Result),
+	}
+
+	examples := m.Examples
+	if len(examples) == 0 {
+		example := exampleOf(m.Params, 0)
+		if !structuredParams(m.Params) {
+			example = []interface{}{example}
+		}
+
+		params, _ := json.Marshal(example)
+		result, _ := json.Marshal(exampleOf(m.Result, 0))
+		examples = []Example{{Params: params, Result: result}}
+	}
+
+	for _, e := range examples {
+		request := map[string]interface{}{
+			"jsonrpc": Version2,
+			"method":  dm.FullName,
+			"params":  e.Params,
+			"id":      1,
+		}
+
+		de := docsExample{Name: e.Name, Request: indentJSON(request)}
+		if len(e.Result) > 0 {
+			de.Result = indentJSON(map[string]interface{}{
+				"jsonrpc": Version2,
+				"result":  e.Result,
+				"id":      1,
+			})
+		}
+		dm.Examples = append(dm.Examples, de)
+	}
+
+	return dm
+}
+
+func indentJSON(v interface{}) string {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
@@ -0,0 +1,146 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Error codes reserved by the JSON-RPC 2.0 specification.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+
+	// CodeServerError is used for handler errors that don't carry a code of
+	// their own.
+	CodeServerError = -32000
+
+	// CodeServiceNotFound is used for calls to services that aren't registered,
+	// CodeMethodNotFound for calls to methods a registered service lacks.
+	CodeServiceNotFound = -32001
+
+	// CodeMethodDisabled is used for calls to methods disabled with
+	// Server.DisableMethod.
+	CodeMethodDisabled = -32002
+
+	// CodeBatchAborted is used for the requests of a batch that weren't run
+	// because an earlier one failed, see Server.BatchFailFast.
+	CodeBatchAborted = -32003
+
+	// CodeServerBusy is used for requests rejected because the server's worker
+	// pool is full, see Server.HandlerWorkers.
+	CodeServerBusy = -32004
+
+	// CodeResultTooLarge is used for results larger than the caller accepts,
+	// see MetaMaxResultSize.
+	CodeResultTooLarge = -32005
+
+	// CodePermissionDenied is used for calls denied by the server's Authz.
+	CodePermissionDenied = -32006
+)
+
+// Error is a structured JSON-RPC error. Handlers may return an *Error to control
+// the code and data sent to JSON-RPC 2.0 clients; clients speaking JSON-RPC 2.0
+// return the errors they receive as *Error.
+type Error struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func newError(code int, format string, args ...interface{}) *Error {
+	return &Error{
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// ErrorCategory is the broad kind of an error code, which clients can act on
+// even for codes they don't know.
+type ErrorCategory int
+
+const (
+	// CategoryApplication is the category of codes outside the range
+	// reserved by JSON-RPC, defined by applications.
+	CategoryApplication ErrorCategory = iota
+
+	// CategoryInvalid is the category of errors in the request: parse
+	// errors, invalid requests and params and other codes from -32768 to
+	// -32100.
+	CategoryInvalid
+
+	// CategoryNotFound is the category of calls to missing or disabled
+	// methods and services.
+	CategoryNotFound
+
+	// CategoryUnavailable is the category of requests the server didn't run
+	// but might run later.
+	CategoryUnavailable
+
+	// CategoryDenied is the category of calls the caller isn't allowed to
+	// make, or whose result it doesn't accept.
+	CategoryDenied
+
+	// CategoryServer is the category of server errors, CodeInternalError and
+	// the codes from -32099 to -32000 this package doesn't define.
+	CategoryServer
+)
+
+var codeCategories = map[int]ErrorCategory{
+	CodeParseError:       CategoryInvalid,
+	CodeInvalidRequest:   CategoryInvalid,
+	CodeMethodNotFound:   CategoryNotFound,
+	CodeInvalidParams:    CategoryInvalid,
+	CodeInternalError:    CategoryServer,
+	CodeServerError:      CategoryServer,
+	CodeServiceNotFound:  CategoryNotFound,
+	CodeMethodDisabled:   CategoryNotFound,
+	CodeBatchAborted:     CategoryUnavailable,
+	CodeServerBusy:       CategoryUnavailable,
+	CodeResultTooLarge:   CategoryDenied,
+	CodePermissionDenied: CategoryDenied,
+}
+
+// KnownCode reports whether e has one of the codes defined by this package.
+// Errors with other codes, such as those a newer server introduced, keep
+// their code and data; Category tells what they are about.
+func (e *Error) KnownCode() bool {
+	_, ok := codeCategories[e.Code]
+	return ok
+}
+
+// Category returns the category of the code of e, derived from the range it
+// falls in when the code isn't known.
+func (e *Error) Category() ErrorCategory {
+	if category, ok := codeCategories[e.Code]; ok {
+		return category
+	}
+
+	switch {
+	case e.Code >= -32099 && e.Code <= -32000:
+		return CategoryServer
+	case e.Code >= -32768 && e.Code <= -32100:
+		return CategoryInvalid
+	}
+	return CategoryApplication
+}
+
+// toError converts err into a structured error.
+func toError(err error) *Error {
+	var rpcErr *Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+
+	return &Error{
+		Code:    CodeServerError,
+		Message: err.Error(),
+	}
+}
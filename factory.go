@@ -0,0 +1,96 @@
+package jsonrpc
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+)
+
+var typeOfConnInfo = reflect.TypeOf(ConnInfo{})
+
+// RegisterFactory registers a service whose receiver is built per connection, so
+// each connection gets its own instance holding per-session state. factory must
+// be a function of the form
+//
+//	func(ConnInfo) *Svc
+//
+// It is called when a connection is opened; when the connection ends the
+// receiver is released by calling its Close method, if it has one.
+func (s *Server) RegisterFactory(factory interface{}, opts ...ServiceOption) error {
+	factoryValue := reflect.ValueOf(factory)
+	factoryType := factoryValue.Type()
+
+	if factoryType.Kind() != reflect.Func || factoryType.NumIn() != 1 || factoryType.In(0) != typeOfConnInfo ||
+		factoryType.NumOut() != 1 {
+		return fmt.Errorf("invalid service factory %s: expected func(ConnInfo) *Service", factoryType)
+	}
+
+	recvType := factoryType.Out(0)
+
+	newService := newService(recvType)
+	newService.factory = factoryValue
+
+	serviceName := recvType.Name()
+	if recvType.Kind() == reflect.Ptr {
+		serviceName = recvType.Elem().Name()
+	}
+
+	return s.addService(serviceName, newService, false, opts)
+}
+
+// openReceivers builds the receivers of factory services for the connection.
+func (conn *Connection) openReceivers() {
+	var factories []*service
+
+	conn.s.services.RLock()
+	for _, svc := range conn.s.serviceMap {
+		if svc.factory.IsValid() {
+			factories = append(factories, svc)
+		}
+	}
+	conn.s.services.RUnlock()
+
+	for _, svc := range factories {
+		conn.receiver(svc)
+	}
+}
+
+// receiver returns the receiver serving svc on this connection.
+func (conn *Connection) receiver(svc *service) reflect.Value {
+	if !svc.factory.IsValid() {
+		return svc.receiverValue
+	}
+
+	conn.rm.Lock()
+	defer conn.rm.Unlock()
+
+	if receiver, ok := conn.receivers[svc]; ok {
+		return receiver
+	}
+
+	receiver := svc.factory.Call([]reflect.Value{reflect.ValueOf(*conn.info)})[0]
+	if conn.receivers == nil {
+		conn.receivers = make(map[*service]reflect.Value)
+	}
+	conn.receivers[svc] = receiver
+	return receiver
+}
+
+// releaseReceivers closes the per-connection receivers that have a Close method.
+func (conn *Connection) releaseReceivers() {
+	conn.rm.Lock()
+	defer conn.rm.Unlock()
+
+	for svc, receiver := range conn.receivers {
+		switch r := receiver.Interface().(type) {
+		case io.Closer:
+			if err := r.Close(); err != nil {
+				conn.s.logf("jsonrpc: release %s receiver: %v", svc.receiverType, err)
+			}
+		case interface{ Close() }:
+			r.Close()
+		}
+	}
+
+	conn.receivers = nil
+}
@@ -0,0 +1,198 @@
+package jsonrpc
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Backoff between the attempts to replace a lost connection of a Failover.
+const (
+	failoverMinBackoff = 50 * time.Millisecond
+	failoverMaxBackoff = 5 * time.Second
+)
+
+// ErrNoConnection is returned by Failover when both of its connections are
+// lost and neither has been replaced yet.
+var ErrNoConnection = errors.New("no connection available")
+
+// Failover sends calls over a primary connection while holding a standby
+// connection ready, to the same or another endpoint. When the primary
+// connection is lost the standby takes over at once: calls pending on the lost
+// connection are sent again over the new primary one, and a connection to the
+// lost endpoint is dialed in the background to become the new standby.
+//
+// Each connection is adapted to its server with Client.Negotiate, so the two
+// endpoints may run different versions of the server.
+//
+// Resent calls may run twice if the server handled them before the connection
+// was lost, so Failover suits idempotent methods.
+type Failover struct {
+	m                sync.Mutex
+	primary, standby *Client
+	closed           bool
+}
+
+// DialFailover connects to primary and to standby, which may be the same
+// address.
+func DialFailover(primary, standby string) (f *Failover, err error) {
+	f = &Failover{}
+
+	if f.primary, err = dialNegotiated(primary); err != nil {
+		return nil, err
+	}
+
+	if f.standby, err = dialNegotiated(standby); err != nil {
+		f.primary.Close()
+		return nil, err
+	}
+
+	go f.watch(f.primary)
+	go f.watch(f.standby)
+	return
+}
+
+// Call is like Client.Call over the primary connection, resending the call
+// over the standby connection if the primary one is lost before it completes.
+func (f *Failover) Call(method string, in, out interface{}) (err error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		var c *Client
+		if c, err = f.client(); err != nil {
+			return
+		}
+
+		err = c.Call(method, in, out)
+		if !f.isLost(err) {
+			return
+		}
+
+		f.lost(c)
+	}
+
+	return
+}
+
+// Notify is like Client.Notify over the primary connection.
+func (f *Failover) Notify(method string, in interface{}) (err error) {
+	c, err := f.client()
+	if err != nil {
+		return
+	}
+
+	err = c.Notify(method, in)
+	return
+}
+
+// Close closes both connections.
+func (f *Failover) Close() {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	if f.closed {
+		return
+	}
+	f.closed = true
+
+	for _, c := range []*Client{f.primary, f.standby} {
+		if c != nil {
+			c.Close()
+		}
+	}
+}
+
+func (f *Failover) client() (*Client, error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	if f.closed {
+		return nil, ErrClientClosed
+	}
+
+	if f.primary == nil {
+		return nil, ErrNoConnection
+	}
+
+	return f.primary, nil
+}
+
+// isLost reports whether err means the connection of a call was lost.
+func (f *Failover) isLost(err error) bool {
+	var lost *connError
+	return errors.As(err, &lost) || errors.Is(err, ErrClientClosed)
+}
+
+// watch waits for the connection of c to end and replaces it.
+func (f *Failover) watch(c *Client) {
+	<-c.done
+	f.lost(c)
+}
+
+// lost promotes the standby connection if c was the primary one, and starts
+// replacing c. It is a no-op if c was already replaced.
+func (f *Failover) lost(c *Client) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	if f.closed {
+		return
+	}
+
+	switch c {
+	case f.primary:
+		f.primary, f.standby = f.standby, nil
+	case f.standby:
+		f.standby = nil
+	default:
+		return
+	}
+
+	go f.redial(c.addr)
+}
+
+// redial dials addr until it succeeds, the new connection becoming the
+// standby one, or the primary one if there is none.
+func (f *Failover) redial(addr string) {
+	backoff := failoverMinBackoff
+
+	for {
+		c, err := dialNegotiated(addr)
+
+		f.m.Lock()
+		if f.closed {
+			f.m.Unlock()
+			if c != nil {
+				c.Close()
+			}
+			return
+		}
+
+		if err == nil {
+			if f.primary == nil {
+				f.primary = c
+			} else {
+				f.standby = c
+			}
+			f.m.Unlock()
+
+			go f.watch(c)
+			return
+		}
+		f.m.Unlock()
+
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > failoverMaxBackoff {
+			backoff = failoverMaxBackoff
+		}
+	}
+}
+
+// dialNegotiated dials addr and negotiates with the server. Servers that can't
+// negotiate are called with the client's defaults.
+func dialNegotiated(addr string) (c *Client, err error) {
+	if c, err = Dial(addr); err != nil {
+		return
+	}
+
+	_, _ = c.Negotiate()
+	return
+}
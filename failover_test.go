@@ -0,0 +1,76 @@
+package jsonrpc
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// failoverName calls Conn.Name through f until it answers want.
+func failoverName(t *testing.T, f *Failover, want string) {
+	t.Helper()
+
+	var name string
+	var err error
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if err = f.Call("Conn.Name", 0, &name); err == nil && name == want {
+			return
+		}
+	}
+	t.Fatalf("Conn.Name = %q, %v; want %q", name, err, want)
+}
+
+func TestFailover(t *testing.T) {
+	a, addrA := newNamedServer(t, "A")
+	b, addrB := newNamedServer(t, "B")
+
+	f, err := DialFailover(addrA, addrB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var name string
+	if err = f.Call("Conn.Name", 0, &name); err != nil || name != "A" {
+		t.Fatalf("Conn.Name = %q, %v; want the primary", name, err)
+	}
+
+	// the standby takes over and a new standby is dialed to A
+	a.closeConns()
+	failoverName(t, f, "B")
+
+	// the redialed connection takes over in turn
+	b.Close()
+	failoverName(t, f, "A")
+
+	f.Close()
+	if err = f.Call("Conn.Name", 0, &name); err != ErrClientClosed {
+		t.Errorf("call after Close: %v", err)
+	}
+}
+
+func TestFailoverResendsPendingCalls(t *testing.T) {
+	a := NewServer("")
+	err := a.RegisterFunc("Conn.Name", func(ctx context.Context, _ int) (string, error) {
+		// the connection is lost while the call is pending
+		a.closeConns()
+		time.Sleep(time.Second)
+		return "A", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addrA := serveTCP(t, a)
+	_, addrB := newNamedServer(t, "B")
+
+	f, err := DialFailover(addrA, addrB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var name string
+	if err = f.Call("Conn.Name", 0, &name); err != nil || name != "B" {
+		t.Fatalf("Conn.Name = %q, %v; want the call resent to the standby", name, err)
+	}
+}
@@ -0,0 +1,106 @@
+package jsonrpc
+
+import (
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// FieldCase is the case of the wire names of struct fields without a json
+// tag, see Scalars.SetFieldCase.
+type FieldCase int
+
+const (
+	// GoCase names fields as in Go, as encoding/json does: UserID.
+	GoCase FieldCase = iota
+
+	// SnakeCase names fields in snake case: user_id.
+	SnakeCase
+
+	// CamelCase names fields in lower camel case: userID.
+	CamelCase
+)
+
+// SetFieldCase names the fields without a json tag in case c on the wire,
+// for peers in languages with other naming conventions. Tagged fields keep
+// the name of their tag.
+func (s *Scalars) SetFieldCase(c FieldCase) *Scalars {
+	s.fieldCase = c
+	return s
+}
+
+// name returns the wire name of the field named name in Go.
+func (c FieldCase) name(name string) string {
+	switch c {
+	case SnakeCase:
+		return snakeCase(name)
+	case CamelCase:
+		return camelCase(name)
+	}
+	return name
+}
+
+// snakeCase returns name in snake case, acronyms kept as one word: HTTPServer
+// becomes http_server.
+func snakeCase(name string) string {
+	runes := []rune(name)
+
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || unicode.IsUpper(prev) && nextLower {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+
+	return b.String()
+}
+
+// camelCase returns name with its first word in lower case: HTTPServer becomes
+// httpServer, ID id.
+func camelCase(name string) string {
+	runes := []rune(name)
+
+	upper := 0
+	for upper < len(runes) && unicode.IsUpper(runes[upper]) {
+		upper++
+	}
+
+	// the last capital of a run followed by lower case starts the next word
+	if upper > 1 && upper < len(runes) && unicode.IsLower(runes[upper]) {
+		upper--
+	}
+
+	for i := 0; i < upper; i++ {
+		runes[i] = unicode.ToLower(runes[i])
+	}
+
+	return string(runes)
+}
+
+// fields returns the fields of struct type t under their wire names.
+func (s *Scalars) fields(t reflect.Type) []jsonField {
+	fields := jsonFields(t)
+	if s.fieldCase == GoCase {
+		return fields
+	}
+
+	if cached, ok := s.casedFields.Load(t); ok {
+		return cached.([]jsonField)
+	}
+
+	cased := make([]jsonField, len(fields))
+	for i, field := range fields {
+		if !field.tagged {
+			field.name = s.fieldCase.name(field.name)
+		}
+		cased[i] = field
+	}
+
+	s.casedFields.Store(t, cased)
+	return cased
+}
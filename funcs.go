@@ -0,0 +1,111 @@
+package jsonrpc
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// RegisterFunc publishes fn as the method name, e.g. Math.Add, without a
+// receiver type. fn must be of the form
+//
+//	func(ctx context.Context, in In) (Out, error)
+//
+// or take in alone; its result is sent to the caller. Functions registered
+// under the same service name make up one service, which can't also be
+// registered with Register. opts only apply to this method.
+func (s *Server) RegisterFunc(name string, fn interface{}, opts ...ServiceOption) error {
+	serviceName, methodName, ok := splitMethod(name)
+	if !ok {
+		return fmt.Errorf("invalid method name '%s'", name)
+	}
+
+	if err := checkServiceName(serviceName); err != nil {
+		return err
+	}
+
+	fnValue := reflect.ValueOf(fn)
+	if fnValue.Kind() != reflect.Func || fnValue.IsNil() {
+		return fmt.Errorf("invalid function for %s: %T", name, fn)
+	}
+
+	mthd, ok := funcMethod(fnValue)
+	if !ok {
+		return fmt.Errorf("invalid function %s for %s: expected func(context.Context, In) (Out, error) or func(In) (Out, error)", fnValue.Type(), name)
+	}
+
+	options := &serviceOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	mthd.interceptors = options.chain()
+	if options.protobuf {
+		useProtobuf(map[string]*serviceMethod{methodName: mthd})
+	}
+
+	s.services.Lock()
+	defer s.services.Unlock()
+
+	// services are copied rather than modified, they are read without the lock
+	newService := &service{
+		methodMap: make(map[string]*serviceMethod),
+		docs:      make(map[string]*MethodDoc),
+		funcs:     true,
+	}
+
+	if svc, ok := s.serviceMap[serviceName]; ok {
+		if !svc.funcs {
+			return fmt.Errorf("%w: '%s'", ErrServiceExists, serviceName)
+		}
+
+		if _, ok := svc.methodMap[methodName]; ok {
+			return fmt.Errorf("method '%s' is already registered", name)
+		}
+
+		for n, m := range svc.methodMap {
+			newService.methodMap[n] = m
+		}
+		for n, doc := range svc.docs {
+			newService.docs[n] = doc
+		}
+	}
+
+	newService.methodMap[methodName] = mthd
+	for n, doc := range options.docs {
+		newService.docs[n] = doc
+	}
+
+	if s.serviceMap == nil {
+		s.serviceMap = make(map[string]*service)
+	}
+	s.serviceMap[serviceName] = newService
+
+	return nil
+}
+
+// funcMethod returns the method calling fn, if it has a signature accepted by
+// RegisterFunc.
+func funcMethod(fn reflect.Value) (*serviceMethod, bool) {
+	t := fn.Type()
+
+	hasCtx := t.NumIn() == 2 && t.In(0) == typeOfContext
+	if t.NumIn() != 1 && !hasCtx {
+		return nil, false
+	}
+
+	if t.NumOut() != 2 || t.Out(1) != typeOfError {
+		return nil, false
+	}
+
+	inType, outType := t.In(t.NumIn()-1), t.Out(0)
+	if !isExportedOrBuiltinType(inType) || !isExportedOrBuiltinType(outType) {
+		return nil, false
+	}
+
+	return &serviceMethod{
+		fn:            fn,
+		inType:        inType,
+		outType:       reflect.PtrTo(outType),
+		hasCtx:        hasCtx,
+		returnsResult: true,
+	}, true
+}
@@ -0,0 +1,113 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// maxHTTPBodySize bounds the body of the requests served over HTTP.
+const maxHTTPBodySize = 10 << 20
+
+// ErrNoPeerChannel is returned by Connection.Call and Progress on connections
+// that can't carry requests from the server, such as HTTP requests.
+var ErrNoPeerChannel = errors.New("connection can't carry server-initiated messages")
+
+// httpAddr is the address of the remote end of an HTTP request.
+type httpAddr string
+
+func (a httpAddr) Network() string { return "tcp" }
+func (a httpAddr) String() string  { return string(a) }
+
+// ServeHTTP serves one request or batch of requests POSTed as the request
+// body, replying with the response or batch of responses; requests made only
+// of notifications get 204 No Content. Each HTTP request is served as its own
+// connection: service factories are called for it, and handlers can't call
+// back into the client or report progress. Checksum doesn't apply to HTTP.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "JSON-RPC requests must be POSTed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	conn := newHTTPConnection(s, r)
+	defer conn.cancel()
+	defer conn.releaseReceivers()
+
+	if conn.banned() {
+		http.Error(w, "too many protocol violations", http.StatusForbidden)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxHTTPBodySize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			conn.violation(ViolationOversized, err)
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "reading request body failed", http.StatusBadRequest)
+		return
+	}
+
+	var frame interface{}
+	if !json.Valid(body) {
+		conn.violation(ViolationBadFrame, errors.New("invalid JSON"))
+		req := &Request{received: time.Now()}
+		frame = conn.response(req, newErrorResponse(req, newError(CodeParseError, "parse error: invalid JSON")))
+	} else {
+		if conn.protocol == ProtocolAuto {
+			conn.protocol = detectProtocol(body)
+		}
+		frame = conn.respond(body, conn.scalars())
+	}
+
+	if frame == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	out, err := json.Marshal(frame)
+	if err != nil {
+		s.logf("jsonrpc: marshal HTTP response: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(append(out, '\n'))
+}
+
+// newHTTPConnection returns the connection serving the HTTP request r. It has no
+// network connection of its own: its context is the request's.
+func newHTTPConnection(s *Server, r *http.Request) *Connection {
+	info := &ConnInfo{
+		RemoteAddr:  httpAddr(r.RemoteAddr),
+		ConnectedAt: time.Now(),
+	}
+
+	if local, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		info.LocalAddr = local
+	}
+
+	if r.TLS != nil {
+		info.Peer = peerIdentity(*r.TLS)
+	}
+
+	conn := &Connection{
+		s:        s,
+		info:     info,
+		protocol: s.Protocol,
+	}
+
+	ctx := context.WithValue(r.Context(), connInfoKey{}, info)
+	conn.ctx, conn.cancel = context.WithCancel(context.WithValue(ctx, connKey{}, conn))
+
+	return conn
+}
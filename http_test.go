@@ -0,0 +1,105 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newHTTPServer(t *testing.T) string {
+	s := NewServer("")
+	s.Protocol = ProtocolJSONRPC2
+
+	err := s.RegisterFunc("Echo.Int", func(ctx context.Context, in int) (int, error) { return in, nil })
+	if err == nil {
+		err = s.RegisterFunc("Echo.Back", func(ctx context.Context, in int) (out int, err error) {
+			conn, _ := ConnectionFromContext(ctx)
+			err = conn.Call(ctx, "Peer.Echo", in, &out)
+			return
+		})
+	}
+	if err == nil {
+		err = s.RegisterFunc("Echo.Addr", func(ctx context.Context, _ int) (string, error) {
+			info, _ := ConnInfoFromContext(ctx)
+			return info.RemoteAddr.String(), nil
+		})
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hs := httptest.NewServer(s)
+	t.Cleanup(hs.Close)
+	return hs.URL
+}
+
+func post(t *testing.T, url, body string) (status int, out string) {
+	t.Helper()
+
+	resp, err := http.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, strings.TrimSpace(string(b))
+}
+
+func TestServeHTTP(t *testing.T) {
+	url := newHTTPServer(t)
+
+	tests := []struct {
+		body   string
+		status int
+		want   string
+	}{
+		{`{"jsonrpc":"2.0","id":1,"method":"Echo.Int","params":[7]}`, http.StatusOK,
+			`{"jsonrpc":"2.0","id":1,"result":7}`},
+		{`[{"jsonrpc":"2.0","id":1,"method":"Echo.Int","params":[1]},{"jsonrpc":"2.0","method":"Echo.Int","params":[2]}]`, http.StatusOK,
+			`[{"jsonrpc":"2.0","id":1,"result":1}]`},
+		{`{"jsonrpc":"2.0","method":"Echo.Int","params":[7]}`, http.StatusNoContent, ``},
+		{`{"jsonrpc":"2.0","id":1,"method":`, http.StatusOK, `"code":-32700`},
+		{`{"jsonrpc":"2.0","id":1,"method":"Echo.Back","params":[7]}`, http.StatusOK, ErrNoPeerChannel.Error()},
+	}
+	for _, test := range tests {
+		status, out := post(t, url, test.body)
+		if status != test.status || !strings.Contains(out, test.want) || test.want == "" && out != "" {
+			t.Errorf("%s: %d %s, want %d %s", test.body, status, out, test.status, test.want)
+		}
+	}
+
+	// handlers see the address of the HTTP client
+	_, out := post(t, url, `{"jsonrpc":"2.0","id":1,"method":"Echo.Addr","params":[0]}`)
+	var resp struct {
+		Result string `json:"result"`
+	}
+	if err := json.Unmarshal([]byte(out), &resp); err != nil || !strings.HasPrefix(resp.Result, "127.0.0.1:") {
+		t.Errorf("remote address %q, %v", resp.Result, err)
+	}
+}
+
+func TestServeHTTPRejects(t *testing.T) {
+	url := newHTTPServer(t)
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Allow") != http.MethodPost {
+		t.Errorf("GET: %d, Allow %q", resp.StatusCode, resp.Header.Get("Allow"))
+	}
+
+	huge := `{"jsonrpc":"2.0","id":1,"method":"Echo.Int","params":[1],"pad":"` + strings.Repeat("x", maxHTTPBodySize) + `"}`
+	if status, _ := post(t, url, huge); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized body: %d", status)
+	}
+}
@@ -0,0 +1,59 @@
+package jsonrpc
+
+import (
+	"sync"
+)
+
+// onDemand runs the consumer of a queue in a goroutine started when items are
+// queued and exiting once the queue is empty, so that idle connections only
+// hold their reader goroutine.
+type onDemand struct {
+	m       sync.Mutex
+	running bool
+	wg      sync.WaitGroup
+}
+
+// start runs loop in a new goroutine unless it is already running. It must be
+// called after queueing an item.
+func (d *onDemand) start(loop func()) {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	if d.running {
+		return
+	}
+
+	d.running = true
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		loop()
+	}()
+}
+
+// exit reports whether the loop may return because its queue is empty; queued
+// reports the number of queued items.
+func (d *onDemand) exit(queued func() int) bool {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	if queued() > 0 {
+		return false
+	}
+
+	d.running = false
+	return true
+}
+
+// idle reports whether the loop isn't running and has nothing queued.
+func (d *onDemand) idle(queued func() int) bool {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	return !d.running && queued() == 0
+}
+
+// wait waits for the loop to return. No item may be queued after wait is called.
+func (d *onDemand) wait() {
+	d.wg.Wait()
+}
@@ -0,0 +1,168 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrRateLimited is returned to callers of a service whose rate limit is exceeded.
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// Handler handles a request and returns its response.
+type Handler func(ctx context.Context, req *Request) (*Response, error)
+
+// Interceptor wraps the handling of a request. It may inspect or modify the
+// request and response, short-circuit the call by returning an error, or call
+// next to continue.
+type Interceptor func(ctx context.Context, req *Request, next Handler) (*Response, error)
+
+// chain wraps handler with interceptors, the first one being the outermost.
+func chain(handler Handler, interceptors []Interceptor) Handler {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(ctx context.Context, req *Request) (*Response, error) {
+			return interceptor(ctx, req, next)
+		}
+	}
+
+	return handler
+}
+
+// Use appends interceptors run around every call to a registered method,
+// outside those of the method's service. Built-in rpc.* methods aren't
+// intercepted. Use must be called before serving.
+func (s *Server) Use(interceptors ...Interceptor) {
+	s.interceptors = append(s.interceptors, interceptors...)
+}
+
+// OutgoingCall is a call made by a client, as seen by its interceptors, which
+// may modify it before calling next.
+type OutgoingCall struct {
+	Method string
+	Params interface{}
+	Meta   map[string]string
+}
+
+// Invoker sends a call and returns its response with the error it carries, or
+// the error the call failed with.
+type Invoker func(ctx context.Context, call *OutgoingCall) (*Response, error)
+
+// ClientInterceptor wraps the calls of a client. It may inspect or modify the
+// call and the response, short-circuit the call by returning an error, or call
+// next, possibly more than once to retry it.
+type ClientInterceptor func(ctx context.Context, call *OutgoingCall, next Invoker) (*Response, error)
+
+// Use appends interceptors run around every call made by the client, the first
+// one being the outermost. Notifications aren't intercepted. Use must be called
+// before the first call.
+func (c *Client) Use(interceptors ...ClientInterceptor) {
+	c.interceptors = append(c.interceptors, interceptors...)
+}
+
+// chainClient wraps invoker with interceptors, the first one being the
+// outermost.
+func chainClient(invoker Invoker, interceptors []ClientInterceptor) Invoker {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], invoker
+		invoker = func(ctx context.Context, call *OutgoingCall) (*Response, error) {
+			return interceptor(ctx, call, next)
+		}
+	}
+
+	return invoker
+}
+
+// ServiceOption configures a service at registration time. Options only apply
+// to the methods of that service.
+type ServiceOption func(opts *serviceOptions)
+
+type serviceOptions struct {
+	authorize    func(ctx context.Context, req *Request) error
+	limiter      *tokenBucket
+	timeout      time.Duration
+	interceptors []Interceptor
+	docs         map[string]*MethodDoc
+	bandwidth    map[string]*methodBandwidth
+	streamLogs   bool
+	protobuf     bool
+}
+
+// WithInterceptors adds interceptors run around every method of the service.
+func WithInterceptors(interceptors ...Interceptor) ServiceOption {
+	return func(opts *serviceOptions) {
+		opts.interceptors = append(opts.interceptors, interceptors...)
+	}
+}
+
+// WithTimeout sets a deadline on the context passed to the service's methods.
+func WithTimeout(timeout time.Duration) ServiceOption {
+	return func(opts *serviceOptions) {
+		opts.timeout = timeout
+	}
+}
+
+// WithAuthorizer rejects calls to the service for which authorize returns an
+// error; the error is sent to the caller and counted as a ViolationAuth, see
+// BanPolicy.
+func WithAuthorizer(authorize func(ctx context.Context, req *Request) error) ServiceOption {
+	return func(opts *serviceOptions) {
+		opts.authorize = authorize
+	}
+}
+
+// WithRateLimit limits calls to the service to perSecond calls per second with
+// bursts of up to burst calls. Calls over the limit fail with ErrRateLimited.
+func WithRateLimit(perSecond float64, burst int) ServiceOption {
+	return func(opts *serviceOptions) {
+		opts.limiter = newTokenBucket(perSecond, burst)
+	}
+}
+
+// chain returns the interceptors implementing opts, in the order they
+// are run.
+func (opts *serviceOptions) chain() []Interceptor {
+	var interceptors []Interceptor
+
+	if opts.authorize != nil {
+		authorize := opts.authorize
+		interceptors = append(interceptors, func(ctx context.Context, req *Request, next Handler) (*Response, error) {
+			if err := authorize(ctx, req); err != nil {
+				if conn, ok := ConnectionFromContext(ctx); ok {
+					conn.violation(ViolationAuth, err)
+				}
+				return nil, err
+			}
+			return next(ctx, req)
+		})
+	}
+
+	if opts.limiter != nil {
+		limiter := opts.limiter
+		interceptors = append(interceptors, func(ctx context.Context, req *Request, next Handler) (*Response, error) {
+			if !limiter.allow() {
+				return nil, ErrRateLimited
+			}
+			return next(ctx, req)
+		})
+	}
+
+	if opts.streamLogs {
+		interceptors = append(interceptors, streamLogsInterceptor)
+	}
+
+	if len(opts.bandwidth) > 0 {
+		interceptors = append(interceptors, bandwidthInterceptor(opts.bandwidth))
+	}
+
+	if opts.timeout > 0 {
+		timeout := opts.timeout
+		interceptors = append(interceptors, func(ctx context.Context, req *Request, next Handler) (*Response, error) {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			return next(ctx, req)
+		})
+	}
+
+	return append(interceptors, opts.interceptors...)
+}
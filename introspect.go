@@ -0,0 +1,64 @@
+package jsonrpc
+
+import (
+	"crypto/tls"
+	"sort"
+	"time"
+)
+
+// PendingCall describes a call of a client awaiting its response.
+type PendingCall struct {
+	Id     uint32
+	Method string
+
+	// Started is when the call was sent, Deadline when the caller gives up
+	// on it, zero if it waits until the response.
+	Started  time.Time
+	Deadline time.Time
+}
+
+// Age returns the time the call has been waiting for.
+func (p PendingCall) Age() time.Duration {
+	return time.Since(p.Started)
+}
+
+// PendingCalls returns the calls awaiting their response, oldest first. The
+// result is a snapshot: calls may complete as soon as it is returned.
+func (c *Client) PendingCalls() []PendingCall {
+	c.m.Lock()
+	pending := make([]PendingCall, 0, len(c.calls))
+	for _, call := range c.calls {
+		pending = append(pending, PendingCall{
+			Id:       call.id,
+			Method:   call.method,
+			Started:  call.started,
+			Deadline: call.deadline,
+		})
+	}
+	c.m.Unlock()
+
+	sort.Slice(pending, func(i, j int) bool { return pending[i].Started.Before(pending[j].Started) })
+	return pending
+}
+
+// ConnInfo describes the connection of the client. Peer is the identity of the
+// server for TLS connections.
+func (c *Client) ConnInfo() ConnInfo {
+	c.m.Lock()
+	conn, connectedAt := c.conn, c.connectedAt
+	c.m.Unlock()
+
+	info := ConnInfo{
+		RemoteAddr:  conn.RemoteAddr(),
+		LocalAddr:   conn.LocalAddr(),
+		ConnectedAt: connectedAt,
+	}
+
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if state := tlsConn.ConnectionState(); state.HandshakeComplete {
+			info.Peer = peerIdentity(state)
+		}
+	}
+
+	return info
+}
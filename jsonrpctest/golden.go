@@ -0,0 +1,236 @@
+// Package jsonrpctest helps testing JSON-RPC services.
+//
+// Golden tests send requests to a server and compare its responses, as they
+// appear on the wire, with golden files recorded earlier, so that any change
+// to what clients receive fails the test until the files are recorded again:
+//
+//	func TestWire(t *testing.T) {
+//		s := jsonrpc.NewServer("")
+//		s.Register(&Arith{}, jsonrpc.WithDoc("Add", "Adds two numbers.",
+//			jsonrpc.Example{Params: json.RawMessage(`[1, 2]`), Result: json.RawMessage(`3`)}))
+//
+//		g := &jsonrpctest.Golden{Server: s}
+//		g.CheckExamples(t)
+//		g.Check(t, "add-negative", "Arith.Add", []int{-1, -2})
+//	}
+//
+// Golden files are recorded, or recorded again, by running the tests with the
+// JSONRPCTEST_UPDATE environment variable set.
+package jsonrpctest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grearter/jsonrpc"
+)
+
+// UpdateEnv is the environment variable which, set to a non-empty value, makes
+// golden tests record the responses they get instead of checking them.
+const UpdateEnv = "JSONRPCTEST_UPDATE"
+
+const (
+	defaultGoldenDir     = "testdata/golden"
+	defaultGoldenTimeout = 5 * time.Second
+)
+
+// Golden checks the responses of Server against the golden files in Dir,
+// testdata/golden if empty. Requests are sent in the server's protocol,
+// JSON-RPC 2.0 if it detects the protocol.
+type Golden struct {
+	Server *jsonrpc.Server
+	Dir    string
+
+	// Update records the responses instead of checking them, as setting
+	// UpdateEnv does.
+	Update bool
+
+	// Timeout bounds each request, 5 seconds if zero.
+	Timeout time.Duration
+}
+
+// goldenFile is the content of a golden file.
+type goldenFile struct {
+	Request  json.RawMessage `json:"request"`
+	Response json.RawMessage `json:"response"`
+}
+
+// Check sends a request for method with params and compares the request and
+// its response with the golden file named after name. It returns the
+// response, nil if it failed the test.
+func (g *Golden) Check(t testing.TB, name, method string, params interface{}) json.RawMessage {
+	t.Helper()
+
+	request, err := g.request(method, params)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+		return nil
+	}
+
+	response, err := g.roundTrip(request)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+		return nil
+	}
+
+	got, err := json.MarshalIndent(&goldenFile{Request: request, Response: response}, "", "  ")
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+		return nil
+	}
+	got = append(got, '\n')
+
+	path := filepath.Join(g.dir(), fileName(name)+".json")
+
+	if g.Update || os.Getenv(UpdateEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("%s: %v", name, err)
+			return nil
+		}
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatalf("%s: %v", name, err)
+			return nil
+		}
+		return response
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%s: %v (run with %s=1 to record it)", name, err, UpdateEnv)
+		return nil
+	}
+
+	if !equalJSON(want, got) {
+		t.Errorf("%s: the wire changed\n--- golden %s\n%s--- got\n%s", name, path, want, got)
+		return nil
+	}
+
+	return response
+}
+
+// CheckExamples checks the examples of the methods documented with
+// jsonrpc.WithDoc, each against a golden file named after its method and its
+// name, or its position among unnamed examples. The result of examples giving
+// one must match it too.
+func (g *Golden) CheckExamples(t testing.TB) {
+	t.Helper()
+
+	for _, svc := range g.Server.Discover().Services {
+		for _, m := range svc.Methods {
+			method := svc.Name + "." + m.Name
+
+			for i, e := range m.Examples {
+				name := method
+				switch {
+				case e.Name != "":
+					name += "-" + e.Name
+				case len(m.Examples) > 1:
+					name += "-" + strconv.Itoa(i+1)
+				}
+
+				response := g.Check(t, name, method, e.Params)
+				if response == nil || len(e.Result) == 0 {
+					continue
+				}
+
+				var r struct {
+					Result json.RawMessage `json:"result"`
+				}
+				if err := json.Unmarshal(response, &r); err != nil || !equalJSON(r.Result, e.Result) {
+					t.Errorf("%s: result %s, the example gives %s", name, r.Result, e.Result)
+				}
+			}
+		}
+	}
+}
+
+func (g *Golden) dir() string {
+	if g.Dir != "" {
+		return g.Dir
+	}
+	return defaultGoldenDir
+}
+
+func (g *Golden) timeout() time.Duration {
+	if g.Timeout > 0 {
+		return g.Timeout
+	}
+	return defaultGoldenTimeout
+}
+
+// request returns the request frame for method with params, with id 1.
+func (g *Golden) request(method string, params interface{}) (json.RawMessage, error) {
+	frame := map[string]interface{}{
+		"id":     1,
+		"method": method,
+	}
+
+	switch g.Server.Protocol {
+	case jsonrpc.ProtocolLegacy:
+		frame["param"] = params
+	case jsonrpc.ProtocolJSONRPC1:
+		frame["params"] = params
+	default:
+		frame["jsonrpc"] = jsonrpc.Version2
+		frame["params"] = params
+	}
+
+	return json.Marshal(frame)
+}
+
+// roundTrip sends request to the server over a connection of its own and
+// returns the response.
+func (g *Golden) roundTrip(request json.RawMessage) (response json.RawMessage, err error) {
+	serverEnd, clientEnd := net.Pipe()
+	defer clientEnd.Close()
+
+	go g.Server.ServeConn(serverEnd)
+
+	if err = clientEnd.SetDeadline(time.Now().Add(g.timeout())); err != nil {
+		return
+	}
+
+	if _, err = clientEnd.Write(append(request, '\n')); err != nil {
+		return nil, fmt.Errorf("sending request: %v", err)
+	}
+
+	if err = json.NewDecoder(clientEnd).Decode(&response); err != nil {
+		return nil, fmt.Errorf("reading response: %v", err)
+	}
+
+	return
+}
+
+// fileName returns name with the characters unfit for file names replaced.
+func fileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '.' || r == '-' || r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// equalJSON reports whether a and b hold the same JSON values.
+func equalJSON(a, b []byte) bool {
+	var va, vb interface{}
+
+	da := json.NewDecoder(strings.NewReader(string(a)))
+	da.UseNumber()
+	db := json.NewDecoder(strings.NewReader(string(b)))
+	db.UseNumber()
+
+	if da.Decode(&va) != nil || db.Decode(&vb) != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(va, vb)
+}
@@ -0,0 +1,87 @@
+package jsonrpc
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+const defaultErrorLogInterval = time.Minute
+
+// logAggregator logs the first message of each kind, then the number of similar
+// messages once per interval, so a misbehaving client can't flood the log.
+// Messages are of the same kind when they share their format.
+type logAggregator struct {
+	m     sync.Mutex
+	kinds map[string]*logKind
+}
+
+type logKind struct {
+	since      time.Time
+	suppressed int
+	last       string
+}
+
+func (s *Server) errorLogInterval() time.Duration {
+	if s.ErrorLogInterval != 0 {
+		return s.ErrorLogInterval
+	}
+	return defaultErrorLogInterval
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	interval := s.errorLogInterval()
+	if interval < 0 {
+		s.output(fmt.Sprintf(format, args...))
+		return
+	}
+
+	a := &s.logs
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	if a.kinds == nil {
+		a.kinds = make(map[string]*logKind)
+	}
+
+	if kind, ok := a.kinds[format]; ok {
+		kind.suppressed++
+		kind.last = fmt.Sprintf(format, args...)
+		return
+	}
+
+	a.kinds[format] = &logKind{since: time.Now()}
+	s.output(fmt.Sprintf(format, args...))
+
+	time.AfterFunc(interval, func() { s.flushLogs(format) })
+}
+
+// flushLogs reports the messages of the kind format suppressed during the last
+// interval, and keeps suppressing them for another one if there were any.
+func (s *Server) flushLogs(format string) {
+	a := &s.logs
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	kind := a.kinds[format]
+	if kind.suppressed == 0 {
+		delete(a.kinds, format)
+		return
+	}
+
+	s.output(fmt.Sprintf("%s (%d similar messages suppressed in the last %s)",
+		kind.last, kind.suppressed, time.Since(kind.since).Round(time.Millisecond)))
+
+	kind.since, kind.suppressed = time.Now(), 0
+	time.AfterFunc(s.errorLogInterval(), func() { s.flushLogs(format) })
+}
+
+func (s *Server) output(msg string) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Print(msg)
+		return
+	}
+
+	log.Print(msg)
+}
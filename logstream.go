@@ -0,0 +1,102 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// MetaStreamLogs is the meta key asking a service registered with
+// WithLogStreaming to stream the log lines of the call back, see
+// Client.CallWithLogs.
+const MetaStreamLogs = "stream-logs"
+
+// logLine is the progress value carrying a log line.
+type logLine struct {
+	Log string `json:"log"`
+}
+
+type streamLogsKey struct{}
+
+// WithLogStreaming lets the callers of the service's methods ask for the lines
+// the handlers log with Logf, sent back as progress of the call while it runs.
+// It suits operational methods whose output a user waits for.
+func WithLogStreaming() ServiceOption {
+	return func(opts *serviceOptions) {
+		opts.streamLogs = true
+	}
+}
+
+// streamLogsInterceptor marks the context of the calls asking for their logs.
+func streamLogsInterceptor(ctx context.Context, req *Request, next Handler) (*Response, error) {
+	if req.Meta[MetaStreamLogs] != "" && !req.notification {
+		ctx = context.WithValue(ctx, streamLogsKey{}, true)
+	}
+	return next(ctx, req)
+}
+
+// Logf logs a line for the request a context-aware handler is serving, to the
+// server's ErrorLog along with the method name, and to the caller if it asked
+// for the logs of the call, see WithLogStreaming.
+func Logf(ctx context.Context, format string, args ...interface{}) {
+	line := fmt.Sprintf(format, args...)
+
+	conn, ok := ConnectionFromContext(ctx)
+	req, _ := ctx.Value(requestKey{}).(*Request)
+	if !ok || req == nil {
+		log.Print(line)
+		return
+	}
+
+	conn.s.output(fmt.Sprintf("%s: %s", req.Method, line))
+
+	if streaming, _ := ctx.Value(streamLogsKey{}).(bool); streaming {
+		_ = Progress(ctx, &logLine{Log: line})
+	}
+}
+
+// LoggerFromContext returns a logger writing each line with Logf, for code
+// logging through a *log.Logger.
+func LoggerFromContext(ctx context.Context) *log.Logger {
+	return log.New(logWriter{ctx}, "", 0)
+}
+
+type logWriter struct {
+	ctx context.Context
+}
+
+func (w logWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimSuffix(string(p), "\n"), "\n") {
+		Logf(w.ctx, "%s", line)
+	}
+	return len(p), nil
+}
+
+// CallWithLogs is like Call, calling logs with each line the handler logs with
+// Logf, for services registered with WithLogStreaming. logs runs on the
+// goroutine reading responses and must not block.
+func (c *Client) CallWithLogs(method string, in, out interface{}, logs func(line string)) (err error) {
+	newCall, err := c.parseCall(method, in)
+	if err != nil {
+		return
+	}
+
+	newCall.meta = map[string]string{MetaStreamLogs: "1"}
+	newCall.progress = logProgress(logs)
+
+	err = c.call(newCall, out)
+	return
+}
+
+// logProgress returns the progress callback passing the log lines of a call
+// to logs.
+func logProgress(logs func(line string)) func(value json.RawMessage) {
+	return func(value json.RawMessage) {
+		var l logLine
+		if json.Unmarshal(value, &l) == nil && firstByte(value) == '{' {
+			logs(l.Log)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package jsonrpc
+
+import (
+	"context"
+	"fmt"
+)
+
+// MetaFromContext returns the metadata sent with the request a context-aware
+// handler is serving. The map must not be modified.
+func MetaFromContext(ctx context.Context) map[string]string {
+	req, ok := ctx.Value(requestKey{}).(*Request)
+	if !ok {
+		return nil
+	}
+
+	return req.Meta
+}
+
+// CallWithMeta is like Call, sending meta along with the request.
+func (c *Client) CallWithMeta(method string, meta map[string]string, in, out interface{}) (err error) {
+	newCall, err := c.parseCall(method, in)
+	if err != nil {
+		return
+	}
+	newCall.meta = meta
+
+	err = c.call(newCall, out)
+	return
+}
+
+// MetaKey binds a request metadata entry to a context value, so that handlers
+// read things like a tenant id or a locale with ctx.Value and a typed key
+// rather than looking the entry up by name. See Server.ContextMeta and
+// Client.SetContextMeta.
+type MetaKey struct {
+	// Name is the key of the metadata entry.
+	Name string
+
+	// Key is the context key of the value, usually of an unexported type of
+	// the package defining it.
+	Key interface{}
+
+	// Parse converts the entry into the context value, which is the entry
+	// itself if Parse is nil. Requests whose entry doesn't parse fail with an
+	// invalid request error.
+	Parse func(entry string) (interface{}, error)
+
+	// Format converts the context value into the entry, with fmt.Sprint if
+	// Format is nil.
+	Format func(value interface{}) string
+}
+
+// contextMeta returns ctx with the values of the metadata entries of req that
+// keys bind.
+func contextMeta(ctx context.Context, keys []MetaKey, req *Request) (context.Context, error) {
+	for _, k := range keys {
+		entry, ok := req.Meta[k.Name]
+		if !ok {
+			continue
+		}
+
+		var value interface{} = entry
+		if k.Parse != nil {
+			var err error
+			if value, err = k.Parse(entry); err != nil {
+				return ctx, newError(CodeInvalidRequest, "invalid meta %s: %v", k.Name, err)
+			}
+		}
+
+		ctx = context.WithValue(ctx, k.Key, value)
+	}
+
+	return ctx, nil
+}
+
+// SetContextMeta sends the values ctx holds under the keys of keys as metadata
+// entries of the calls made with ctx, so that a handler calling other services
+// passes them on. Entries given explicitly, e.g. with CallWithMeta, take
+// precedence. It must be called before the first call.
+func (c *Client) SetContextMeta(keys ...MetaKey) {
+	c.contextMeta = keys
+}
+
+// withContextMeta returns meta with the entries of the values ctx holds under
+// the client's context keys added, copying it if any is.
+func (c *Client) withContextMeta(ctx context.Context, meta map[string]string) map[string]string {
+	copied := false
+	for _, k := range c.contextMeta {
+		value := ctx.Value(k.Key)
+		if value == nil {
+			continue
+		}
+
+		if _, ok := meta[k.Name]; ok {
+			continue
+		}
+
+		if !copied {
+			entries := make(map[string]string, len(meta)+len(c.contextMeta))
+			for name, entry := range meta {
+				entries[name] = entry
+			}
+			meta, copied = entries, true
+		}
+
+		if k.Format != nil {
+			meta[k.Name] = k.Format(value)
+		} else {
+			meta[k.Name] = fmt.Sprint(value)
+		}
+	}
+
+	return meta
+}
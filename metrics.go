@@ -0,0 +1,86 @@
+package jsonrpc
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultOtherLabel is the label reported for methods outside the allowlist.
+const defaultOtherLabel = "other"
+
+// MetricsRecorder receives one observation per handled call.
+type MetricsRecorder interface {
+	// ObserveCall is called once the call to method completed; err is the error
+	// sent to the client, if any. method is already bounded by the server's
+	// MethodLabels.
+	ObserveCall(method string, duration time.Duration, err error)
+}
+
+// MethodLabels bounds the cardinality of the method label reported to a
+// MetricsRecorder, so a client probing random method names can't create an
+// unbounded number of series.
+type MethodLabels struct {
+	// Allow lists the methods ("Service.Method") reported under their own name.
+	// When empty, the methods registered on the server are allowed.
+	Allow []string
+
+	// Other is the label of every other method, "other" if empty.
+	Other string
+
+	once    sync.Once
+	allowed map[string]bool
+}
+
+func (l *MethodLabels) label(s *Server, method string) string {
+	if l != nil && len(l.Allow) > 0 {
+		l.once.Do(func() {
+			l.allowed = make(map[string]bool, len(l.Allow))
+			for _, m := range l.Allow {
+				l.allowed[m] = true
+			}
+		})
+
+		if l.allowed[method] {
+			return method
+		}
+	} else if s.hasMethod(method) {
+		return method
+	}
+
+	if l != nil && l.Other != "" {
+		return l.Other
+	}
+	return defaultOtherLabel
+}
+
+// hasMethod reports whether method names a registered or built-in method.
+func (s *Server) hasMethod(method string) bool {
+	serviceName, methodName, ok := splitMethod(method)
+	if !ok {
+		return false
+	}
+
+	if serviceName == builtinService {
+		_, ok := builtinMethods[methodName]
+		return ok
+	}
+
+	s.services.RLock()
+	svc, ok := s.serviceMap[serviceName]
+	s.services.RUnlock()
+
+	if !ok {
+		return false
+	}
+
+	_, ok = svc.methodMap[methodName]
+	return ok
+}
+
+func (s *Server) observeCall(req *Request, start time.Time, resp *Response) {
+	if s.Metrics == nil {
+		return
+	}
+
+	s.Metrics.ObserveCall(s.MetricsLabels.label(s, req.Method), time.Since(start), resp.err)
+}
@@ -0,0 +1,103 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultMirrorQueueSize is the number of records a Mirror buffers before it
+// starts dropping them.
+const defaultMirrorQueueSize = 1024
+
+// MirrorRecord is a copy of one call published by a Mirror.
+type MirrorRecord struct {
+	Time     time.Time       `json:"time"`
+	Duration time.Duration   `json:"duration"`
+	Id       json.RawMessage `json:"id"`
+	Method   string          `json:"method"`
+	Param    json.RawMessage `json:"param,omitempty"`
+	Result   json.RawMessage `json:"result,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// Publisher delivers mirrored records to a message bus (Kafka, NATS, ...).
+type Publisher interface {
+	Publish(record *MirrorRecord) error
+}
+
+// Mirror publishes copies of the calls handled by a server, so analytics and
+// audit pipelines can consume RPC traffic. Records are published asynchronously
+// and dropped when the queue is full, so a slow bus never delays responses.
+type Mirror struct {
+	Publisher Publisher
+
+	// Sampler selects the calls to mirror; all calls are mirrored when nil.
+	Sampler Sampler
+
+	// Redact, if set, may scrub sensitive data from a record before it is
+	// published.
+	Redact func(record *MirrorRecord)
+
+	// OnError, if set, is called with errors returned by the Publisher.
+	OnError func(err error)
+
+	// QueueSize is the number of records buffered for publishing, 1024 if zero.
+	QueueSize int
+
+	once    sync.Once
+	queue   chan *MirrorRecord
+	dropped uint64
+}
+
+// Dropped returns the number of records dropped because the queue was full.
+func (m *Mirror) Dropped() uint64 {
+	return atomic.LoadUint64(&m.dropped)
+}
+
+func (m *Mirror) start() {
+	size := m.QueueSize
+	if size <= 0 {
+		size = defaultMirrorQueueSize
+	}
+
+	m.queue = make(chan *MirrorRecord, size)
+	go m.loop()
+}
+
+func (m *Mirror) loop() {
+	for record := range m.queue {
+		if err := m.Publisher.Publish(record); err != nil && m.OnError != nil {
+			m.OnError(err)
+		}
+	}
+}
+
+func (m *Mirror) record(req *Request, resp *Response) {
+	if m.Sampler != nil && !m.Sampler.ShouldSample(req) {
+		return
+	}
+
+	m.once.Do(m.start)
+
+	record := &MirrorRecord{
+		Time:     req.received,
+		Duration: time.Since(req.received),
+		Id:       resp.Id,
+		Method:   req.Method,
+		Param:    req.Param,
+		Result:   resp.Result,
+		Error:    resp.Error,
+	}
+
+	if m.Redact != nil {
+		m.Redact(record)
+	}
+
+	select {
+	case m.queue <- record:
+	default:
+		atomic.AddUint64(&m.dropped, 1)
+	}
+}
@@ -0,0 +1,477 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxFrameDepth bounds the nesting of the arrays and maps of a binary frame.
+const maxFrameDepth = 10000
+
+// MessagePackCodec reads and writes frames in MessagePack, a binary form of
+// JSON sparing the quotes, separators and text-encoded numbers, for servers
+// and clients using it on both ends:
+//
+//	s.Codec = jsonrpc.NewMessagePackCodec
+//	c, err := jsonrpc.DialContext(ctx, addr, jsonrpc.WithCodec(jsonrpc.NewMessagePackCodec))
+//
+// Frames are written straight from their Go values, following the rules of
+// encoding/json, byte slices being sent as MessagePack binary rather than
+// base64 strings. Clients hand the codec the params of JSON-RPC 2.0 calls
+// unencoded, and the server the results of handlers unless something needs
+// them as JSON, see Server.Codec. Values already encoded as JSON, such as a
+// json.RawMessage, are translated. Frames are read as JSON, which the
+// connection parses: binary values received are read as base64 strings,
+// which decode into []byte, and timestamps as RFC 3339 strings. Frames don't
+// carry checksums.
+type MessagePackCodec struct {
+	Conn   net.Conn
+	reader *bufio.Reader
+	out    bytes.Buffer
+	in     bytes.Buffer
+}
+
+// NewMessagePackCodec returns a MessagePackCodec reading and writing conn.
+func NewMessagePackCodec(conn net.Conn) Codec {
+	return &MessagePackCodec{
+		Conn:   conn,
+		reader: bufio.NewReader(conn),
+	}
+}
+
+func (codec *MessagePackCodec) Encode(input interface{}) error {
+	codec.out.Reset()
+	if err := writeBinary(&codec.out, messagePackFormat{}, reflect.ValueOf(input), 0); err != nil {
+		return fmt.Errorf("msgpack: %w", err)
+	}
+
+	_, err := codec.Conn.Write(codec.out.Bytes())
+	return err
+}
+
+func (codec *MessagePackCodec) encodeBinary(v interface{}) (encodedValue, error) {
+	var buf bytes.Buffer
+	if err := writeBinary(&buf, messagePackFormat{}, reflect.ValueOf(v), 0); err != nil {
+		return nil, fmt.Errorf("msgpack: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (codec *MessagePackCodec) Decode(output interface{}) error {
+	if _, err := codec.reader.Peek(1); err != nil {
+		return err
+	}
+
+	codec.in.Reset()
+	if err := readMessagePack(codec.reader, &codec.in, 0); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	frame := append(json.RawMessage(nil), codec.in.Bytes()...)
+	if out, ok := output.(*json.RawMessage); ok {
+		*out = frame
+		return nil
+	}
+	return json.Unmarshal(frame, output)
+}
+
+// messagePackFormat writes MessagePack items.
+type messagePackFormat struct{}
+
+func (messagePackFormat) writeNull(buf *bytes.Buffer) {
+	buf.WriteByte(0xc0)
+}
+
+func (messagePackFormat) writeBool(buf *bytes.Buffer, b bool) {
+	if b {
+		buf.WriteByte(0xc3)
+	} else {
+		buf.WriteByte(0xc2)
+	}
+}
+
+func (messagePackFormat) writeInt(buf *bytes.Buffer, i int64) {
+	switch {
+	case i >= 0 && i <= math.MaxInt8:
+		buf.WriteByte(byte(i))
+	case i >= 0:
+		writeMessagePackUint(buf, uint64(i))
+	case i >= -32:
+		buf.WriteByte(byte(int8(i)))
+	case i >= math.MinInt8:
+		buf.Write([]byte{0xd0, byte(int8(i))})
+	case i >= math.MinInt16:
+		buf.WriteByte(0xd1)
+		writeBigEndian(buf, uint64(i), 2)
+	case i >= math.MinInt32:
+		buf.WriteByte(0xd2)
+		writeBigEndian(buf, uint64(i), 4)
+	default:
+		buf.WriteByte(0xd3)
+		writeBigEndian(buf, uint64(i), 8)
+	}
+}
+
+func (messagePackFormat) writeUint(buf *bytes.Buffer, u uint64) {
+	if u <= math.MaxInt8 {
+		buf.WriteByte(byte(u))
+		return
+	}
+	writeMessagePackUint(buf, u)
+}
+
+func (messagePackFormat) writeFloat(buf *bytes.Buffer, f float64, bits int) {
+	if bits == 32 {
+		buf.WriteByte(0xca)
+		writeBigEndian(buf, uint64(math.Float32bits(float32(f))), 4)
+		return
+	}
+
+	buf.WriteByte(0xcb)
+	writeBigEndian(buf, math.Float64bits(f), 8)
+}
+
+func (format messagePackFormat) writeNumber(buf *bytes.Buffer, n json.Number) error {
+	integer := !strings.ContainsAny(string(n), ".eE")
+
+	if i, err := strconv.ParseInt(string(n), 10, 64); integer && err == nil {
+		format.writeInt(buf, i)
+		return nil
+	}
+
+	if u, err := strconv.ParseUint(string(n), 10, 64); integer && err == nil {
+		format.writeUint(buf, u)
+		return nil
+	}
+
+	f, err := strconv.ParseFloat(string(n), 64)
+	if err != nil {
+		return fmt.Errorf("number %s out of range", n)
+	}
+
+	format.writeFloat(buf, f, 64)
+	return nil
+}
+
+func (messagePackFormat) writeString(buf *bytes.Buffer, s string) {
+	writeMessagePackHeader(buf, len(s), 0xa0, 32, 0xd9, 0xda, 0xdb)
+	buf.WriteString(s)
+}
+
+func (messagePackFormat) writeText(buf *bytes.Buffer, text []byte) {
+	writeMessagePackHeader(buf, len(text), 0xa0, 32, 0xd9, 0xda, 0xdb)
+	buf.Write(text)
+}
+
+func (messagePackFormat) writeBytes(buf *bytes.Buffer, b []byte) {
+	switch {
+	case len(b) <= math.MaxUint8:
+		buf.Write([]byte{0xc4, byte(len(b))})
+	case len(b) <= math.MaxUint16:
+		buf.WriteByte(0xc5)
+		writeBigEndian(buf, uint64(len(b)), 2)
+	default:
+		buf.WriteByte(0xc6)
+		writeBigEndian(buf, uint64(len(b)), 4)
+	}
+	buf.Write(b)
+}
+
+func (messagePackFormat) writeArray(buf *bytes.Buffer, n int) {
+	writeMessagePackHeader(buf, n, 0x90, 16, 0, 0xdc, 0xdd)
+}
+
+func (messagePackFormat) writeMap(buf *bytes.Buffer, n int) {
+	writeMessagePackHeader(buf, n, 0x80, 16, 0, 0xde, 0xdf)
+}
+
+// writeMessagePackHeader writes the type and length of a string, array or map
+// of n elements: fixed in the low bits of fixed if n is below fixedMax, then
+// coded on 8 bits (if code8 isn't zero), 16 or 32 bits.
+func writeMessagePackHeader(buf *bytes.Buffer, n int, fixed byte, fixedMax int, code8, code16, code32 byte) {
+	switch {
+	case n < fixedMax:
+		buf.WriteByte(fixed | byte(n))
+	case code8 != 0 && n <= math.MaxUint8:
+		buf.Write([]byte{code8, byte(n)})
+	case n <= math.MaxUint16:
+		buf.WriteByte(code16)
+		writeBigEndian(buf, uint64(n), 2)
+	default:
+		buf.WriteByte(code32)
+		writeBigEndian(buf, uint64(n), 4)
+	}
+}
+
+func writeMessagePackUint(buf *bytes.Buffer, u uint64) {
+	switch {
+	case u <= math.MaxUint8:
+		buf.Write([]byte{0xcc, byte(u)})
+	case u <= math.MaxUint16:
+		buf.WriteByte(0xcd)
+		writeBigEndian(buf, u, 2)
+	case u <= math.MaxUint32:
+		buf.WriteByte(0xce)
+		writeBigEndian(buf, u, 4)
+	default:
+		buf.WriteByte(0xcf)
+		writeBigEndian(buf, u, 8)
+	}
+}
+
+// writeBigEndian writes the size low bytes of u, most significant first.
+func writeBigEndian(buf *bytes.Buffer, u uint64, size int) {
+	for i := size - 1; i >= 0; i-- {
+		buf.WriteByte(byte(u >> (8 * uint(i))))
+	}
+}
+
+// malformedMessagePack returns an error wrapping ErrMalformedFrame.
+func malformedMessagePack(format string, args ...interface{}) error {
+	return fmt.Errorf("msgpack: %s: %w", fmt.Sprintf(format, args...), ErrMalformedFrame)
+}
+
+// readMessagePack reads the next value of r and writes it as JSON to out,
+// depth being the number of arrays and maps it is nested in.
+func readMessagePack(r *bufio.Reader, out *bytes.Buffer, depth int) error {
+	if depth > maxFrameDepth {
+		return malformedMessagePack("exceeded max depth")
+	}
+
+	code, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case code <= 0x7f:
+		out.WriteString(strconv.Itoa(int(code)))
+		return nil
+	case code >= 0xe0:
+		out.WriteString(strconv.Itoa(int(int8(code))))
+		return nil
+	case code&0xe0 == 0xa0:
+		return readMessagePackString(r, out, int(code&0x1f))
+	case code&0xf0 == 0x90:
+		return readMessagePackArray(r, out, int(code&0x0f), depth)
+	case code&0xf0 == 0x80:
+		return readMessagePackMap(r, out, int(code&0x0f), depth)
+	}
+
+	switch code {
+	case 0xc0:
+		out.WriteString("null")
+	case 0xc2:
+		out.WriteString("false")
+	case 0xc3:
+		out.WriteString("true")
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := readBigEndian(r, 1<<(code-0xcc))
+		if err != nil {
+			return err
+		}
+		out.WriteString(strconv.FormatUint(u, 10))
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (code - 0xd0)
+		u, err := readBigEndian(r, size)
+		if err != nil {
+			return err
+		}
+		// sign-extend the size bytes read
+		shift := uint(64 - 8*size)
+		out.WriteString(strconv.FormatInt(int64(u<<shift)>>shift, 10))
+	case 0xca, 0xcb:
+		// floats are written with the precision they were sent with
+		var f interface{}
+		if code == 0xca {
+			u, err := readBigEndian(r, 4)
+			if err != nil {
+				return err
+			}
+			f = math.Float32frombits(uint32(u))
+		} else {
+			u, err := readBigEndian(r, 8)
+			if err != nil {
+				return err
+			}
+			f = math.Float64frombits(u)
+		}
+		b, err := json.Marshal(f)
+		if err != nil {
+			return malformedMessagePack("unsupported float %v", f)
+		}
+		out.Write(b)
+	case 0xd9, 0xda, 0xdb:
+		n, err := readBigEndian(r, 1<<(code-0xd9))
+		if err != nil {
+			return err
+		}
+		return readMessagePackString(r, out, int(n))
+	case 0xc4, 0xc5, 0xc6:
+		n, err := readBigEndian(r, 1<<(code-0xc4))
+		if err != nil {
+			return err
+		}
+		data, err := readBytes(r, int(n))
+		if err != nil {
+			return err
+		}
+		out.WriteByte('"')
+		out.WriteString(base64.StdEncoding.EncodeToString(data))
+		out.WriteByte('"')
+	case 0xdc, 0xdd:
+		n, err := readBigEndian(r, 2<<(code-0xdc))
+		if err != nil {
+			return err
+		}
+		return readMessagePackArray(r, out, int(n), depth)
+	case 0xde, 0xdf:
+		n, err := readBigEndian(r, 2<<(code-0xde))
+		if err != nil {
+			return err
+		}
+		return readMessagePackMap(r, out, int(n), depth)
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return readMessagePackExt(r, out, 1<<(code-0xd4))
+	case 0xc7, 0xc8, 0xc9:
+		n, err := readBigEndian(r, 1<<(code-0xc7))
+		if err != nil {
+			return err
+		}
+		return readMessagePackExt(r, out, int(n))
+	default:
+		return malformedMessagePack("invalid code 0x%02x", code)
+	}
+
+	return nil
+}
+
+// readBigEndian reads a big-endian unsigned integer of size bytes.
+func readBigEndian(r *bufio.Reader, size int) (u uint64, err error) {
+	for i := 0; i < size; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		u = u<<8 | uint64(b)
+	}
+	return
+}
+
+// readBytes reads n bytes, growing the buffer as they arrive rather
+// than trusting n.
+func readBytes(r *bufio.Reader, n int) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, r, int64(n)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func readMessagePackString(r *bufio.Reader, out *bytes.Buffer, n int) error {
+	data, err := readBytes(r, n)
+	if err != nil {
+		return err
+	}
+
+	b, _ := json.Marshal(string(data))
+	out.Write(b)
+	return nil
+}
+
+func readMessagePackArray(r *bufio.Reader, out *bytes.Buffer, n int, depth int) error {
+	out.WriteByte('[')
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			out.WriteByte(',')
+		}
+		if err := readMessagePack(r, out, depth+1); err != nil {
+			return err
+		}
+	}
+	out.WriteByte(']')
+	return nil
+}
+
+// readMessagePackMap reads a map of n pairs, whose keys must be strings or
+// integers.
+func readMessagePackMap(r *bufio.Reader, out *bytes.Buffer, n int, depth int) error {
+	out.WriteByte('{')
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			out.WriteByte(',')
+		}
+
+		start := out.Len()
+		if err := readMessagePack(r, out, depth+1); err != nil {
+			return err
+		}
+
+		switch key := out.Bytes()[start:]; {
+		case firstByte(key) == '"':
+		case firstByte(key) == '-' || firstByte(key) >= '0' && firstByte(key) <= '9':
+			quoted := strconv.Quote(string(key))
+			out.Truncate(start)
+			out.WriteString(quoted)
+		default:
+			return malformedMessagePack("map key %s is not a string", key)
+		}
+
+		out.WriteByte(':')
+		if err := readMessagePack(r, out, depth+1); err != nil {
+			return err
+		}
+	}
+	out.WriteByte('}')
+	return nil
+}
+
+// readMessagePackExt reads an extension value of n bytes, of which only
+// timestamps are known.
+func readMessagePackExt(r *bufio.Reader, out *bytes.Buffer, n int) error {
+	typ, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+
+	data, err := readBytes(r, n)
+	if err != nil {
+		return err
+	}
+
+	if int8(typ) != -1 {
+		return malformedMessagePack("unsupported extension type %d", int8(typ))
+	}
+
+	var t time.Time
+	switch n {
+	case 4:
+		t = time.Unix(int64(binary.BigEndian.Uint32(data)), 0)
+	case 8:
+		u := binary.BigEndian.Uint64(data)
+		t = time.Unix(int64(u&(1<<34-1)), int64(u>>34))
+	case 12:
+		t = time.Unix(int64(binary.BigEndian.Uint64(data[4:])), int64(binary.BigEndian.Uint32(data)))
+	default:
+		return malformedMessagePack("invalid timestamp length %d", n)
+	}
+
+	out.WriteByte('"')
+	out.WriteString(t.UTC().Format(time.RFC3339Nano))
+	out.WriteByte('"')
+	return nil
+}
@@ -0,0 +1,109 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type label struct{ id int }
+
+func (l label) MarshalText() ([]byte, error) {
+	return []byte{'L', byte('0' + l.id)}, nil
+}
+
+type inner struct {
+	X int `json:"x,omitempty"`
+	Y string
+}
+
+type record struct {
+	*inner
+	A int               `json:"a"`
+	B []byte            `json:"b"`
+	C map[string]int    `json:"c"`
+	D interface{}       `json:"d"`
+	E *int              `json:"e,omitempty"`
+	G json.RawMessage   `json:"g"`
+	H time.Time         `json:"h"`
+	J float32           `json:"j"`
+	K int64             `json:"k,string"`
+	M map[int]string    `json:"m"`
+	N json.Number       `json:"n"`
+	P map[label]bool    `json:"p"`
+	Q [3]uint8          `json:"q"`
+	R []label           `json:"r"`
+	S string            `json:"-"`
+	U uint64            `json:"u"`
+	W map[string]string `json:"w,omitempty"`
+}
+
+// binaryValues are encoded by the binary codecs as encoding/json does.
+func binaryValues() []interface{} {
+	return []interface{}{
+		nil, 1, -200, 1 << 40, "héllo", []byte{1, 2, 3}, 1.5, true,
+		map[string]interface{}{"a": []interface{}{1, "x", nil, map[string]int{}}},
+		&record{
+			inner: &inner{Y: "inner"},
+			A:     1,
+			B:     []byte("abc"),
+			C:     map[string]int{"z": 1, "a": 2},
+			D:     []int{1, 2},
+			G:     json.RawMessage(` {"k" : [1, 2.5e3, "a\"bé", true, null, {}], "e":[]} `),
+			H:     time.Date(2020, 1, 2, 3, 4, 5, 6, time.FixedZone("x", 3600)),
+			J:     0.1,
+			K:     42,
+			M:     map[int]string{3: "c", 10: "x"},
+			N:     "12.5",
+			P:     map[label]bool{{1}: true},
+			Q:     [3]uint8{1, 2, 3},
+			R:     []label{{2}},
+			U:     1 << 63,
+		},
+		record{},
+	}
+}
+
+func TestMessagePackMatchesJSON(t *testing.T) {
+	for _, v := range binaryValues() {
+		want, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		if err := writeBinary(&buf, messagePackFormat{}, reflect.ValueOf(v), 0); err != nil {
+			t.Fatalf("%s: %v", want, err)
+		}
+
+		var got bytes.Buffer
+		if err := readMessagePack(bufio.NewReader(&buf), &got, 0); err != nil {
+			t.Fatalf("%s: %v", want, err)
+		}
+
+		var a, b interface{}
+		if err := json.Unmarshal(want, &a); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(got.Bytes(), &b); err != nil {
+			t.Fatalf("%s: %v", got.Bytes(), err)
+		}
+		if !reflect.DeepEqual(a, b) {
+			t.Errorf("got %s, want %s", got.Bytes(), want)
+		}
+	}
+}
+
+func TestMessagePackBytesAsBin(t *testing.T) {
+	encoded, err := (&MessagePackCodec{}).encodeBinary([]byte{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []byte{0xc4, 2, 1, 2}; !bytes.Equal(encoded, want) {
+		t.Errorf("got % x, want % x", encoded, want)
+	}
+}
@@ -0,0 +1,224 @@
+package jsonrpc
+
+import (
+	"reflect"
+	"sync"
+	"time"
+)
+
+// negotiableFormats are the scalar formats a client can adopt from the names
+// a server reports, by type and format name.
+var negotiableFormats = map[string]map[string]scalarFormatOf{
+	"time.Time": {
+		TimeRFC3339.Name:    {time.Time{}, TimeRFC3339},
+		TimeUnixMillis.Name: {time.Time{}, TimeUnixMillis},
+	},
+	"time.Duration": {
+		DurationMillis.Name: {time.Duration(0), DurationMillis},
+		DurationString.Name: {time.Duration(0), DurationString},
+	},
+	"int64": {
+		Int64String.Name: {int64(0), Int64String},
+	},
+	"uint64": {
+		Uint64String.Name: {uint64(0), Uint64String},
+	},
+	"[]uint8": {
+		BytesHex.Name:       {[]byte(nil), BytesHex},
+		BytesBase64URL.Name: {[]byte(nil), BytesBase64URL},
+	},
+}
+
+type scalarFormatOf struct {
+	example interface{}
+	format  ScalarFormat
+}
+
+// Negotiate asks the server for its rpc.info and adapts the client to it, so
+// that one application can talk to old and new servers alike: requests are
+// sent in the protocol the server speaks, or the first one it answered if it
+// detects the protocol, and times, durations, byte slices and 64-bit integers
+// in the predefined formats it reports. Formats the server doesn't report are
+// kept. It must be called before other calls, and fails against servers
+// without rpc.info, leaving the client as it was.
+//
+// rpc.info is asked in the client's protocol first, then in the others until
+// the server understands one.
+func (c *Client) Negotiate() (info *ServerInfo, err error) {
+	c.reqMutex.Lock()
+	initial := c.protocol
+	c.reqMutex.Unlock()
+
+	for i, p := range []Protocol{initial, ProtocolJSONRPC2, ProtocolLegacy, ProtocolJSONRPC1} {
+		if i > 0 && p == initial {
+			continue
+		}
+
+		c.SetProtocol(p)
+		info = &ServerInfo{}
+		if err = c.Call(builtinService+".info", nil, info); err == nil {
+			break
+		}
+	}
+
+	if err != nil {
+		c.SetProtocol(initial)
+		return nil, err
+	}
+
+	// servers detecting the protocol report the one the connection started
+	// with, the one rpc.info was answered in
+	switch info.ProtocolVersion {
+	case ProtocolLegacy.String():
+		c.SetProtocol(ProtocolLegacy)
+	case ProtocolJSONRPC1.String():
+		c.SetProtocol(ProtocolJSONRPC1)
+	case ProtocolJSONRPC2.String():
+		c.SetProtocol(ProtocolJSONRPC2)
+	}
+
+	if scalars := c.negotiatedScalars(info.Scalars); scalars != nil {
+		c.SetScalars(scalars)
+	}
+
+	c.m.Lock()
+	c.info = info
+	c.m.Unlock()
+	return
+}
+
+// ServerInfo returns the server info recorded by the last successful
+// Negotiate, nil if there was none.
+func (c *Client) ServerInfo() *ServerInfo {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.info
+}
+
+// negotiatedScalars returns the client's scalars with the formats the server
+// reports in formats, nil if they bring nothing new.
+func (c *Client) negotiatedScalars(formats map[string]string) *Scalars {
+	scalars := copyScalars(c.scalars)
+
+	changed := false
+	for typeName, name := range formats {
+		if known, ok := negotiableFormats[typeName][name]; ok {
+			t := reflect.TypeOf(known.example)
+			if current, ok := scalars.formats[t]; !ok || current.Name != name {
+				scalars.Set(known.example, known.format)
+				changed = true
+			}
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+	return scalars
+}
+
+// copyScalars returns a Scalars with the formats of s, which may be nil.
+func copyScalars(s *Scalars) *Scalars {
+	scalars := NewScalars()
+	if s != nil {
+		for t, f := range s.formats {
+			scalars.formats[t] = f
+		}
+		scalars.fieldCase = s.fieldCase
+	}
+	return scalars
+}
+
+// scalarsParams are the params of rpc.scalars.
+type scalarsParams struct {
+	Formats map[string]string `json:"formats"`
+}
+
+// connScalars holds the formats a connection was asked to use with
+// rpc.scalars.
+type connScalars struct {
+	m       sync.RWMutex
+	scalars *Scalars
+}
+
+// scalars returns the formats of values on the connection: the server's
+// unless the client asked for others with rpc.scalars.
+func (conn *Connection) scalars() *Scalars {
+	conn.formats.m.RLock()
+	defer conn.formats.m.RUnlock()
+
+	if conn.formats.scalars != nil {
+		return conn.formats.scalars
+	}
+	if conn.s.Scalars != nil {
+		return conn.s.Scalars
+	}
+	return noScalars
+}
+
+// noScalars are the formats of connections whose server has none, never
+// modified.
+var noScalars = NewScalars()
+
+// scalarsOf returns the formats of the values of req, those in effect when it
+// was read.
+func (conn *Connection) scalarsOf(req *Request) *Scalars {
+	if req.scalars != nil {
+		return req.scalars
+	}
+	return conn.scalars()
+}
+
+// scalarsMethod is the built-in method negotiating the formats of a
+// connection.
+const scalarsMethod = builtinService + ".scalars"
+
+// scalarsBuiltin implements rpc.scalars, making the connection use the
+// predefined formats the client names by type, e.g. {"int64": "string"}, on
+// top of the server's. It returns the formats now in use.
+//
+// The formats apply to the frames read after the rpc.scalars request: those
+// pipelined before it was answered included, those read before it not,
+// even if they are still running. rpc.scalars can't be sent in a batch.
+func (conn *Connection) scalarsBuiltin(req *Request) (interface{}, error) {
+	var p scalarsParams
+	if err := decodeParams(req.Param, &p); err != nil || len(p.Formats) == 0 {
+		return nil, newError(CodeInvalidParams, "invalid params: expected {\"formats\": {<type>: <format>}}")
+	}
+
+	conn.formats.m.Lock()
+	defer conn.formats.m.Unlock()
+
+	current := conn.formats.scalars
+	if current == nil {
+		current = conn.s.Scalars
+	}
+
+	scalars := copyScalars(current)
+	for typeName, name := range p.Formats {
+		known, ok := negotiableFormats[typeName][name]
+		if !ok {
+			return nil, newError(CodeInvalidParams, "unknown format %q for %s", name, typeName)
+		}
+		scalars.Set(known.example, known.format)
+	}
+
+	conn.formats.scalars = scalars
+	return scalars.Formats(), nil
+}
+
+// RequestScalars asks the server to encode the values of this connection in
+// the predefined formats named by type, e.g. {"int64": "string"} for
+// Int64String, and uses them for the client's own values too. It must be
+// called before other calls.
+func (c *Client) RequestScalars(formats map[string]string) (err error) {
+	var accepted map[string]string
+	if err = c.Call(scalarsMethod, &scalarsParams{Formats: formats}, &accepted); err != nil {
+		return
+	}
+
+	if scalars := c.negotiatedScalars(accepted); scalars != nil {
+		c.SetScalars(scalars)
+	}
+	return
+}
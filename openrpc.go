@@ -0,0 +1,511 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// openRPCHeader starts the files generated from OpenRPC documents.
+const openRPCHeader = "Code generated from an OpenRPC document. DO NOT EDIT."
+
+// OpenRPC is an OpenRPC document describing a JSON-RPC API, read with
+// ReadOpenRPC, from which Go code can be generated to call or implement the
+// API.
+type OpenRPC struct {
+	Title   string
+	Version string
+
+	methods     []*openRPCMethod
+	schemas     map[string]*jsonSchema
+	descriptors map[string]*openRPCContent
+}
+
+type openRPCDocument struct {
+	OpenRPC string `json:"openrpc"`
+	Info    struct {
+		Title   string `json:"title"`
+		Version string `json:"version"`
+	} `json:"info"`
+	Methods    []*openRPCMethod `json:"methods"`
+	Components struct {
+		Schemas            map[string]*jsonSchema     `json:"schemas"`
+		ContentDescriptors map[string]*openRPCContent `json:"contentDescriptors"`
+	} `json:"components"`
+}
+
+type openRPCMethod struct {
+	Name           string            `json:"name"`
+	Summary        string            `json:"summary"`
+	Description    string            `json:"description"`
+	Params         []*openRPCContent `json:"params"`
+	Result         *openRPCContent   `json:"result"`
+	ParamStructure string            `json:"paramStructure"`
+}
+
+// openRPCContent is a content descriptor, describing a param or a result.
+type openRPCContent struct {
+	Ref         string      `json:"$ref"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Required    bool        `json:"required"`
+	Schema      *jsonSchema `json:"schema"`
+}
+
+// jsonSchema is the subset of JSON Schema mapped to Go types.
+type jsonSchema struct {
+	Ref                  string                 `json:"$ref"`
+	Type                 schemaTypes            `json:"type"`
+	Format               string                 `json:"format"`
+	Description          string                 `json:"description"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	Items                json.RawMessage        `json:"items"`
+	AdditionalProperties json.RawMessage        `json:"additionalProperties"`
+	OneOf                []*jsonSchema          `json:"oneOf"`
+	AnyOf                []*jsonSchema          `json:"anyOf"`
+	AllOf                []*jsonSchema          `json:"allOf"`
+}
+
+// schemaTypes are the types of a schema, given as a string or an array.
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	if firstByte(data) == '[' {
+		return json.Unmarshal(data, (*[]string)(t))
+	}
+
+	var one string
+	if err := json.Unmarshal(data, &one); err != nil {
+		return err
+	}
+	*t = schemaTypes{one}
+	return nil
+}
+
+// ReadOpenRPC reads an OpenRPC document, such as one written by another team
+// or for a server in another language.
+func ReadOpenRPC(r io.Reader) (*OpenRPC, error) {
+	var doc openRPCDocument
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("openrpc: %v", err)
+	}
+
+	if doc.OpenRPC == "" {
+		return nil, fmt.Errorf("openrpc: not an OpenRPC document, the openrpc member is missing")
+	}
+
+	return &OpenRPC{
+		Title:       doc.Info.Title,
+		Version:     doc.Info.Version,
+		methods:     doc.Methods,
+		schemas:     doc.Components.Schemas,
+		descriptors: doc.Components.ContentDescriptors,
+	}, nil
+}
+
+// goGenerator writes the Go code of an OpenRPC document.
+type goGenerator struct {
+	doc *OpenRPC
+	out bytes.Buffer
+
+	// Go names of the component schemas, and the type names taken
+	typeNames map[string]string
+	taken     map[string]bool
+
+	usesTime bool
+}
+
+// WriteGo writes a Go file of package pkg implementing the API of doc with
+// this package: a type per component schema, a params type per method, and
+// per service a typed client and an interface for the receivers serving it,
+// with the function registering them:
+//
+//	users := api.NewUserClient(c)
+//	user, err := users.Get(ctx, api.UserGetParams{ID: 7})
+//
+//	err = api.RegisterUserService(s, &userService{})
+//
+// Methods are grouped into services by the name before their last dot. The
+// methods whose name has no dot can't be served nor called by this package,
+// they are listed in a comment of the file.
+func (doc *OpenRPC) WriteGo(w io.Writer, pkg string) error {
+	g := &goGenerator{
+		doc:       doc,
+		typeNames: make(map[string]string),
+		taken:     make(map[string]bool),
+	}
+
+	var body bytes.Buffer
+	g.writeTo(&body)
+
+	fmt.Fprintf(&g.out, "// %s\n\n", openRPCHeader)
+	fmt.Fprintf(&g.out, "package %s\n\n", pkg)
+	fmt.Fprintf(&g.out, "import (\n\t\"context\"\n")
+	if g.usesTime {
+		fmt.Fprintf(&g.out, "\t\"time\"\n")
+	}
+	fmt.Fprintf(&g.out, "\n\t\"github.com/grearter/jsonrpc\"\n)\n")
+	g.out.Write(body.Bytes())
+
+	src, err := format.Source(g.out.Bytes())
+	if err != nil {
+		return fmt.Errorf("openrpc: formatting the generated code: %v", err)
+	}
+
+	_, err = w.Write(src)
+	return err
+}
+
+// openRPCService is a service of the document with its methods.
+type openRPCService struct {
+	name    string
+	goName  string
+	methods []*openRPCMethod
+}
+
+func (g *goGenerator) writeTo(out *bytes.Buffer) {
+	services := make(map[string]*openRPCService)
+	var skipped []string
+
+	for _, m := range g.doc.methods {
+		serviceName, _, ok := splitMethod(m.Name)
+		if !ok {
+			skipped = append(skipped, m.Name)
+			continue
+		}
+
+		svc, ok := services[serviceName]
+		if !ok {
+			svc = &openRPCService{name: serviceName}
+			services[serviceName] = svc
+		}
+		svc.methods = append(svc.methods, m)
+	}
+
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// the names of the component schemas are taken first so that they keep
+	// them
+	schemaNames := make([]string, 0, len(g.doc.schemas))
+	for name := range g.doc.schemas {
+		schemaNames = append(schemaNames, name)
+	}
+	sort.Strings(schemaNames)
+
+	for _, name := range schemaNames {
+		g.typeNames[name] = g.takeName(goIdentifier(name))
+	}
+	for _, name := range names {
+		svc := services[name]
+		svc.goName = goIdentifier(name)
+		for g.taken[svc.goName+"Client"] || g.taken[svc.goName+"Service"] {
+			svc.goName += "API"
+		}
+		g.takeName(svc.goName + "Client")
+		g.takeName(svc.goName + "Service")
+	}
+
+	if len(skipped) > 0 {
+		fmt.Fprintf(out, "\n// Methods not generated, their name has no service part: %s\n", strings.Join(skipped, ", "))
+	}
+
+	for _, name := range schemaNames {
+		schema := g.doc.schemas[name]
+		fmt.Fprintf(out, "\n")
+		writeGoComment(out, "", schema.Description)
+		if g.isStruct(schema) {
+			fmt.Fprintf(out, "type %s %s\n", g.typeNames[name], g.structType(schema))
+		} else {
+			fmt.Fprintf(out, "type %s %s\n", g.typeNames[name], g.goType(schema, false))
+		}
+	}
+
+	for _, name := range names {
+		g.writeService(out, services[name])
+	}
+}
+
+// takeName returns name, suffixed with a number if it is already taken.
+func (g *goGenerator) takeName(name string) string {
+	unique := name
+	for i := 2; g.taken[unique]; i++ {
+		unique = name + strconv.Itoa(i)
+	}
+
+	g.taken[unique] = true
+	return unique
+}
+
+func (g *goGenerator) writeService(out *bytes.Buffer, svc *openRPCService) {
+	type method struct {
+		*openRPCMethod
+		goName, params, result string
+	}
+
+	methods := make([]method, 0, len(svc.methods))
+	for _, m := range svc.methods {
+		_, methodName, _ := splitMethod(m.Name)
+		gm := method{openRPCMethod: m, goName: goIdentifier(methodName)}
+
+		gm.params = g.takeName(svc.goName + gm.goName + "Params")
+		fmt.Fprintf(out, "\n// %s are the params of %s.\n", gm.params, m.Name)
+		fmt.Fprintf(out, "type %s struct {\n", gm.params)
+		fields := make(map[string]bool)
+		for _, p := range m.Params {
+			p = g.content(p)
+			writeGoComment(out, "\t", p.Description)
+			tag := p.Name
+			if !p.Required {
+				tag += ",omitempty"
+			}
+			fmt.Fprintf(out, "\t%s %s `json:%q`\n", uniqueField(fields, goIdentifier(p.Name)), g.goType(p.Schema, !p.Required), tag)
+		}
+		fmt.Fprintf(out, "}\n")
+
+		gm.result = "struct{}"
+		if m.Result != nil {
+			gm.result = g.goType(g.content(m.Result).Schema, false)
+		}
+
+		methods = append(methods, gm)
+	}
+
+	fmt.Fprintf(out, "\n// %sService is implemented by the receivers serving %s, see\n// Register%sService.\n", svc.goName, svc.name, svc.goName)
+	fmt.Fprintf(out, "type %sService interface {\n", svc.goName)
+	for _, m := range methods {
+		writeGoComment(out, "\t", methodDoc(m.openRPCMethod))
+		fmt.Fprintf(out, "\t%s(ctx context.Context, params %s) (%s, error)\n", m.goName, m.params, m.result)
+	}
+	fmt.Fprintf(out, "}\n")
+
+	// the methods are registered one by one, under the names of the
+	// document rather than those of the Go methods
+	fmt.Fprintf(out, "\n// Register%[1]sService registers the methods of impl on s as the %[2]s service.\n", svc.goName, svc.name)
+	fmt.Fprintf(out, "func Register%sService(s *jsonrpc.Server, impl %sService, opts ...jsonrpc.ServiceOption) (err error) {\n", svc.goName, svc.goName)
+	for _, m := range methods {
+		fmt.Fprintf(out, "\tif err = s.RegisterFunc(%q, impl.%s, opts...); err != nil {\n\t\treturn\n\t}\n", m.Name, m.goName)
+	}
+	fmt.Fprintf(out, "\treturn\n}\n")
+
+	fmt.Fprintf(out, "\n// %sClient calls the methods of the %s service.\n", svc.goName, svc.name)
+	fmt.Fprintf(out, "type %sClient struct {\n\tc *jsonrpc.Client\n}\n", svc.goName)
+	fmt.Fprintf(out, "\nfunc New%[1]sClient(c *jsonrpc.Client) *%[1]sClient {\n\treturn &%[1]sClient{c: c}\n}\n", svc.goName)
+
+	for _, m := range methods {
+		fmt.Fprintf(out, "\n")
+		writeGoComment(out, "", methodDoc(m.openRPCMethod))
+		fmt.Fprintf(out, "func (c *%sClient) %s(ctx context.Context, params %s) (result %s, err error) {\n", svc.goName, m.goName, m.params, m.result)
+
+		args := "&params"
+		if m.ParamStructure == "by-position" {
+			fields := make(map[string]bool)
+			values := make([]string, 0, len(m.Params))
+			for _, p := range m.Params {
+				values = append(values, "params."+uniqueField(fields, goIdentifier(g.content(p).Name)))
+			}
+			args = "[]interface{}{" + strings.Join(values, ", ") + "}"
+		}
+
+		fmt.Fprintf(out, "\terr = c.c.CallContext(ctx, %q, %s, &result)\n\treturn\n}\n", m.Name, args)
+	}
+}
+
+// content resolves the reference to a content descriptor c may be.
+func (g *goGenerator) content(c *openRPCContent) *openRPCContent {
+	if c.Ref != "" {
+		if resolved, ok := g.doc.descriptors[strings.TrimPrefix(c.Ref, "#/components/contentDescriptors/")]; ok {
+			return resolved
+		}
+	}
+	return c
+}
+
+// isStruct reports whether values of schema are objects of known properties.
+func (g *goGenerator) isStruct(schema *jsonSchema) bool {
+	return schema.Ref == "" && len(schema.Properties) > 0 && len(schema.OneOf) == 0 && len(schema.AnyOf) == 0
+}
+
+func (g *goGenerator) structType(schema *jsonSchema) string {
+	required := make(map[string]bool)
+	for _, name := range schema.Required {
+		required[name] = true
+	}
+
+	names := make([]string, 0, len(schema.Properties))
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	fields := make(map[string]bool)
+	b.WriteString("struct {\n")
+	for _, name := range names {
+		property := schema.Properties[name]
+		writeGoComment(&b, "", property.Description)
+
+		tag := name
+		if !required[name] {
+			tag += ",omitempty"
+		}
+		fmt.Fprintf(&b, "%s %s `json:%q`\n", uniqueField(fields, goIdentifier(name)), g.goType(property, !required[name]), tag)
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// goType returns the Go type of the values of schema, a pointer for nullable
+// structs and optional ones.
+func (g *goGenerator) goType(schema *jsonSchema, optional bool) string {
+	if schema == nil {
+		return "interface{}"
+	}
+
+	if schema.Ref != "" {
+		name, ok := g.typeNames[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+		if !ok {
+			return "interface{}"
+		}
+		if target := g.doc.schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]; optional && g.isStruct(target) {
+			return "*" + name
+		}
+		return name
+	}
+
+	if len(schema.AllOf) == 1 {
+		return g.goType(schema.AllOf[0], optional)
+	}
+	if len(schema.OneOf) > 0 || len(schema.AnyOf) > 0 || len(schema.AllOf) > 0 {
+		return "interface{}"
+	}
+
+	var types []string
+	nullable := false
+	for _, t := range schema.Type {
+		if t == "null" {
+			nullable = true
+			continue
+		}
+		types = append(types, t)
+	}
+	if len(types) != 1 {
+		if len(types) == 0 && len(schema.Properties) > 0 {
+			types = []string{"object"}
+		} else {
+			return "interface{}"
+		}
+	}
+
+	var t string
+	switch types[0] {
+	case "boolean":
+		t = "bool"
+	case "integer":
+		t = "int64"
+	case "number":
+		t = "float64"
+	case "string":
+		switch schema.Format {
+		case "date-time":
+			g.usesTime = true
+			t = "time.Time"
+		case "byte":
+			return "[]byte"
+		default:
+			t = "string"
+		}
+	case "array":
+		var items *jsonSchema
+		if firstByte(schema.Items) == '{' {
+			_ = json.Unmarshal(schema.Items, &items)
+		}
+		return "[]" + g.goType(items, false)
+	case "object":
+		if g.isStruct(schema) {
+			t = g.structType(schema)
+			if optional || nullable {
+				t = "*" + t
+			}
+			return t
+		}
+
+		var values *jsonSchema
+		if firstByte(schema.AdditionalProperties) == '{' {
+			_ = json.Unmarshal(schema.AdditionalProperties, &values)
+		}
+		return "map[string]" + g.goType(values, false)
+	default:
+		return "interface{}"
+	}
+
+	if nullable {
+		t = "*" + t
+	}
+	return t
+}
+
+// methodDoc returns the description of m for its doc comment.
+func methodDoc(m *openRPCMethod) string {
+	if m.Description != "" {
+		return m.Description
+	}
+	return m.Summary
+}
+
+// writeGoComment writes text as a comment indented by indent.
+func writeGoComment(w io.Writer, indent, text string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		fmt.Fprintf(w, "%s// %s\n", indent, strings.TrimRight(line, " \t\r"))
+	}
+}
+
+// goIdentifier returns name as an exported Go identifier: user_id and user-id
+// become UserID, billing.v2 BillingV2.
+func goIdentifier(name string) string {
+	var b strings.Builder
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if strings.EqualFold(part, "id") {
+			part = "ID"
+		}
+		r, size := utf8.DecodeRuneInString(part)
+		b.WriteRune(unicode.ToUpper(r))
+		b.WriteString(part[size:])
+	}
+
+	ident := b.String()
+	if r, _ := utf8.DecodeRuneInString(ident); !unicode.IsUpper(r) {
+		ident = "X" + ident
+	}
+	return ident
+}
+
+// uniqueField returns name, suffixed with a number if fields has it already,
+// and adds it to fields.
+func uniqueField(fields map[string]bool, name string) string {
+	unique := name
+	for i := 2; fields[unique]; i++ {
+		unique = name + strconv.Itoa(i)
+	}
+
+	fields[unique] = true
+	return unique
+}
@@ -0,0 +1,128 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Default limits of CallAllPages.
+const (
+	defaultMaxPages = 1000
+	defaultMaxItems = 100000
+)
+
+var (
+	// ErrPageLimit is returned by CallAllPages when a listing has more pages or
+	// items than the client's PageLimits allow.
+	ErrPageLimit = errors.New("pagination limit exceeded")
+
+	// ErrCursorLoop is returned by CallAllPages when the server hands back a
+	// cursor it already returned.
+	ErrCursorLoop = errors.New("pagination cursor repeated")
+)
+
+// PageLimits bound the listings fetched by CallAllPages. Zero fields use the
+// defaults: 1000 pages and 100000 items.
+type PageLimits struct {
+	MaxPages int
+	MaxItems int
+}
+
+// SetPageLimits sets the limits enforced by CallAllPages.
+func (c *Client) SetPageLimits(limits PageLimits) {
+	c.pages = limits
+}
+
+func (l PageLimits) maxPages() int {
+	if l.MaxPages > 0 {
+		return l.MaxPages
+	}
+	return defaultMaxPages
+}
+
+func (l PageLimits) maxItems() int {
+	if l.MaxItems > 0 {
+		return l.MaxItems
+	}
+	return defaultMaxItems
+}
+
+// page is the result of a paginated method.
+type page struct {
+	Items      []json.RawMessage `json:"items"`
+	NextCursor string            `json:"nextCursor,omitempty"`
+}
+
+// CallAllPages calls a paginated method until it has returned every page,
+// handing the items of each page to appendFn as a JSON array. Paginated
+// methods take their params as an object whose "cursor" member, absent for the
+// first page, is the cursor returned with the previous page; they return an
+// object with the "items" of the page and the "nextCursor" of the next one,
+// empty after the last page.
+//
+// in, which must encode as a JSON object or be nil, is sent with every call.
+// Listings exceeding the client's PageLimits fail with ErrPageLimit once the
+// page over the limit is received; its items aren't handed to appendFn.
+func (c *Client) CallAllPages(ctx context.Context, method string, in interface{}, appendFn func(items json.RawMessage) error) (err error) {
+	params := make(map[string]json.RawMessage)
+	if in != nil {
+		data, err := c.scalars.marshal(in)
+		if err != nil {
+			return err
+		}
+
+		if err = json.Unmarshal(data, &params); err != nil {
+			return fmt.Errorf("paginated params must be an object: %v", err)
+		}
+	}
+
+	seen := make(map[string]bool)
+	total := 0
+
+	for pages := 1; ; pages++ {
+		if pages > c.pages.maxPages() {
+			return ErrPageLimit
+		}
+
+		newCall, err := c.parseCall(method, params)
+		if err != nil {
+			return err
+		}
+
+		var p page
+		if err = c.callContext(ctx, newCall, &p); err != nil {
+			return err
+		}
+
+		total += len(p.Items)
+		if total > c.pages.maxItems() {
+			return ErrPageLimit
+		}
+
+		if p.Items == nil {
+			p.Items = []json.RawMessage{}
+		}
+
+		items, err := json.Marshal(p.Items)
+		if err != nil {
+			return err
+		}
+
+		if err = appendFn(items); err != nil {
+			return err
+		}
+
+		if p.NextCursor == "" {
+			return nil
+		}
+
+		if seen[p.NextCursor] {
+			return ErrCursorLoop
+		}
+		seen[p.NextCursor] = true
+
+		params["cursor"], _ = json.Marshal(p.NextCursor)
+	}
+}
@@ -0,0 +1,82 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// decodeParams decodes params into in, a pointer to the handler's in param.
+// Besides the usual object form, positional params (a JSON array) are accepted
+// when in doesn't take an array itself: the elements are assigned to the
+// exported fields of a struct in declaration order, or a single element to a
+// scalar. Types implementing json.Unmarshaler are handed the params as they
+// are.
+func decodeParams(params json.RawMessage, in interface{}) error {
+	return decodeParamsWith(params, in, json.Unmarshal)
+}
+
+// decodeParamsWith is like decodeParams, decoding JSON values with unmarshal.
+func decodeParamsWith(params json.RawMessage, in interface{}, unmarshal func([]byte, interface{}) error) error {
+	if firstByte(params) != '[' {
+		return unmarshal(params, in)
+	}
+
+	v := reflect.ValueOf(in).Elem()
+	t := v.Type()
+	for {
+		if reflect.PtrTo(t).Implements(typeOfJSONUnmarshaler) {
+			return unmarshal(params, in)
+		}
+		if t.Kind() != reflect.Ptr {
+			break
+		}
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Interface:
+		return unmarshal(params, in)
+	}
+
+	var elems []json.RawMessage
+	if err := json.Unmarshal(params, &elems); err != nil {
+		return err
+	}
+
+	if t.Kind() != reflect.Struct {
+		if len(elems) != 1 {
+			return fmt.Errorf("expected 1 positional param, got %d", len(elems))
+		}
+		return unmarshal(elems[0], in)
+	}
+
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+
+	var fields []int
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" || field.Tag.Get("json") == "-" {
+			continue
+		}
+		fields = append(fields, i)
+	}
+
+	if len(elems) > len(fields) {
+		return fmt.Errorf("too many positional params: %s takes at most %d", t, len(fields))
+	}
+
+	for i, elem := range elems {
+		field := v.Field(fields[i])
+		if err := unmarshal(elem, field.Addr().Interface()); err != nil {
+			return fmt.Errorf("positional param %d (%s): %v", i, t.Field(fields[i]).Name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// Vector decodes itself from a JSON array of any length.
+type Vector struct {
+	Elems []int
+}
+
+func (v *Vector) UnmarshalJSON(b []byte) error {
+	return json.Unmarshal(b, &v.Elems)
+}
+
+type Span struct {
+	From, To int
+}
+
+func TestDecodePositionalParams(t *testing.T) {
+	var span Span
+	if err := decodeParams(json.RawMessage(`[1, 5]`), &span); err != nil || span != (Span{1, 5}) {
+		t.Errorf("Span: %+v, %v", span, err)
+	}
+
+	var n int
+	if err := decodeParams(json.RawMessage(`[7]`), &n); err != nil || n != 7 {
+		t.Errorf("int: %d, %v", n, err)
+	}
+
+	if err := decodeParams(json.RawMessage(`[1, 2, 3]`), &span); err == nil {
+		t.Error("too many positional params accepted")
+	}
+}
+
+func TestDecodeParamsUnmarshaler(t *testing.T) {
+	want := []int{1, 2, 3}
+
+	var v Vector
+	if err := decodeParams(json.RawMessage(`[1, 2, 3]`), &v); err != nil || !reflect.DeepEqual(v.Elems, want) {
+		t.Errorf("Vector: %+v, %v", v, err)
+	}
+
+	var p *Vector
+	if err := decodeParams(json.RawMessage(`[1, 2, 3]`), &p); err != nil || p == nil || !reflect.DeepEqual(p.Elems, want) {
+		t.Errorf("*Vector: %+v, %v", p, err)
+	}
+
+	v = Vector{}
+	if err := NewScalars().Int64Strings().decodeParams(json.RawMessage(`[1, 2, 3]`), &v); err != nil || !reflect.DeepEqual(v.Elems, want) {
+		t.Errorf("Vector with scalars: %+v, %v", v, err)
+	}
+}
+
+func TestDecodeParamsScalarFormat(t *testing.T) {
+	// spans written as an array of their bounds, the other way around
+	scalars := NewScalars().Set(Span{}, ScalarFormat{
+		Name: "reversed",
+		Decode: func(data json.RawMessage) (interface{}, error) {
+			var bounds [2]int
+			err := json.Unmarshal(data, &bounds)
+			return Span{From: bounds[1], To: bounds[0]}, err
+		},
+	})
+
+	var span Span
+	if err := scalars.decodeParams(json.RawMessage(`[5, 1]`), &span); err != nil || span != (Span{1, 5}) {
+		t.Errorf("Span: %+v, %v", span, err)
+	}
+}
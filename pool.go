@@ -0,0 +1,267 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// Health checks of the idle connections of a Pool.
+const (
+	poolHealthInterval = 30 * time.Second
+	poolHealthTimeout  = 5 * time.Second
+)
+
+// Pool spreads calls over several connections to one server, so that a single
+// TCP stream doesn't bound their throughput. Calls are sent over the
+// connections in turn; calls of one caller may thus complete out of order,
+// unless they are made over the connection Pinned returns for a key.
+//
+// A lost connection is dialed again in the background, and idle connections
+// are checked every 30 seconds with an rpc.info call, those failing to answer
+// within 5 seconds being replaced. Calls fail with ErrNoConnection only when
+// every connection is being replaced.
+type Pool struct {
+	addr string
+	opts []DialOption
+
+	m       sync.Mutex
+	clients []*Client // nil while being replaced
+	next    int
+	closed  bool
+
+	// closed when the pool is closed
+	done chan struct{}
+
+	// set for pools handed out by a Registry
+	shared *registryEntry
+}
+
+// DialPool connects size clients to addr with opts, which shouldn't include
+// WithReconnect: the pool replaces lost connections itself.
+func DialPool(ctx context.Context, addr string, size int, opts ...DialOption) (p *Pool, err error) {
+	if size < 1 {
+		size = 1
+	}
+
+	p = &Pool{
+		addr:    addr,
+		opts:    opts,
+		clients: make([]*Client, size),
+		done:    make(chan struct{}),
+	}
+
+	for i := range p.clients {
+		var c *Client
+		if c, err = DialContext(ctx, addr, opts...); err != nil {
+			p.Close()
+			return nil, err
+		}
+
+		p.clients[i] = c
+		go p.watch(i, c)
+	}
+
+	go p.healthCheck()
+	return
+}
+
+// Call is like Client.Call over the next connection of the pool.
+func (p *Pool) Call(method string, in, out interface{}) (err error) {
+	c, err := p.client()
+	if err != nil {
+		return
+	}
+
+	err = c.Call(method, in, out)
+	return
+}
+
+// CallContext is like Client.CallContext over the next connection of the
+// pool.
+func (p *Pool) CallContext(ctx context.Context, method string, in, out interface{}) (err error) {
+	c, err := p.client()
+	if err != nil {
+		return
+	}
+
+	err = c.CallContext(ctx, method, in, out)
+	return
+}
+
+// Notify is like Client.Notify over the next connection of the pool.
+func (p *Pool) Notify(method string, in interface{}) (err error) {
+	c, err := p.client()
+	if err != nil {
+		return
+	}
+
+	err = c.Notify(method, in)
+	return
+}
+
+// Close closes every connection of the pool, those of a shared pool once
+// every holder closed it, see Registry.
+func (p *Pool) Close() {
+	if p.shared != nil && !p.shared.release() {
+		return
+	}
+
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	if p.closed {
+		return
+	}
+	p.closed = true
+	close(p.done)
+
+	for _, c := range p.clients {
+		if c != nil {
+			c.Close()
+		}
+	}
+}
+
+// Pinned returns the client of the pool that key is pinned to, the same for
+// every call with that key. Calls made one after the other through it are
+// delivered in order as with a single Client, so operations that must run in
+// order, such as those on one record, are pinned to a key naming it. Pinned
+// fails with ErrNoConnection while that connection is being replaced rather
+// than sending the calls for key over another one.
+func (p *Pool) Pinned(key string) (*Client, error) {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	if p.closed {
+		return nil, ErrClientClosed
+	}
+
+	c := p.clients[h.Sum32()%uint32(len(p.clients))]
+	if c == nil || c.isShutdown() {
+		return nil, ErrNoConnection
+	}
+
+	return c, nil
+}
+
+// client returns the next connected client of the pool.
+func (p *Pool) client() (*Client, error) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	if p.closed {
+		return nil, ErrClientClosed
+	}
+
+	for range p.clients {
+		c := p.clients[p.next]
+		p.next = (p.next + 1) % len(p.clients)
+
+		if c != nil && !c.isShutdown() {
+			return c, nil
+		}
+	}
+
+	return nil, ErrNoConnection
+}
+
+// watch waits for the connection of c, the i-th client of the pool, to end
+// and replaces it.
+func (p *Pool) watch(i int, c *Client) {
+	<-c.done
+	p.replace(i, c)
+}
+
+// replace dials again until c, the i-th client of the pool, is replaced or the
+// pool closed. It is a no-op if c was already replaced.
+func (p *Pool) replace(i int, c *Client) {
+	p.m.Lock()
+	if p.closed || p.clients[i] != c {
+		p.m.Unlock()
+		return
+	}
+	p.clients[i] = nil
+	p.m.Unlock()
+
+	backoff := failoverMinBackoff
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), reconnectDialTimeout)
+		replacement, err := DialContext(ctx, p.addr, p.opts...)
+		cancel()
+
+		if err == nil {
+			p.m.Lock()
+			if p.closed {
+				p.m.Unlock()
+				replacement.Close()
+				return
+			}
+			p.clients[i] = replacement
+			p.m.Unlock()
+
+			go p.watch(i, replacement)
+			return
+		}
+
+		select {
+		case <-p.done:
+			return
+		case <-time.After(backoff):
+		}
+
+		if backoff *= 2; backoff > failoverMaxBackoff {
+			backoff = failoverMaxBackoff
+		}
+	}
+}
+
+// healthCheck closes the idle clients whose server doesn't answer, until the
+// pool is closed. Their watchers replace them.
+func (p *Pool) healthCheck() {
+	ticker := time.NewTicker(poolHealthInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		}
+
+		p.m.Lock()
+		clients := append([]*Client(nil), p.clients...)
+		p.m.Unlock()
+
+		for _, c := range clients {
+			if c != nil && c.pending() == 0 && !c.healthy() {
+				c.Close()
+			}
+		}
+	}
+}
+
+// pending returns the number of calls awaiting a response.
+func (c *Client) pending() int {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return len(c.calls)
+}
+
+// healthy reports whether the server answers an rpc.info call in time. An
+// error response counts as an answer.
+func (c *Client) healthy() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), poolHealthTimeout)
+	defer cancel()
+
+	err := c.CallContext(ctx, builtinService+".info", nil, nil)
+
+	var lost *connError
+	return !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, ErrTimeout) &&
+		!errors.As(err, &lost) && !errors.Is(err, ErrClientClosed)
+}
@@ -0,0 +1,138 @@
+package jsonrpc
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// newNamedServer serves Conn.Addr, returning the client's address, and
+// Conn.Name, returning name, on a loopback address.
+func newNamedServer(t *testing.T, name string) (s *Server, addr string) {
+	s = NewServer("")
+
+	err := s.RegisterFunc("Conn.Addr", func(ctx context.Context, _ int) (string, error) {
+		info, _ := ConnInfoFromContext(ctx)
+		return info.RemoteAddr.String(), nil
+	})
+	if err == nil {
+		err = s.RegisterFunc("Conn.Name", func(ctx context.Context, _ int) (string, error) { return name, nil })
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s, serveTCP(t, s)
+}
+
+type caller interface {
+	Call(method string, in, out interface{}) error
+}
+
+// poolAddrs returns the client addresses of calls made through p.
+func poolAddrs(t *testing.T, p caller, calls int) map[string]int {
+	t.Helper()
+
+	addrs := make(map[string]int)
+	for i := 0; i < calls; i++ {
+		var addr string
+		if err := p.Call("Conn.Addr", 0, &addr); err != nil {
+			t.Fatal(err)
+		}
+		addrs[addr]++
+	}
+	return addrs
+}
+
+func TestPool(t *testing.T) {
+	_, addr := newNamedServer(t, "server")
+
+	p, err := DialPool(context.Background(), addr, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	// calls go over the connections in turn
+	addrs := poolAddrs(t, p, 6)
+	if len(addrs) != 3 {
+		t.Fatalf("calls spread over %v", addrs)
+	}
+	for addr, n := range addrs {
+		if n != 2 {
+			t.Errorf("%d calls over %s", n, addr)
+		}
+	}
+
+	// calls for a key go over the same connection
+	for _, key := range []string{"a", "b", "order-42"} {
+		c, err := p.Pinned(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		again, _ := p.Pinned(key)
+		if c != again {
+			t.Errorf("key %q pinned to two clients", key)
+		}
+		if pinned := poolAddrs(t, c, 3); len(pinned) != 1 {
+			t.Errorf("calls for %q spread over %v", key, pinned)
+		}
+	}
+
+	p.Close()
+	if err := p.Call("Conn.Addr", 0, nil); err != ErrClientClosed {
+		t.Errorf("call after Close: %v", err)
+	}
+	if _, err := p.Pinned("a"); err != ErrClientClosed {
+		t.Errorf("Pinned after Close: %v", err)
+	}
+}
+
+func TestPoolReplacesLostConnections(t *testing.T) {
+	s, addr := newNamedServer(t, "server")
+
+	p, err := DialPool(context.Background(), addr, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	before := poolAddrs(t, p, 3)
+
+	p.m.Lock()
+	lost := append([]*Client(nil), p.clients...)
+	p.m.Unlock()
+
+	s.closeConns()
+
+	// every connection is dialed again
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		p.m.Lock()
+		replaced := 0
+		for i, c := range p.clients {
+			if c != nil && c != lost[i] {
+				replaced++
+			}
+		}
+		p.m.Unlock()
+
+		if replaced == len(p.clients) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d connections replaced", replaced)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	after := poolAddrs(t, p, 3)
+	if len(after) != 3 {
+		t.Fatalf("calls spread over %v after replacing the connections", after)
+	}
+	for addr := range after {
+		if before[addr] > 0 {
+			t.Errorf("call over lost connection %s", addr)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package jsonrpc
+
+import (
+	"context"
+	"runtime/pprof"
+)
+
+// Profile label keys set on handler goroutines when Server.ProfileLabels is on.
+const (
+	ProfileLabelService = "rpc.service"
+	ProfileLabelMethod  = "rpc.method"
+)
+
+// profile runs f with service and method as pprof labels, so CPU
+// profiles can be broken down by method, e.g. with
+// go tool pprof -tagroot rpc.method.
+func (s *Server) profile(ctx context.Context, service, method string, f func(ctx context.Context)) {
+	if !s.ProfileLabels {
+		f(ctx)
+		return
+	}
+
+	pprof.Do(ctx, pprof.Labels(ProfileLabelService, service, ProfileLabelMethod, service+"."+method), f)
+}
@@ -0,0 +1,99 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+// progressMethod is the built-in notification a server sends to report the
+// progress of a pending request.
+const progressMethod = builtinService + ".progress"
+
+// ErrNoRequest is returned by Progress when the context isn't the one of a
+// request.
+var ErrNoRequest = errors.New("context doesn't belong to a request")
+
+type requestKey struct{}
+
+// progressParams are the params of rpc.progress.
+type progressParams struct {
+	Id    json.RawMessage `json:"id"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Progress sends payload to the client as intermediate progress of the request
+// a context-aware handler is serving. It is delivered to the callback given to
+// Client.CallWithProgress before the response. Progress of notifications is
+// dropped, since the client has nothing to tie it to.
+func Progress(ctx context.Context, payload interface{}) (err error) {
+	conn, ok := ConnectionFromContext(ctx)
+	if !ok {
+		return ErrNoRequest
+	}
+
+	req, ok := ctx.Value(requestKey{}).(*Request)
+	if !ok {
+		return ErrNoRequest
+	}
+
+	if req.notification {
+		return
+	}
+
+	value, err := conn.scalarsOf(req).marshal(payload)
+	if err != nil {
+		return
+	}
+
+	err = conn.notify(progressMethod, &progressParams{Id: req.Id, Value: value})
+	return
+}
+
+// CallWithProgress is like Call, calling progress with each value the handler
+// reports with Progress. progress runs on the goroutine reading responses and
+// must not block.
+func (c *Client) CallWithProgress(method string, in, out interface{}, progress func(value json.RawMessage)) (err error) {
+	newCall, err := c.parseCall(method, in)
+	if err != nil {
+		return
+	}
+	newCall.progress = progress
+
+	err = c.call(newCall, out)
+	return
+}
+
+// progressTarget returns the call id and value of frame, if it is an
+// rpc.progress notification.
+func progressTarget(fields map[string]json.RawMessage) (id uint32, value json.RawMessage, ok bool) {
+	params, ok := builtinParams(fields, progressMethod)
+	if !ok {
+		return
+	}
+
+	var p progressParams
+	if err := decodeParams(params, &p); err != nil {
+		return 0, nil, false
+	}
+
+	n, err := strconv.ParseUint(string(p.Id), 10, 32)
+	if err != nil {
+		return 0, nil, false
+	}
+
+	return uint32(n), p.Value, true
+}
+
+// deliverProgress hands value to the progress callback of the call, if it is
+// still pending.
+func (c *Client) deliverProgress(id uint32, value json.RawMessage) {
+	c.m.Lock()
+	call, ok := c.calls[id]
+	c.m.Unlock()
+
+	if ok && call.progress != nil {
+		call.progress(value)
+	}
+}
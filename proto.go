@@ -0,0 +1,137 @@
+package jsonrpc
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// ProtoMessage is a protobuf message able to encode itself, as the messages
+// generated by gogo/protobuf are. Messages of other generators can be served
+// through a type wrapping them with these two methods.
+type ProtoMessage interface {
+	Marshal() ([]byte, error)
+	Unmarshal(data []byte) error
+}
+
+var typeOfProtoMessage = reflect.TypeOf((*ProtoMessage)(nil)).Elem()
+
+// protoPayload carries an encoded protobuf message in the params or the result
+// of a call, base64 in JSON.
+type protoPayload struct {
+	Proto []byte `json:"proto"`
+}
+
+// WithProtobuf carries the params and results of the service's methods that
+// are protobuf messages encoded, as {"proto": "<base64 message>"}, rather
+// than converting them to and from JSON. Methods whose params or result
+// aren't a ProtoMessage, or a struct whose pointer is one, are served as
+// usual. Clients call them with Client.CallProto.
+func WithProtobuf() ServiceOption {
+	return func(opts *serviceOptions) {
+		opts.protobuf = true
+	}
+}
+
+// isProtoType reports whether values of t are carried as protobuf messages.
+func isProtoType(t reflect.Type) bool {
+	return t.Implements(typeOfProtoMessage) || t.Kind() != reflect.Ptr && reflect.PtrTo(t).Implements(typeOfProtoMessage)
+}
+
+// useProtobuf marks the methods of methodMap whose params and result are
+// protobuf messages.
+func useProtobuf(methodMap map[string]*serviceMethod) {
+	for _, mthd := range methodMap {
+		mthd.proto = isProtoType(mthd.inType) && isProtoType(mthd.outType.Elem())
+	}
+}
+
+// protoMessage returns the message v holds, allocating the messages its nil
+// pointers lead to when alloc is set.
+func protoMessage(v reflect.Value, alloc bool) (ProtoMessage, bool) {
+	for {
+		if v.Type().Implements(typeOfProtoMessage) && (v.Kind() != reflect.Ptr || !v.IsNil()) {
+			return v.Interface().(ProtoMessage), true
+		}
+
+		if v.Kind() != reflect.Ptr {
+			if v.CanAddr() && v.Addr().Type().Implements(typeOfProtoMessage) {
+				return v.Addr().Interface().(ProtoMessage), true
+			}
+			return nil, false
+		}
+
+		if v.IsNil() {
+			if !alloc || !v.CanSet() {
+				return nil, false
+			}
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+}
+
+// decodeProtoParams decodes params carrying a protobuf message into in, a
+// pointer to the params of a method.
+func decodeProtoParams(params []byte, in reflect.Value) error {
+	var p protoPayload
+	if err := decodeParams(params, &p); err != nil {
+		return err
+	}
+
+	msg, ok := protoMessage(in.Elem(), true)
+	if !ok {
+		return fmt.Errorf("%s is not a protobuf message", in.Elem().Type())
+	}
+	return msg.Unmarshal(p.Proto)
+}
+
+// protoResult returns the result of a method, out, as the payload carrying it
+// encoded.
+func protoResult(out reflect.Value) (interface{}, error) {
+	msg, ok := protoMessage(out, false)
+	if !ok {
+		// a nil message
+		return nil, nil
+	}
+
+	data, err := msg.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return &protoPayload{Proto: data}, nil
+}
+
+// protoSchema describes the params or result of type t of a method served with
+// WithProtobuf.
+func protoSchema(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return &Schema{
+		Type:  "object",
+		Title: t.Name(),
+		Properties: map[string]*Schema{
+			"proto": {Type: "string", Format: "byte"},
+		},
+	}
+}
+
+// CallProto calls a method of a service registered with WithProtobuf, sending
+// in encoded and decoding the result into out, giving up when ctx is done as
+// CallContext does.
+func (c *Client) CallProto(ctx context.Context, method string, in, out ProtoMessage) (err error) {
+	data, err := in.Marshal()
+	if err != nil {
+		return
+	}
+
+	var result protoPayload
+	if err = c.CallContext(ctx, method, &protoPayload{Proto: data}, &result); err != nil {
+		return
+	}
+
+	err = out.Unmarshal(result.Proto)
+	return
+}
@@ -0,0 +1,368 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// Protocol selects the envelope format spoken on the wire.
+type Protocol int
+
+const (
+	// ProtocolLegacy uses this package's original {id, method, param} requests
+	// and {id, result, error} responses with string errors.
+	ProtocolLegacy Protocol = iota
+
+	// ProtocolJSONRPC2 follows the JSON-RPC 2.0 specification: envelopes carry
+	// "jsonrpc": "2.0", requests use params and errors are structured objects.
+	ProtocolJSONRPC2
+
+	// ProtocolAuto detects the protocol of each connection from its first frame:
+	// frames carrying a "jsonrpc" member are served as JSON-RPC 2.0, frames with
+	// a "params" member but no "param" as JSON-RPC 1.0, others as legacy
+	// frames. It lets legacy, 1.0 and 2.0 clients share a listener.
+	ProtocolAuto
+
+	// ProtocolJSONRPC1 follows the JSON-RPC 1.0 specification: requests carry
+	// positional params and a null id for notifications, responses always
+	// carry both result and error, one of them null.
+	ProtocolJSONRPC1
+)
+
+// Version2 is the value of the "jsonrpc" member of JSON-RPC 2.0 envelopes.
+const Version2 = "2.0"
+
+func (p Protocol) String() string {
+	switch p {
+	case ProtocolLegacy:
+		return "legacy"
+	case ProtocolJSONRPC2:
+		return Version2
+	case ProtocolAuto:
+		return "auto"
+	case ProtocolJSONRPC1:
+		return Version1
+	}
+
+	return fmt.Sprintf("Protocol(%d)", int(p))
+}
+
+// envelopeFields2 lists the top-level fields of a JSON-RPC 2.0 request and
+// whether they are required.
+var envelopeFields2 = map[string]bool{
+	"jsonrpc": true,
+	"id":      false,
+	"method":  true,
+	"params":  false,
+	"meta":    false,
+}
+
+type request2 struct {
+	Version string            `json:"jsonrpc"`
+	Id      json.RawMessage   `json:"id,omitempty"`
+	Method  string            `json:"method"`
+	Params  interface{}       `json:"params,omitempty"`
+	Meta    map[string]string `json:"meta,omitempty"`
+}
+
+type response2 struct {
+	Version string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// parseRequest2 decodes and validates a JSON-RPC 2.0 request. Unknown top-level
+// fields are only rejected when strict is set.
+func parseRequest2(raw json.RawMessage, strict bool) (req *Request, err error) {
+	req, fields, err := splitEnvelope(raw)
+	if err != nil {
+		return
+	}
+
+	if strict {
+		if rpcErr := checkStrictEnvelope(raw, fields, envelopeFields2); rpcErr != nil {
+			err = rpcErr
+			return
+		}
+	}
+
+	var version string
+	if err = json.Unmarshal(fields["jsonrpc"], &version); err != nil || version != Version2 {
+		err = newError(CodeInvalidRequest, "invalid request envelope: field 'jsonrpc' must be \"%s\"", Version2)
+		return
+	}
+
+	if err = json.Unmarshal(fields["method"], &req.Method); err != nil || req.Method == "" {
+		err = newError(CodeInvalidRequest, "invalid request envelope: field 'method' must be a non-empty string")
+		return
+	}
+
+	if params, ok := fields["params"]; ok {
+		switch firstByte(params) {
+		case '{', '[':
+		default:
+			err = newError(CodeInvalidRequest, "invalid request envelope: field 'params' must be an object or an array")
+			return
+		}
+		req.Param = params
+	}
+
+	if meta, ok := fields["meta"]; ok {
+		if err = json.Unmarshal(meta, &req.Meta); err != nil {
+			err = newError(CodeInvalidRequest, "invalid request envelope: field 'meta' must be an object of strings")
+			return
+		}
+	}
+
+	return
+}
+
+// firstByte returns the first non-whitespace byte of data, or 0.
+func firstByte(data []byte) byte {
+	for _, b := range data {
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return b
+	}
+
+	return 0
+}
+
+// detectProtocol tells the protocol of a frame, a request or a batch of
+// requests, from the presence of the "jsonrpc" member.
+func detectProtocol(raw json.RawMessage) Protocol {
+	if firstByte(raw) == '[' {
+		var frames []json.RawMessage
+		if err := json.Unmarshal(raw, &frames); err != nil || len(frames) == 0 {
+			return ProtocolJSONRPC2
+		}
+		raw = frames[0]
+	}
+
+	var envelope struct {
+		Version *json.RawMessage `json:"jsonrpc"`
+		Param   *json.RawMessage `json:"param"`
+		Params  *json.RawMessage `json:"params"`
+	}
+	if err := json.Unmarshal(raw, &envelope); err != nil || envelope.Version != nil {
+		return ProtocolJSONRPC2
+	}
+
+	if envelope.Params != nil && envelope.Param == nil {
+		return ProtocolJSONRPC1
+	}
+
+	return ProtocolLegacy
+}
+
+// wireResponse returns resp in the envelope format of p. Responses sent before
+// the protocol of a ProtocolAuto connection is known use JSON-RPC 2.0.
+func (p Protocol) wireResponse(resp *Response) interface{} {
+	switch p {
+	case ProtocolLegacy:
+		return resp
+	case ProtocolJSONRPC1:
+		return wireResponse1(resp)
+	}
+
+	out := &response2{
+		Version: Version2,
+		Id:      resp.Id,
+	}
+
+	// the id is null when it couldn't be read from the request
+	if out.Id == nil {
+		out.Id = json.RawMessage("null")
+	}
+
+	if resp.err != nil {
+		out.Error = toError(resp.err)
+		return out
+	}
+
+	out.Result = resp.result()
+	return out
+}
+
+// result returns the result of resp as written in frames, null if it has none.
+func (resp *Response) result() interface{} {
+	switch {
+	case resp.encoded != nil:
+		return resp.encoded
+	case resp.Result != nil:
+		return resp.Result
+	}
+	return json.RawMessage("null")
+}
+
+// wireRequest returns req in the envelope format of p.
+func (p Protocol) wireRequest(req *Request) interface{} {
+	switch p {
+	case ProtocolLegacy:
+		if req.notification {
+			return &notification{Method: req.Method, Param: req.Param, Meta: req.Meta}
+		}
+		return req
+	case ProtocolJSONRPC1:
+		return wireRequest1(req)
+	}
+
+	out := &request2{
+		Version: Version2,
+		Method:  req.Method,
+		Meta:    req.Meta,
+	}
+
+	switch {
+	case req.encoded != nil:
+		out.Params = req.encoded
+	case req.Param != nil:
+		out.Params = req.Param
+	}
+
+	if !req.notification {
+		out.Id = req.Id
+	}
+
+	return out
+}
+
+// marshalParams encodes in as the params of a request in protocol p. JSON-RPC
+// 2.0 only allows structured params: they are omitted when in is nil and
+// scalars are sent as a single positional param.
+func (p Protocol) marshalParams(in interface{}) (params json.RawMessage, err error) {
+	if in == nil && p != ProtocolLegacy {
+		return
+	}
+
+	params, err = json.Marshal(in)
+	if err != nil || p == ProtocolLegacy {
+		return
+	}
+
+	switch firstByte(params) {
+	case '{', '[':
+	case 'n':
+		params = nil
+	default:
+		params = append(append(json.RawMessage{'['}, params...), ']')
+	}
+
+	return
+}
+
+// setParams sets in as the params of req. Codecs encoding values in a binary
+// format of their own encode JSON-RPC 2.0 params straight from in, other
+// protocols and codecs get them as JSON, see marshalParams.
+func (p Protocol) setParams(req *Request, codec Codec, in interface{}) (err error) {
+	req.encoded = nil
+
+	if enc, ok := codec.(binaryEncoder); ok && p == ProtocolJSONRPC2 {
+		var structured bool
+		if structured, ok = structuredValue(in); ok {
+			if !structured {
+				in = []interface{}{in}
+			}
+			req.encoded, err = enc.encodeBinary(in)
+			return
+		}
+	}
+
+	req.Param, err = p.marshalParams(in)
+	return
+}
+
+// structuredValue reports whether in is encoded as an array or an object.
+// ok is false when only its JSON tells, for instance because it is nil or
+// implements json.Marshaler.
+func structuredValue(in interface{}) (structured, ok bool) {
+	v := reflect.ValueOf(in)
+	for {
+		if !v.IsValid() {
+			return
+		}
+
+		bt := binaryTypeOf(v.Type())
+		if bt.marshaler || bt.addrMarshaler || bt.text || bt.addrText {
+			return
+		}
+
+		if v.Kind() != reflect.Ptr && v.Kind() != reflect.Interface {
+			break
+		}
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct, reflect.Array:
+		return true, true
+	case reflect.Map:
+		return true, !v.IsNil()
+	case reflect.Slice:
+		return !binaryTypeOf(v.Type()).bytes, !v.IsNil()
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return false, true
+	}
+
+	return
+}
+
+// notification is a legacy request without an id.
+type notification struct {
+	Method string            `json:"method"`
+	Param  json.RawMessage   `json:"param"`
+	Meta   map[string]string `json:"meta,omitempty"`
+}
+
+// clientResponse decodes responses of every protocol.
+type clientResponse struct {
+	Id     json.RawMessage `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  json.RawMessage `json:"error"`
+}
+
+func (cr *clientResponse) response() *Response {
+	resp := &Response{
+		Id:     cr.Id,
+		Result: cr.Result,
+	}
+
+	switch firstByte(cr.Error) {
+	case 0, 'n':
+	case '"':
+		_ = json.Unmarshal(cr.Error, &resp.Error)
+	default:
+		rpcErr := &Error{}
+		if err := json.Unmarshal(cr.Error, rpcErr); err != nil {
+			rpcErr = &Error{Code: CodeServerError, Message: string(cr.Error)}
+		}
+		resp.Error = rpcErr.Message
+		resp.err = rpcErr
+	}
+
+	return resp
+}
+
+// error returns the error carried by resp, if any.
+func (resp *Response) error() error {
+	if resp.err != nil {
+		return resp.err
+	}
+
+	if resp.Error != "" {
+		return errors.New(resp.Error)
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+)
+
+// Version1 is the protocol version reported for JSON-RPC 1.0 connections.
+const Version1 = "1.0"
+
+// envelopeFields1 lists the top-level fields of a JSON-RPC 1.0 request and
+// whether they are required.
+var envelopeFields1 = map[string]bool{
+	"id":     true,
+	"method": true,
+	"params": true,
+	"meta":   false,
+}
+
+type request1 struct {
+	Id     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params json.RawMessage   `json:"params"`
+	Meta   map[string]string `json:"meta,omitempty"`
+}
+
+// response1 always carries both result and error, one of them null.
+type response1 struct {
+	Id     json.RawMessage `json:"id"`
+	Result interface{}     `json:"result"`
+	Error  *Error          `json:"error"`
+}
+
+// parseRequest1 decodes a JSON-RPC 1.0 request: a null id marks a notification
+// and params are positional. Named params, which 1.0 clients send as a
+// single-object array, are unwrapped. The params must be an array and the id
+// present only when strict is set.
+func parseRequest1(raw json.RawMessage, strict bool) (req *Request, err error) {
+	req, fields, err := splitEnvelope(raw)
+	if err != nil {
+		return
+	}
+
+	if strict {
+		if rpcErr := checkStrictEnvelope(raw, fields, envelopeFields1); rpcErr != nil {
+			err = rpcErr
+			return
+		}
+	}
+
+	if firstByte(req.Id) == 'n' {
+		req.Id = nil
+		req.notification = true
+	}
+
+	if err = json.Unmarshal(fields["method"], &req.Method); err != nil || req.Method == "" {
+		err = newError(CodeInvalidRequest, "invalid request envelope: field 'method' must be a non-empty string")
+		return
+	}
+
+	if meta, ok := fields["meta"]; ok {
+		if err = json.Unmarshal(meta, &req.Meta); err != nil {
+			err = newError(CodeInvalidRequest, "invalid request envelope: field 'meta' must be an object of strings")
+			return
+		}
+	}
+
+	params, ok := fields["params"]
+	if !ok || firstByte(params) == 'n' {
+		return
+	}
+
+	switch firstByte(params) {
+	case '[':
+		var elems []json.RawMessage
+		if json.Unmarshal(params, &elems) == nil && len(elems) == 1 && firstByte(elems[0]) == '{' {
+			params = elems[0]
+		}
+	case '{':
+		if strict {
+			err = newError(CodeInvalidRequest, "invalid request envelope: field 'params' must be an array")
+			return
+		}
+	default:
+		err = newError(CodeInvalidRequest, "invalid request envelope: field 'params' must be an array")
+		return
+	}
+
+	req.Param = params
+	return
+}
+
+// wireResponse1 returns resp as a JSON-RPC 1.0 response.
+func wireResponse1(resp *Response) *response1 {
+	out := &response1{
+		Id:     resp.Id,
+		Result: json.RawMessage("null"),
+	}
+
+	if out.Id == nil {
+		out.Id = json.RawMessage("null")
+	}
+
+	if resp.err != nil {
+		out.Error = toError(resp.err)
+		return out
+	}
+
+	out.Result = resp.result()
+	return out
+}
+
+// wireRequest1 returns req as a JSON-RPC 1.0 request, params are always an
+// array.
+func wireRequest1(req *Request) *request1 {
+	out := &request1{
+		Id:     req.Id,
+		Method: req.Method,
+		Params: req.Param,
+		Meta:   req.Meta,
+	}
+
+	if req.notification || out.Id == nil {
+		out.Id = json.RawMessage("null")
+	}
+
+	if firstByte(out.Params) != '[' {
+		if out.Params == nil || firstByte(out.Params) == 'n' {
+			out.Params = json.RawMessage("[]")
+		} else {
+			out.Params = append(append(json.RawMessage{'['}, out.Params...), ']')
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,66 @@
+package jsonrpc
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// pointerOnlyMethods returns the servable methods of *t that t lacks, because
+// they are declared on the pointer receiver.
+func pointerOnlyMethods(t reflect.Type) (names []string) {
+	if t.Kind() == reflect.Ptr {
+		return
+	}
+
+	own := newService(t).methodMap
+	for name := range newService(reflect.PtrTo(t)).methodMap {
+		if _, ok := own[name]; !ok {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	return
+}
+
+// adaptReceiver serves a receiver passed by value through a pointer to a copy of
+// it when some of its methods are declared on the pointer receiver, which
+// would otherwise be invisible.
+func (s *Server) adaptReceiver(recvType reflect.Type, recvValue reflect.Value) (reflect.Type, reflect.Value) {
+	missing := pointerOnlyMethods(recvType)
+	if len(missing) == 0 {
+		return recvType, recvValue
+	}
+
+	ptr := reflect.New(recvType)
+	ptr.Elem().Set(recvValue)
+
+	s.logf("jsonrpc: %s registered by value but %s declared on *%s: serving a copy through a pointer, pass &%s{} instead",
+		recvType, strings.Join(missing, ", "), recvType.Name(), recvType.Name())
+
+	return ptr.Type(), ptr
+}
+
+// noExportedMethodError explains why recvType has nothing to serve.
+func noExportedMethodError(recvType reflect.Type) error {
+	if missing := pointerOnlyMethods(recvType); len(missing) > 0 {
+		return fmt.Errorf("%w: %s on *%s, use a pointer receiver", NoExportedMethod,
+			strings.Join(missing, ", "), recvType.Name())
+	}
+
+	var unsuitable []string
+	for i := 0; i < recvType.NumMethod(); i++ {
+		if method := recvType.Method(i); method.PkgPath == "" {
+			unsuitable = append(unsuitable, method.Name)
+		}
+	}
+
+	if len(unsuitable) == 0 {
+		return fmt.Errorf("%w: %s has no exported methods", NoExportedMethod, recvType)
+	}
+
+	return fmt.Errorf("%w: methods %s of %s don't have the form func([ctx context.Context, ]in T, out *T) error or func([ctx context.Context, ]in T) (T, error)",
+		NoExportedMethod, strings.Join(unsuitable, ", "), recvType)
+}
@@ -0,0 +1,117 @@
+package jsonrpc
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// reconnectDialTimeout bounds each attempt to reconnect.
+const reconnectDialTimeout = 10 * time.Second
+
+// Reconnect makes a client dial its server again when the connection is lost,
+// see WithReconnect. Attempts are made MinBackoff (50ms if zero) after the
+// loss, and then apart by a delay doubling up to MaxBackoff (5s if zero),
+// until one succeeds or the client is closed.
+type Reconnect struct {
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// OnReconnect, if set, is called with the client after it reconnected,
+	// e.g. to negotiate again with a server that may have been upgraded.
+	OnReconnect func(c *Client)
+}
+
+func (r *Reconnect) minBackoff() time.Duration {
+	if r.MinBackoff > 0 {
+		return r.MinBackoff
+	}
+	return failoverMinBackoff
+}
+
+func (r *Reconnect) maxBackoff() time.Duration {
+	if r.MaxBackoff > 0 {
+		return r.MaxBackoff
+	}
+	return failoverMaxBackoff
+}
+
+// WithReconnect makes the client reconnect when its connection is lost. The
+// calls pending then fail as they would without it, and calls made until the
+// client is reconnected fail with ErrNoConnection; later calls are sent over
+// the new connection.
+func WithReconnect(r *Reconnect) DialOption {
+	return func(opts *dialOptions) {
+		opts.reconnect = r
+	}
+}
+
+// redial reconnects the client, closing c.done if it is closed first.
+func (c *Client) redial() {
+	backoff := c.reconnect.minBackoff()
+
+	for {
+		time.Sleep(backoff)
+
+		if c.isClosing() {
+			break
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), reconnectDialTimeout)
+		conn, err := c.connect(ctx)
+		cancel()
+
+		if err == nil {
+			if !c.resume(conn) {
+				break
+			}
+
+			if c.reconnect.OnReconnect != nil {
+				c.reconnect.OnReconnect(c)
+			}
+			return
+		}
+
+		if backoff *= 2; backoff > c.reconnect.maxBackoff() {
+			backoff = c.reconnect.maxBackoff()
+		}
+	}
+
+	c.m.Lock()
+	c.reconnecting = false
+	c.m.Unlock()
+
+	close(c.done)
+}
+
+// resume makes the client use conn, unless it was closed meanwhile.
+func (c *Client) resume(conn net.Conn) bool {
+	c.reqMutex.Lock()
+	defer c.reqMutex.Unlock()
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.closing {
+		_ = conn.Close()
+		return false
+	}
+
+	codec := c.newCodec(conn)
+	setChecksum(codec, checksumOn(c.codec))
+
+	callbacks := newConnection(c.callbacks.s, conn)
+	callbacks.client = c
+
+	c.conn, c.codec, c.callbacks = conn, codec, callbacks
+	c.connectedAt = time.Now()
+	c.shutdown, c.reconnecting = false, false
+
+	go c.recv()
+	return true
+}
+
+func (c *Client) isClosing() bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.closing
+}
@@ -0,0 +1,93 @@
+package jsonrpc
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestReconnect(t *testing.T) {
+	s, addr := newNamedServer(t, "server")
+
+	reconnected := make(chan *Client, 1)
+	c, err := DialContext(context.Background(), addr, WithReconnect(&Reconnect{
+		MinBackoff:  10 * time.Millisecond,
+		OnReconnect: func(c *Client) { reconnected <- c },
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var before string
+	if err = c.Call("Conn.Addr", 0, &before); err != nil {
+		t.Fatal(err)
+	}
+
+	s.closeConns()
+
+	select {
+	case rc := <-reconnected:
+		if rc != c {
+			t.Error("OnReconnect called with another client")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("client never reconnected")
+	}
+
+	var after string
+	if err = c.Call("Conn.Addr", 0, &after); err != nil {
+		t.Fatal(err)
+	}
+	if after == before {
+		t.Errorf("call sent over the lost connection %s", before)
+	}
+}
+
+func TestReconnectUntilClosed(t *testing.T) {
+	s, addr := newNamedServer(t, "server")
+
+	c, err := DialContext(context.Background(), addr, WithReconnect(&Reconnect{
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 20 * time.Millisecond,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the server is gone for good
+	s.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		err = c.Call("Conn.Addr", 0, nil)
+		if err == ErrNoConnection {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("call while reconnecting: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		c.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close waited for the reconnection")
+	}
+
+	select {
+	case <-c.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("client still reconnecting after Close")
+	}
+	if err = c.Call("Conn.Addr", 0, nil); err != ErrClientClosed {
+		t.Errorf("call after Close: %v", err)
+	}
+}
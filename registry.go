@@ -0,0 +1,237 @@
+package jsonrpc
+
+import (
+	"context"
+	"crypto/tls"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// DefaultRegistry is the process-wide Registry used by DialShared.
+var DefaultRegistry = &Registry{}
+
+// Registry hands out Clients and Pools shared by every caller dialing the same
+// target with the same options, so independent libraries in one binary don't
+// each open their own connections. Options holding pointers or funcs, such as
+// WithTLS or WithCodec, are the same when they hold the same ones.
+//
+// Shared clients and pools are reference counted: their connections are only
+// closed once every holder has called Close, which each holder must call once.
+// Callers asking for a target being dialed wait for that dial rather than
+// dialing again, and share its error.
+type Registry struct {
+	m       sync.Mutex
+	entries map[registryKey]*registryEntry
+}
+
+type registryKey struct {
+	addr    string
+	timeout time.Duration
+	options dialKey
+
+	// the size of shared pools, zero for clients
+	pool int
+}
+
+// dialKey identifies the options of a dial.
+type dialKey struct {
+	dialer      interface{}
+	tls         *tls.Config
+	keepAlive   time.Duration
+	readBuffer  int
+	writeBuffer int
+	callTimeout time.Duration
+	reconnect   *Reconnect
+	breaker     *CircuitBreaker
+	codec       uintptr
+}
+
+func (opts *dialOptions) key() dialKey {
+	key := dialKey{
+		dialer:      opts.dialer,
+		tls:         opts.tls,
+		keepAlive:   opts.keepAlive,
+		readBuffer:  opts.readBuffer,
+		writeBuffer: opts.writeBuffer,
+		callTimeout: opts.callTimeout,
+		reconnect:   opts.reconnect,
+		breaker:     opts.breaker,
+	}
+
+	if opts.codec != nil {
+		key.codec = reflect.ValueOf(opts.codec).Pointer()
+	}
+
+	// dialers that can't be compared are never shared
+	if opts.dialer != nil && !reflect.TypeOf(opts.dialer).Comparable() {
+		key.dialer = new(int)
+	}
+	return key
+}
+
+// registryEntry is a client or pool shared through a registry.
+type registryEntry struct {
+	registry *Registry
+	key      registryKey
+
+	// closed once dialing ends, with client or pool set, or err
+	ready  chan struct{}
+	client *Client
+	pool   *Pool
+	err    error
+
+	// guarded by the registry's lock
+	refs int
+
+	closed sync.Once
+}
+
+// Dial returns the shared client for addr, dialing it if needed.
+func (r *Registry) Dial(addr string) (*Client, error) {
+	return r.DialContext(context.Background(), addr)
+}
+
+// DialWithTimeout returns the shared client for addr dialed with timeout, dialing
+// it if needed.
+func (r *Registry) DialWithTimeout(addr string, timeout time.Duration) (*Client, error) {
+	e, err := r.acquire(context.Background(), registryKey{addr: addr, timeout: timeout}, func(e *registryEntry) (err error) {
+		e.client, err = DialWithTimeout(addr, timeout)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return e.client, nil
+}
+
+// DialContext returns the shared client for addr dialed with opts, dialing it
+// if needed. ctx bounds the dial, or the wait for one under way.
+func (r *Registry) DialContext(ctx context.Context, addr string, opts ...DialOption) (*Client, error) {
+	key := registryKey{addr: addr, options: applyDialOptions(opts).key()}
+
+	e, err := r.acquire(ctx, key, func(e *registryEntry) (err error) {
+		e.client, err = DialContext(ctx, addr, opts...)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return e.client, nil
+}
+
+// DialPool returns the shared pool of size clients to addr dialed with opts,
+// dialing it if needed, see DialPool.
+func (r *Registry) DialPool(ctx context.Context, addr string, size int, opts ...DialOption) (*Pool, error) {
+	if size < 1 {
+		size = 1
+	}
+	key := registryKey{addr: addr, options: applyDialOptions(opts).key(), pool: size}
+
+	e, err := r.acquire(ctx, key, func(e *registryEntry) (err error) {
+		e.pool, err = DialPool(ctx, addr, size, opts...)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return e.pool, nil
+}
+
+// acquire returns the entry of key with a reference taken, calling dial
+// without the registry's lock to set one up if there is none, or if the
+// connection of its client was lost.
+func (r *Registry) acquire(ctx context.Context, key registryKey, dial func(e *registryEntry) error) (e *registryEntry, err error) {
+	for {
+		r.m.Lock()
+		if e = r.entries[key]; e == nil {
+			e = &registryEntry{registry: r, key: key, ready: make(chan struct{}), refs: 1}
+			if r.entries == nil {
+				r.entries = make(map[registryKey]*registryEntry)
+			}
+			r.entries[key] = e
+			r.m.Unlock()
+
+			err = dial(e)
+
+			r.m.Lock()
+			if e.err = err; err != nil {
+				delete(r.entries, key)
+			} else {
+				e.attach()
+			}
+			close(e.ready)
+			r.m.Unlock()
+
+			if err != nil {
+				return nil, err
+			}
+			return
+		}
+		e.refs++
+		r.m.Unlock()
+
+		select {
+		case <-e.ready:
+		case <-ctx.Done():
+			e.release()
+			return nil, ctx.Err()
+		}
+
+		if e.err != nil {
+			return nil, e.err
+		}
+
+		if e.client == nil || !e.client.isShutdown() {
+			return
+		}
+
+		// the connection was lost: dial a new client for the next holders
+		r.m.Lock()
+		if r.entries[key] == e {
+			delete(r.entries, key)
+		}
+		r.m.Unlock()
+		if e.release() {
+			e.client.close()
+		}
+	}
+}
+
+// attach makes closing the client or pool of e release it. The registry's lock
+// is held.
+func (e *registryEntry) attach() {
+	if e.client != nil {
+		e.client.shared = e
+	}
+	if e.pool != nil {
+		e.pool.shared = e
+	}
+}
+
+// release drops one reference to e and reports whether it was the last one,
+// in which case the caller closes its client or pool. It reports so once: the
+// references dropped past the last one are ignored.
+func (e *registryEntry) release() (last bool) {
+	r := e.registry
+
+	r.m.Lock()
+	if e.refs > 0 {
+		e.refs--
+	}
+	gone := e.refs == 0
+	if gone && r.entries[e.key] == e {
+		delete(r.entries, e.key)
+	}
+	r.m.Unlock()
+
+	if gone {
+		e.closed.Do(func() { last = true })
+	}
+	return
+}
+
+// DialShared returns the client for addr shared through DefaultRegistry.
+func DialShared(addr string) (*Client, error) {
+	return DefaultRegistry.Dial(addr)
+}
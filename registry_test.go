@@ -0,0 +1,97 @@
+package jsonrpc
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// countingListener counts the connections it accepts.
+type countingListener struct {
+	net.Listener
+	accepted int32
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		atomic.AddInt32(&l.accepted, 1)
+	}
+	return conn, err
+}
+
+func TestRegistrySharesClients(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &countingListener{Listener: inner}
+
+	s := NewServer("")
+	s.Listener = l
+	go s.Serve()
+	defer s.Close()
+
+	var r Registry
+	addr := l.Addr().String()
+
+	const holders = 16
+
+	clients := make([]*Client, holders)
+	var wg sync.WaitGroup
+	for i := range clients {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			var err error
+			if clients[i], err = r.DialContext(context.Background(), addr); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, c := range clients[1:] {
+		if c != clients[0] {
+			t.Fatal("holders got different clients")
+		}
+	}
+
+	other, err := r.DialContext(context.Background(), addr, WithCodec(NewCodec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == clients[0] {
+		t.Error("clients dialed with other options are shared")
+	}
+
+	// the calls are answered once the server accepted both connections
+	for _, c := range []*Client{clients[0], other} {
+		if err := c.Call("rpc.ping", nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	other.Close()
+
+	// the client stays open until its last holder closes it, closing it
+	// again then does nothing
+	for _, c := range clients[:holders-1] {
+		c.Close()
+	}
+	if clients[0].isShutdown() {
+		t.Fatal("shared client closed before its last holder")
+	}
+
+	clients[0].Close()
+	clients[0].Close()
+	if !clients[0].isShutdown() {
+		t.Error("shared client still open")
+	}
+
+	if n := atomic.LoadInt32(&l.accepted); n != 2 {
+		t.Errorf("%d connections, want 2", n)
+	}
+}
@@ -0,0 +1,46 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// MetaMaxResultSize is the meta key with which a caller declares the largest
+// encoded result, in bytes, it accepts for a call, e.g. with CallWithMeta.
+// Larger results are replaced by an error coded CodeResultTooLarge.
+const MetaMaxResultSize = "max-result-size"
+
+// ResultSize is the data of errors coded CodeResultTooLarge.
+type ResultSize struct {
+	Size int `json:"size"`
+	Max  int `json:"max"`
+}
+
+// maxResultSize returns the result size the caller of req accepts, zero if it
+// didn't declare one.
+func maxResultSize(req *Request) int {
+	max, err := strconv.Atoi(req.Meta[MetaMaxResultSize])
+	if err != nil || max < 0 {
+		return 0
+	}
+
+	return max
+}
+
+// checkResultSize returns the error replacing result if it is larger than the
+// caller of req accepts, nil if it may be sent.
+func (s *Server) checkResultSize(req *Request, result []byte) *Error {
+	max := maxResultSize(req)
+	if max <= 0 || len(result) <= max {
+		return nil
+	}
+
+	rpcErr := newError(CodeResultTooLarge, "result too large: %d bytes, at most %d accepted", len(result), max)
+	rpcErr.Data, _ = json.Marshal(&ResultSize{Size: len(result), Max: max})
+
+	if s.OversizedResult != nil {
+		rpcErr = s.OversizedResult(req, rpcErr)
+	}
+
+	return rpcErr
+}
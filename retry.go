@@ -0,0 +1,138 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	defaultRetryAttempts   = 3
+	defaultRetryMinBackoff = 50 * time.Millisecond
+	defaultRetryMaxBackoff = time.Second
+)
+
+// RetryPolicy retries the calls of a client failing on transient errors, see
+// Client.SetRetryPolicy.
+//
+// Calls are only retried when they are marked with Idempotent, since a call
+// whose connection was lost may have run, unless the error shows the server
+// didn't run them: calls made while the client reconnects (ErrNoConnection)
+// and calls the server declined (errors of CategoryUnavailable) are always
+// retried.
+type RetryPolicy struct {
+	// MaxAttempts bounds the attempts of a call, the first one included,
+	// 3 if zero.
+	MaxAttempts int
+
+	// Attempts are made MinBackoff (50ms if zero) apart, the delay doubling
+	// up to MaxBackoff (a second if zero).
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Retryable, if set, reports whether an idempotent call failing with err
+	// is retried. By default calls are retried when their connection was
+	// lost, and in the cases where the server didn't run them.
+	Retryable func(err error) bool
+
+	// Budget, if set, caps the retries. Once it is exhausted, calls fail with
+	// ErrRetryBudgetExhausted wrapping the error of their last attempt.
+	Budget *RetryBudget
+}
+
+type idempotentKey struct{}
+
+// Idempotent marks the calls made with the returned context as safe to run
+// more than once, so that a RetryPolicy retries them.
+func Idempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, true)
+}
+
+func isIdempotent(ctx context.Context) bool {
+	idempotent, _ := ctx.Value(idempotentKey{}).(bool)
+	return idempotent
+}
+
+// SetRetryPolicy retries the calls failing on transient errors as p says, nil
+// disabling retries. It must be called before the first call.
+func (c *Client) SetRetryPolicy(p *RetryPolicy) {
+	c.retry = p
+}
+
+func (p *RetryPolicy) maxAttempts() int {
+	if p.MaxAttempts > 0 {
+		return p.MaxAttempts
+	}
+	return defaultRetryAttempts
+}
+
+func (p *RetryPolicy) minBackoff() time.Duration {
+	if p.MinBackoff > 0 {
+		return p.MinBackoff
+	}
+	return defaultRetryMinBackoff
+}
+
+func (p *RetryPolicy) maxBackoff() time.Duration {
+	if p.MaxBackoff > 0 {
+		return p.MaxBackoff
+	}
+	return defaultRetryMaxBackoff
+}
+
+// notRun reports whether err shows the call wasn't run by the server.
+func notRun(err error) bool {
+	var rpcErr *Error
+	return errors.Is(err, ErrNoConnection) || errors.As(err, &rpcErr) && rpcErr.Category() == CategoryUnavailable
+}
+
+// retryable reports whether a call failing with err is retried.
+func (p *RetryPolicy) retryable(ctx context.Context, err error) bool {
+	if notRun(err) {
+		return true
+	}
+
+	if !isIdempotent(ctx) {
+		return false
+	}
+
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+
+	var lost *connError
+	return errors.As(err, &lost)
+}
+
+// do runs attempt until it succeeds, fails with an error that isn't retried or
+// runs out of attempts, or ctx is done.
+func (p *RetryPolicy) do(ctx context.Context, attempt func() (*Response, error)) (resp *Response, err error) {
+	if p.Budget != nil {
+		p.Budget.Deposit()
+	}
+
+	backoff := p.minBackoff()
+	for i := 1; ; i++ {
+		resp, err = attempt()
+		if err == nil || i >= p.maxAttempts() || ctx.Err() != nil || !p.retryable(ctx, err) {
+			return
+		}
+
+		if p.Budget != nil && !p.Budget.Withdraw() {
+			err = &budgetError{err: err}
+			return
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if backoff *= 2; backoff > p.maxBackoff() {
+			backoff = p.maxBackoff()
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package jsonrpc
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const retryBudgetBuckets = 10
+
+// ErrRetryBudgetExhausted is returned instead of retrying when the retry budget
+// has no room left, wrapping the error of the last attempt.
+var ErrRetryBudgetExhausted = errors.New("retry budget exhausted")
+
+// budgetError is the error of a call that wasn't retried for lack of budget. It
+// is both ErrRetryBudgetExhausted and err, the error of the last attempt.
+type budgetError struct {
+	err error
+}
+
+func (e *budgetError) Error() string {
+	return ErrRetryBudgetExhausted.Error() + ": " + e.err.Error()
+}
+
+func (e *budgetError) Is(target error) bool { return target == ErrRetryBudgetExhausted }
+func (e *budgetError) Unwrap() error        { return e.err }
+
+// RetryBudget caps retries to a fraction of the calls made over a sliding window,
+// so that retries can't amplify load during an incident: once the budget is
+// exhausted, callers should fail fast instead of retrying.
+type RetryBudget struct {
+	ratio      float64
+	minRetries int
+	bucketSize time.Duration
+
+	m       sync.Mutex
+	calls   [retryBudgetBuckets]int
+	retries [retryBudgetBuckets]int
+	head    int
+	headAt  time.Time
+}
+
+// NewRetryBudget returns a budget allowing retries to add at most ratio (e.g.
+// 0.1 for 10%) extra calls over window, plus minRetries so that low-traffic
+// clients can still retry.
+func NewRetryBudget(ratio float64, minRetries int, window time.Duration) *RetryBudget {
+	return &RetryBudget{
+		ratio:      ratio,
+		minRetries: minRetries,
+		bucketSize: window / retryBudgetBuckets,
+		headAt:     time.Now(),
+	}
+}
+
+// advance rotates the buckets up to now. Must be called with b.m held.
+func (b *RetryBudget) advance(now time.Time) {
+	if b.bucketSize <= 0 {
+		return
+	}
+
+	for n := 0; now.Sub(b.headAt) >= b.bucketSize && n < retryBudgetBuckets; n++ {
+		b.head = (b.head + 1) % retryBudgetBuckets
+		b.calls[b.head], b.retries[b.head] = 0, 0
+		b.headAt = b.headAt.Add(b.bucketSize)
+	}
+
+	if now.Sub(b.headAt) >= b.bucketSize {
+		b.headAt = now
+	}
+}
+
+// Deposit records a call, which earns ratio retries.
+func (b *RetryBudget) Deposit() {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	b.advance(time.Now())
+	b.calls[b.head]++
+}
+
+// Withdraw reports whether a retry is allowed and, if so, records it.
+func (b *RetryBudget) Withdraw() bool {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	b.advance(time.Now())
+
+	calls, retries := 0, 0
+	for i := 0; i < retryBudgetBuckets; i++ {
+		calls += b.calls[i]
+		retries += b.retries[i]
+	}
+
+	if float64(retries+1) > b.ratio*float64(calls)+float64(b.minRetries) {
+		return false
+	}
+
+	b.retries[b.head]++
+	return true
+}
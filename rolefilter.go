@@ -0,0 +1,276 @@
+package jsonrpc
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+var (
+	typeOfJSONMarshaler = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	typeOfTextMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// RoleFilter returns a ResultTransformer that strips struct fields tagged with
+// `rpc:"roles=admin|ops"` from results unless the caller has one of the listed
+// roles. roles reports the roles of the caller that issued req.
+func RoleFilter(roles func(req *Request) []string) ResultTransformer {
+	return func(req *Request, result interface{}) (interface{}, error) {
+		granted := make(map[string]bool)
+		for _, role := range roles(req) {
+			granted[role] = true
+		}
+
+		return filterValue(reflect.ValueOf(result), granted, make(map[visit]bool))
+	}
+}
+
+// fieldRoles parses the roles of an `rpc:"roles=a|b"` tag.
+func fieldRoles(field reflect.StructField) []string {
+	for _, opt := range strings.Split(field.Tag.Get("rpc"), ",") {
+		if strings.HasPrefix(opt, "roles=") {
+			return strings.Split(strings.TrimPrefix(opt, "roles="), "|")
+		}
+	}
+
+	return nil
+}
+
+// pathRoles returns the roles of the field of struct type t at index and of
+// the embedded structs promoting it, for those that have some.
+func pathRoles(t reflect.Type, index []int) (roles [][]string) {
+	for i := range index {
+		if required := fieldRoles(t.FieldByIndex(index[:i+1])); required != nil {
+			roles = append(roles, required)
+		}
+	}
+
+	return
+}
+
+func hasAnyRole(required []string, granted map[string]bool) bool {
+	for _, role := range required {
+		if granted[role] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// roleTypes caches whether the values of a type may hold fields with roles.
+var roleTypes sync.Map
+
+// hasRoleFields reports whether values of t may hold struct fields tagged with
+// roles, and need to be rebuilt to filter them. Types marshaling themselves
+// are left to their marshaler.
+func hasRoleFields(t reflect.Type) bool {
+	if has, ok := roleTypes.Load(t); ok {
+		return has.(bool)
+	}
+
+	has := typeHasRoles(t, make(map[reflect.Type]bool))
+	roleTypes.Store(t, has)
+	return has
+}
+
+func typeHasRoles(t reflect.Type, visiting map[reflect.Type]bool) bool {
+	if visiting[t] || marshalsItself(t) {
+		return false
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return typeHasRoles(t.Elem(), visiting)
+	case reflect.Interface:
+		// the dynamic type is only known from values
+		return true
+	case reflect.Struct:
+		for _, field := range jsonFields(t) {
+			if pathRoles(t, field.index) != nil || typeHasRoles(field.typ, visiting) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func marshalsItself(t reflect.Type) bool {
+	for _, m := range []reflect.Type{typeOfJSONMarshaler, typeOfTextMarshaler} {
+		if t.Implements(m) || t.Kind() != reflect.Ptr && reflect.PtrTo(t).Implements(m) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// visit identifies a pointer, map or slice being filtered, to detect cycles.
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+// filterValue returns v with the struct fields the granted roles can't see
+// removed, rebuilding the structs that have such fields as maps. The values
+// without any are returned as they are, addressable ones by pointer so that
+// encoding/json still calls the marshalers of their pointer.
+func filterValue(v reflect.Value, granted map[string]bool, visiting map[visit]bool) (interface{}, error) {
+	if !v.IsValid() {
+		return nil, nil
+	}
+
+	t := v.Type()
+	if !hasRoleFields(t) {
+		if v.CanAddr() {
+			return v.Addr().Interface(), nil
+		}
+		return v.Interface(), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		if v.IsNil() {
+			return nil, nil
+		}
+
+		key := visit{ptr: v.Pointer(), typ: t}
+		if v.Kind() == reflect.Slice {
+			key.len = v.Len()
+		}
+		if visiting[key] {
+			return nil, &json.UnsupportedValueError{Value: v, Str: "encountered a cycle via " + t.String()}
+		}
+		visiting[key] = true
+		defer delete(visiting, key)
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return filterValue(v.Elem(), granted, visiting)
+	case reflect.Struct:
+		return filterStruct(v, granted, visiting)
+	case reflect.Slice, reflect.Array:
+		out := make([]interface{}, v.Len())
+		for i := range out {
+			elem, err := filterValue(v.Index(i), granted, visiting)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = elem
+		}
+		return out, nil
+	case reflect.Map:
+		out := reflect.MakeMapWithSize(reflect.MapOf(t.Key(), reflect.TypeOf((*interface{})(nil)).Elem()), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			elem, err := filterValue(iter.Value(), granted, visiting)
+			if err != nil {
+				return nil, err
+			}
+			if elem == nil {
+				out.SetMapIndex(iter.Key(), reflect.Zero(out.Type().Elem()))
+				continue
+			}
+			out.SetMapIndex(iter.Key(), reflect.ValueOf(elem))
+		}
+		return out.Interface(), nil
+	}
+
+	return v.Interface(), nil
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	case reflect.Struct:
+		return false
+	}
+
+	return v.IsZero()
+}
+
+// filterStruct returns the fields of v encoding/json encodes and the granted
+// roles can see, by name. A field is hidden if it, or an embedded struct
+// promoting it, requires a role that isn't granted.
+func filterStruct(v reflect.Value, granted map[string]bool, visiting map[visit]bool) (map[string]interface{}, error) {
+	t := v.Type()
+
+	out := make(map[string]interface{})
+fields:
+	for _, field := range jsonFields(t) {
+		for _, required := range pathRoles(t, field.index) {
+			if !hasAnyRole(required, granted) {
+				continue fields
+			}
+		}
+
+		fv, ok := fieldByIndex(v, field.index)
+		if !ok || field.omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+
+		if field.quoted {
+			if quoted, ok, err := quoteScalar(fv); ok {
+				if err != nil {
+					return nil, err
+				}
+				out[field.name] = quoted
+				continue
+			}
+		}
+
+		value, err := filterValue(fv, granted, visiting)
+		if err != nil {
+			return nil, err
+		}
+		out[field.name] = value
+	}
+
+	return out, nil
+}
+
+// quoteScalar encodes v like encoding/json does a field with the string
+// option, reporting false if the option doesn't apply to values of its type.
+func quoteScalar(v reflect.Value) (quoted interface{}, ok bool, err error) {
+	if marshalsItself(v.Type()) {
+		return
+	}
+
+	if v.Kind() == reflect.Ptr && v.Type().Name() == "" {
+		switch v.Type().Elem().Kind() {
+		case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+			reflect.Float32, reflect.Float64, reflect.String:
+		default:
+			return
+		}
+		if v.IsNil() {
+			return nil, true, nil
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.String:
+		var b []byte
+		b, err = json.Marshal(v.Interface())
+		return string(b), true, err
+	}
+
+	return
+}
@@ -0,0 +1,114 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// Celsius marshals itself with a pointer receiver.
+type Celsius float64
+
+func (c *Celsius) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf(`"%.1fC"`, float64(*c))), nil
+}
+
+type Audit struct {
+	By string `json:"by"`
+}
+
+type Reading struct {
+	ID      int64    `json:"id,string"`
+	Count   *int     `json:"count,string,omitempty"`
+	Temp    Celsius  `json:"temp"`
+	Secret  string   `json:"secret" rpc:"roles=admin|ops"`
+	Tags    []string `json:"tags,omitempty"`
+	*Audit  `rpc:"roles=admin"`
+	private int
+}
+
+type Node struct {
+	Name   string
+	Secret string `rpc:"roles=admin"`
+	Next   *Node  `json:",omitempty"`
+}
+
+func filterRoles(t *testing.T, result interface{}, roles ...string) string {
+	t.Helper()
+
+	filter := RoleFilter(func(req *Request) []string { return roles })
+	filtered, err := filter(&Request{}, result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := json.Marshal(filtered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestRoleFilter(t *testing.T) {
+	count := 3
+	reading := &Reading{ID: 42, Count: &count, Temp: 21.5, Secret: "s3", Audit: &Audit{By: "ops"}}
+
+	tests := []struct {
+		roles []string
+		want  string
+	}{
+		{nil, `{"count":"3","id":"42","temp":"21.5C"}`},
+		{[]string{"ops"}, `{"count":"3","id":"42","secret":"s3","temp":"21.5C"}`},
+		{[]string{"admin"}, `{"by":"ops","count":"3","id":"42","secret":"s3","temp":"21.5C"}`},
+	}
+	for _, test := range tests {
+		if got := filterRoles(t, reading, test.roles...); got != test.want {
+			t.Errorf("roles %v: got %s, want %s", test.roles, got, test.want)
+		}
+	}
+
+	// without any role restriction the output is encoding/json's
+	nodes := []*Node{{Name: "a"}, {Name: "b"}}
+	if got := filterRoles(t, map[string][]*Node{"nodes": nodes}); got != `{"nodes":[{"Name":"a"},{"Name":"b"}]}` {
+		t.Errorf("nodes: got %s", got)
+	}
+}
+
+func TestRoleFilterUntouched(t *testing.T) {
+	type plain struct {
+		ID   int64   `json:"id,string"`
+		Temp Celsius `json:"temp"`
+	}
+
+	filter := RoleFilter(func(req *Request) []string { return nil })
+
+	in := &plain{ID: 7, Temp: 3}
+	out, err := filter(&Request{}, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != interface{}(in) {
+		t.Errorf("result without role fields rebuilt as %#v", out)
+	}
+}
+
+func TestRoleFilterCycles(t *testing.T) {
+	a := &Node{Name: "a"}
+	b := &Node{Name: "b", Next: a}
+	a.Next = b
+
+	filter := RoleFilter(func(req *Request) []string { return nil })
+	_, err := filter(&Request{}, a)
+
+	var unsupported *json.UnsupportedValueError
+	if !errors.As(err, &unsupported) {
+		t.Fatalf("cycle filtered with %v", err)
+	}
+
+	// a value reached twice without a cycle isn't one
+	shared := &Node{Name: "shared", Secret: "x"}
+	if got := filterRoles(t, []*Node{shared, shared}); got != `[{"Name":"shared"},{"Name":"shared"}]` {
+		t.Errorf("shared node: got %s", got)
+	}
+}
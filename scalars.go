@@ -0,0 +1,669 @@
+package jsonrpc
+
+import (
+	"encoding"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ScalarFormat encodes and decodes the values of one Go type, replacing the
+// encoding encoding/json gives them.
+type ScalarFormat struct {
+	// Name describes the format to peers, it is reported by rpc.info.
+	Name string
+
+	// Encode returns the JSON value of v, a value of the registered type.
+	Encode func(v interface{}) (interface{}, error)
+
+	// Decode returns the value of the registered type, or of a type
+	// convertible to it, encoded in data.
+	Decode func(data json.RawMessage) (interface{}, error)
+}
+
+// Formats for time.Time, time.Duration, []byte, int64 and uint64, to be set on
+// a Scalars.
+var (
+	TimeRFC3339 = ScalarFormat{
+		Name: "rfc3339",
+		Encode: func(v interface{}) (interface{}, error) {
+			return v.(time.Time).Format(time.RFC3339), nil
+		},
+		Decode: func(data json.RawMessage) (interface{}, error) {
+			var s string
+			if err := json.Unmarshal(data, &s); err != nil {
+				return nil, err
+			}
+			return time.Parse(time.RFC3339, s)
+		},
+	}
+
+	TimeUnixMillis = ScalarFormat{
+		Name: "unixMillis",
+		Encode: func(v interface{}) (interface{}, error) {
+			return v.(time.Time).UnixNano() / int64(time.Millisecond), nil
+		},
+		Decode: func(data json.RawMessage) (interface{}, error) {
+			var ms int64
+			if err := json.Unmarshal(data, &ms); err != nil {
+				return nil, err
+			}
+			return time.Unix(0, ms*int64(time.Millisecond)), nil
+		},
+	}
+
+	DurationMillis = ScalarFormat{
+		Name: "millis",
+		Encode: func(v interface{}) (interface{}, error) {
+			return v.(time.Duration).Milliseconds(), nil
+		},
+		Decode: func(data json.RawMessage) (interface{}, error) {
+			var ms int64
+			if err := json.Unmarshal(data, &ms); err != nil {
+				return nil, err
+			}
+			return time.Duration(ms) * time.Millisecond, nil
+		},
+	}
+
+	DurationString = ScalarFormat{
+		Name: "string",
+		Encode: func(v interface{}) (interface{}, error) {
+			return v.(time.Duration).String(), nil
+		},
+		Decode: func(data json.RawMessage) (interface{}, error) {
+			var s string
+			if err := json.Unmarshal(data, &s); err != nil {
+				return nil, err
+			}
+			return time.ParseDuration(s)
+		},
+	}
+
+	BytesHex = ScalarFormat{
+		Name: "hex",
+		Encode: func(v interface{}) (interface{}, error) {
+			return hex.EncodeToString(v.([]byte)), nil
+		},
+		Decode: func(data json.RawMessage) (interface{}, error) {
+			var s string
+			if err := json.Unmarshal(data, &s); err != nil {
+				return nil, err
+			}
+			return hex.DecodeString(s)
+		},
+	}
+
+	BytesBase64URL = ScalarFormat{
+		Name: "base64url",
+		Encode: func(v interface{}) (interface{}, error) {
+			return base64.RawURLEncoding.EncodeToString(v.([]byte)), nil
+		},
+		Decode: func(data json.RawMessage) (interface{}, error) {
+			var s string
+			if err := json.Unmarshal(data, &s); err != nil {
+				return nil, err
+			}
+			return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+		},
+	}
+
+	// Int64String and Uint64String encode 64-bit integers as decimal strings,
+	// for JavaScript peers whose numbers lose precision beyond 2^53. Both
+	// strings and numbers are decoded.
+	Int64String = ScalarFormat{
+		Name: "string",
+		Encode: func(v interface{}) (interface{}, error) {
+			return strconv.FormatInt(v.(int64), 10), nil
+		},
+		Decode: func(data json.RawMessage) (interface{}, error) {
+			var n int64
+			err := unmarshalIntString(data, &n, func(s string) (err error) {
+				n, err = strconv.ParseInt(s, 10, 64)
+				return
+			})
+			return n, err
+		},
+	}
+
+	Uint64String = ScalarFormat{
+		Name: "string",
+		Encode: func(v interface{}) (interface{}, error) {
+			return strconv.FormatUint(v.(uint64), 10), nil
+		},
+		Decode: func(data json.RawMessage) (interface{}, error) {
+			var n uint64
+			err := unmarshalIntString(data, &n, func(s string) (err error) {
+				n, err = strconv.ParseUint(s, 10, 64)
+				return
+			})
+			return n, err
+		},
+	}
+)
+
+// unmarshalIntString decodes data, a JSON number into n or a JSON string
+// parsed by parse.
+func unmarshalIntString(data json.RawMessage, n interface{}, parse func(s string) error) error {
+	if firstByte(data) != '"' {
+		return json.Unmarshal(data, n)
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	return parse(s)
+}
+
+// Scalars maps Go types to the format of their values on the wire, for peers
+// that disagree with encoding/json, e.g. on times as unix milliseconds or bytes
+// as hex. Types without a format keep encoding/json's. Set a Scalars on
+// Server.Scalars and with Client.SetScalars before serving or calling.
+type Scalars struct {
+	formats map[reflect.Type]ScalarFormat
+
+	// the case of untagged field names, see SetFieldCase
+	fieldCase FieldCase
+
+	// types without a format in their values, see plain
+	plainTypes sync.Map
+
+	// the fields of struct types under their wire names, see fields
+	casedFields sync.Map
+}
+
+// NewScalars returns a Scalars without formats.
+func NewScalars() *Scalars {
+	return &Scalars{formats: make(map[reflect.Type]ScalarFormat)}
+}
+
+// Set uses f for the values of the type of example, e.g. time.Time{}.
+func (s *Scalars) Set(example interface{}, f ScalarFormat) *Scalars {
+	s.formats[reflect.TypeOf(example)] = f
+	return s
+}
+
+// Int64Strings uses Int64String and Uint64String for int64 and uint64 values.
+func (s *Scalars) Int64Strings() *Scalars {
+	return s.Set(int64(0), Int64String).Set(uint64(0), Uint64String)
+}
+
+// Formats returns the name of the format of each type, as reported by rpc.info.
+func (s *Scalars) Formats() map[string]string {
+	if s == nil || len(s.formats) == 0 {
+		return nil
+	}
+
+	formats := make(map[string]string, len(s.formats))
+	for t, f := range s.formats {
+		formats[t.String()] = f.Name
+	}
+	return formats
+}
+
+// plain reports whether values of t are encoded without any format.
+func (s *Scalars) plain(t reflect.Type) bool {
+	if s == nil || len(s.formats) == 0 && s.fieldCase == GoCase {
+		return true
+	}
+
+	if plain, ok := s.plainTypes.Load(t); ok {
+		return plain.(bool)
+	}
+
+	plain := s.plainType(t, make(map[reflect.Type]bool))
+	s.plainTypes.Store(t, plain)
+	return plain
+}
+
+func (s *Scalars) plainType(t reflect.Type, visiting map[reflect.Type]bool) bool {
+	if _, ok := s.formats[t]; ok {
+		return false
+	}
+
+	if visiting[t] || t.Kind() != reflect.Ptr && t.Implements(typeOfJSONMarshaler) {
+		return true
+	}
+	visiting[t] = true
+
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return s.plainType(t.Elem(), visiting)
+	case reflect.Map:
+		return s.plainType(t.Elem(), visiting)
+	case reflect.Interface:
+		// the dynamic type is only known from values
+		return false
+	case reflect.Struct:
+		for _, field := range jsonFields(t) {
+			if !field.tagged && s.fieldCase != GoCase || !s.plainType(field.typ, visiting) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// encode returns v with the values of types with a format replaced by their
+// encoding, ready for encoding/json.
+func (s *Scalars) encode(v interface{}) (interface{}, error) {
+	if v == nil || s.plain(reflect.TypeOf(v)) {
+		return v, nil
+	}
+
+	return s.encodeValue(reflect.ValueOf(v))
+}
+
+func (s *Scalars) encodeValue(v reflect.Value) (interface{}, error) {
+	if !v.IsValid() {
+		return nil, nil
+	}
+
+	t := v.Type()
+	if f, ok := s.formats[t]; ok {
+		return f.Encode(v.Interface())
+	}
+
+	if s.plain(t) {
+		return v.Interface(), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return s.encodeValue(v.Elem())
+	case reflect.Struct:
+		out := make(map[string]interface{})
+		for _, field := range s.fields(t) {
+			fv, ok := fieldByIndex(v, field.index)
+			if !ok || field.omitEmpty && isEmptyValue(fv) {
+				continue
+			}
+
+			value, err := s.encodeValue(fv)
+			if err != nil {
+				return nil, err
+			}
+			out[field.name] = value
+		}
+		return out, nil
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil, nil
+		}
+		fallthrough
+	case reflect.Array:
+		out := make([]interface{}, v.Len())
+		for i := range out {
+			value, err := s.encodeValue(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			out[i] = value
+		}
+		return out, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, nil
+		}
+		out := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := mapKey(iter.Key())
+			if err != nil {
+				return nil, err
+			}
+
+			value, err := s.encodeValue(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			out[key] = value
+		}
+		return out, nil
+	}
+
+	return v.Interface(), nil
+}
+
+// mapKey returns the object member name encoding/json gives the map key k.
+func mapKey(k reflect.Value) (string, error) {
+	if k.Kind() == reflect.String {
+		return k.String(), nil
+	}
+
+	data, err := json.Marshal(k.Interface())
+	if err != nil {
+		return "", err
+	}
+
+	var key string
+	if json.Unmarshal(data, &key) == nil {
+		return key, nil
+	}
+	return string(data), nil
+}
+
+// marshal encodes v using the formats of s.
+func (s *Scalars) marshal(v interface{}) ([]byte, error) {
+	encoded, err := s.encode(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(encoded)
+}
+
+// decodeParams decodes params like the package's decodeParams, using the
+// formats of s. Types with a format decode the params as they are.
+func (s *Scalars) decodeParams(params json.RawMessage, in interface{}) error {
+	if s != nil {
+		for t := reflect.TypeOf(in).Elem(); ; t = t.Elem() {
+			if _, ok := s.formats[t]; ok {
+				return s.unmarshal(params, in)
+			}
+			if t.Kind() != reflect.Ptr {
+				break
+			}
+		}
+	}
+
+	return decodeParamsWith(params, in, s.unmarshal)
+}
+
+// unmarshal decodes data into v, a pointer, using the formats of s.
+func (s *Scalars) unmarshal(data []byte, v interface{}) error {
+	if v == nil || s.plain(reflect.TypeOf(v)) {
+		return json.Unmarshal(data, v)
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return json.Unmarshal(data, v)
+	}
+
+	return s.decodeValue(data, rv.Elem())
+}
+
+func (s *Scalars) decodeValue(data json.RawMessage, v reflect.Value) error {
+	t := v.Type()
+
+	if f, ok := s.formats[t]; ok {
+		if firstByte(data) == 'n' {
+			return nil
+		}
+
+		value, err := f.Decode(data)
+		if err != nil {
+			return fmt.Errorf("decoding %s: %v", t, err)
+		}
+
+		rv := reflect.ValueOf(value)
+		if !rv.IsValid() || !rv.Type().ConvertibleTo(t) {
+			return fmt.Errorf("decoding %s: format %s returned %T", t, f.Name, value)
+		}
+		v.Set(rv.Convert(t))
+		return nil
+	}
+
+	if s.plain(t) || t.Kind() == reflect.Interface {
+		return json.Unmarshal(data, v.Addr().Interface())
+	}
+
+	if firstByte(data) == 'n' {
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Map:
+			v.Set(reflect.Zero(t))
+		}
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(t.Elem()))
+		}
+		return s.decodeValue(data, v.Elem())
+	case reflect.Struct:
+		var members map[string]json.RawMessage
+		if err := json.Unmarshal(data, &members); err != nil {
+			return err
+		}
+
+		fields := s.fields(t)
+		for name, member := range members {
+			field, ok := lookupField(fields, name)
+			if !ok {
+				continue
+			}
+
+			if err := s.decodeValue(member, fieldByIndexAlloc(v, field.index)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Slice, reflect.Array:
+		var elems []json.RawMessage
+		if err := json.Unmarshal(data, &elems); err != nil {
+			return err
+		}
+
+		if v.Kind() == reflect.Slice {
+			v.Set(reflect.MakeSlice(t, len(elems), len(elems)))
+		}
+
+		for i := 0; i < len(elems) && i < v.Len(); i++ {
+			if err := s.decodeValue(elems[i], v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		var members map[string]json.RawMessage
+		if err := json.Unmarshal(data, &members); err != nil {
+			return err
+		}
+
+		if v.IsNil() {
+			v.Set(reflect.MakeMapWithSize(t, len(members)))
+		}
+
+		for name, member := range members {
+			key, err := parseMapKey(name, t.Key())
+			if err != nil {
+				return err
+			}
+
+			elem := reflect.New(t.Elem()).Elem()
+			if err = s.decodeValue(member, elem); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, elem)
+		}
+		return nil
+	}
+
+	return json.Unmarshal(data, v.Addr().Interface())
+}
+
+// parseMapKey converts the object member name into a map key of type t.
+func parseMapKey(name string, t reflect.Type) (reflect.Value, error) {
+	key := reflect.New(t)
+
+	if u, ok := key.Interface().(encoding.TextUnmarshaler); ok {
+		return key.Elem(), u.UnmarshalText([]byte(name))
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		key.Elem().SetString(name)
+		return key.Elem(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(name, 10, t.Bits())
+		key.Elem().SetInt(n)
+		return key.Elem(), err
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(name, 10, t.Bits())
+		key.Elem().SetUint(n)
+		return key.Elem(), err
+	}
+
+	return key.Elem(), fmt.Errorf("unsupported map key type %s", t)
+}
+
+// jsonField is a struct field as seen by encoding/json.
+type jsonField struct {
+	name      string
+	index     []int
+	typ       reflect.Type
+	omitEmpty bool
+
+	// set if name is given by a json tag, and if the tag has the string
+	// option
+	tagged bool
+	quoted bool
+}
+
+var jsonFieldsCache sync.Map
+
+// jsonFields returns the fields encoding/json encodes for struct type t,
+// promoting the fields of untagged embedded structs unless a shallower field
+// has the same name.
+func jsonFields(t reflect.Type) []jsonField {
+	if fields, ok := jsonFieldsCache.Load(t); ok {
+		return fields.([]jsonField)
+	}
+
+	fields := collectFields(t, nil, make(map[reflect.Type]bool))
+	jsonFieldsCache.Store(t, fields)
+	return fields
+}
+
+func collectFields(t reflect.Type, index []int, visiting map[reflect.Type]bool) (fields []jsonField) {
+	if visiting[t] {
+		return
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	type embeddedField struct {
+		typ   reflect.Type
+		index []int
+	}
+	var embedded []embeddedField
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts := tag, ""
+		if idx := strings.Index(tag, ","); idx >= 0 {
+			name, opts = tag[:idx], tag[idx+1:]
+		}
+
+		fieldIndex := append(append([]int(nil), index...), i)
+
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded = append(embedded, embeddedField{ft, fieldIndex})
+				continue
+			}
+		}
+
+		if field.PkgPath != "" {
+			continue
+		}
+
+		tagged := name != ""
+		if !tagged {
+			name = field.Name
+		}
+
+		fields = append(fields, jsonField{
+			name:      name,
+			index:     fieldIndex,
+			typ:       field.Type,
+			omitEmpty: strings.Contains(","+opts+",", ",omitempty,"),
+			tagged:    tagged,
+			quoted:    strings.Contains(","+opts+",", ",string,"),
+		})
+	}
+
+	for _, e := range embedded {
+		for _, promoted := range collectFields(e.typ, e.index, visiting) {
+			if _, ok := lookupField(fields, promoted.name); !ok {
+				fields = append(fields, promoted)
+			}
+		}
+	}
+
+	return
+}
+
+// lookupField finds the field named name, preferring an exact match over a
+// case-insensitive one like encoding/json.
+func lookupField(fields []jsonField, name string) (jsonField, bool) {
+	for _, field := range fields {
+		if field.name == name {
+			return field, true
+		}
+	}
+
+	for _, field := range fields {
+		if strings.EqualFold(field.name, name) {
+			return field, true
+		}
+	}
+
+	return jsonField{}, false
+}
+
+// fieldByIndex returns the field of struct v at index, false if it is reached
+// through a nil embedded pointer.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+
+	return v, true
+}
+
+// fieldByIndexAlloc returns the field of struct v at index, allocating the nil
+// embedded pointers on the way.
+func fieldByIndexAlloc(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+
+	return v
+}
@@ -1,12 +1,21 @@
 package jsonrpc
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"net"
+	"net/http"
+	"os"
 	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 	"unicode"
 	"unicode/utf8"
 )
@@ -14,108 +23,629 @@ import (
 var (
 	typeOfError      = reflect.TypeOf((*error)(nil)).Elem()
 	NoExportedMethod = errors.New("no exported method")
+
+	// a service with the same name is already registered
+	ErrServiceExists = errors.New("service already registered")
+
+	// the handler's result could not be encoded
+	ErrUnmarshalableResult = &Error{Code: CodeInternalError, Message: "internal: unmarshalable result"}
 )
 
 type Request struct {
-	Id     uint32          `json:"id"`
+	// Id is the request id as it appeared on the wire: a string, a number or
+	// null. It is echoed back unchanged in the response.
+	Id     json.RawMessage `json:"id"`
 	Method string          `json:"method"`
 	Param  json.RawMessage `json:"param"`
+
+	// Meta carries per-call metadata such as trace ids, auth tokens or tenant
+	// info, read by handlers with MetaFromContext.
+	Meta map[string]string `json:"meta,omitempty"`
+
+	received     time.Time
+	notification bool
+
+	// the formats in effect on the connection when the request was read
+	scalars *Scalars
+
+	// the params in the format of the connection's codec, set instead of
+	// Param, see Protocol.setParams
+	encoded encodedValue
+}
+
+// IsNotification reports whether req was sent without an id, in which case no
+// response is sent back.
+func (req *Request) IsNotification() bool {
+	return req.notification
 }
 
 func (req *Request) Regular() error {
-	parts := strings.Split(req.Method, ".")
-	if len(parts) != 2 {
-		return fmt.Errorf("invalid method: %s", req.Method)
+	i := strings.LastIndex(req.Method, ".")
+	if i < 0 {
+		return newError(CodeInvalidRequest, "invalid method: %s", req.Method)
 	}
 
-	if parts[0] == "" {
-		return fmt.Errorf("invalid service name: %s", parts[0])
+	serviceName, methodName := req.Method[:i], req.Method[i+1:]
+
+	if !validServiceName(serviceName) {
+		return newError(CodeInvalidRequest, "invalid service name: %s", serviceName)
 	}
 
-	if parts[1] == "" {
-		return fmt.Errorf("invalid serviceMethod name: %s", parts[1])
+	if methodName == "" {
+		return newError(CodeInvalidRequest, "invalid serviceMethod name: %s", methodName)
 	}
 
 	return nil
 }
 
+// splitMethod splits method into its service name, which may contain dots, and
+// the name of the method within the service.
+func splitMethod(method string) (serviceName, methodName string, ok bool) {
+	i := strings.LastIndex(method, ".")
+	if i < 0 {
+		return
+	}
+
+	serviceName, methodName = method[:i], method[i+1:]
+	return serviceName, methodName, validServiceName(serviceName) && methodName != ""
+}
+
+// validServiceName reports whether name is made of non-empty dot-separated
+// parts, e.g. billing or billing.v2.
+func validServiceName(name string) bool {
+	for _, part := range strings.Split(name, ".") {
+		if part == "" {
+			return false
+		}
+	}
+
+	return true
+}
+
 type Response struct {
-	Id     uint32          `json:"id"`
+	Id     json.RawMessage `json:"id"`
 	Result json.RawMessage `json:"result"`
 	Error  string          `json:"error"`
+
+	err error
+
+	// the result in the format of the connection's codec, set instead of
+	// Result, see Connection.resultEncoder
+	encoded encodedValue
 }
 
 type Connection struct {
-	s     *Server
-	c     net.Conn
-	codec *Codec
+	s      *Server
+	c      net.Conn
+	codec  Codec
+	audit  *auditConn
+	info   *ConnInfo
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	protocol Protocol
+
+	// receivers built by service factories for this connection
+	receivers map[*service]reflect.Value
+	rm        sync.Mutex
+
+	// cancel functions of running requests by id, and cancellations received
+	// before their request started
+	inflight     map[string]context.CancelFunc
+	earlyCancels map[string]bool
+	cancelMu     sync.Mutex
+
+	// calls issued to the peer, see Call
+	calls   map[uint32]chan *Response
+	callSeq uint32 // the id of the last call, guarded by cm
+	cm      sync.Mutex
+
+	// a slot per request being handled, and the frames handled or waiting
+	// for a slot, see startFrame
+	handlers chan struct{}
+	frames   int32
+	running  sync.WaitGroup
+
+	out      chan interface{}
+	control  chan interface{}
+	outMu    sync.RWMutex
+	closed   bool
+	writer   onDemand
+	writeErr error
+
+	// formats asked for with rpc.scalars
+	formats connScalars
+
+	// unset if the server requires checksums the codec can't carry
+	checksum bool
+
+	// protocol violations committed on the connection, see BanPolicy
+	violations int32
+
+	// set when serving the callback services of a client, which writes frames
+	// itself
+	client *Client
+}
+
+func newConnection(s *Server, rw net.Conn) *Connection {
+	info := &ConnInfo{
+		RemoteAddr:  rw.RemoteAddr(),
+		LocalAddr:   rw.LocalAddr(),
+		ConnectedAt: time.Now(),
+	}
+
+	out := s.throttle(rw)
+
+	var audit *auditConn
+	if s.AuditResponse != nil {
+		audit = &auditConn{Conn: out}
+		out = audit
+	}
+
+	conn := &Connection{
+		c:     rw,
+		s:     s,
+		codec: s.codec()(out),
+		audit: audit,
+		info:  info,
+
+		protocol: s.Protocol,
+
+		handlers: make(chan struct{}, maxConcurrentRequests),
+		out:      make(chan interface{}, s.writeQueueSize()),
+		control:  make(chan interface{}, controlQueueSize),
+	}
+	conn.checksum = setChecksum(conn.codec, s.Checksum)
+
+	ctx := context.WithValue(context.Background(), connInfoKey{}, info)
+	conn.ctx, conn.cancel = context.WithCancel(context.WithValue(ctx, connKey{}, conn))
+
+	return conn
 }
 
+// maxConcurrentRequests bounds the requests handled at once on a connection.
+// The frames read while that many are running wait for a slot, up to
+// maxWaitingRequests of them; the ones after are rejected as busy.
+const (
+	maxConcurrentRequests = 64
+	maxWaitingRequests    = 4096
+)
+
+// Serve reads frames until the connection fails. Each frame is handled by a
+// goroutine of its own, so a slow handler doesn't hold up the requests after it
+// and the context of a running handler is canceled as soon as the client
+// disconnects. Responses are written in the order they complete by a dedicated
+// writer through a bounded queue. The writer only runs while it has work, an
+// idle connection holds no goroutine but its reader.
 func (conn *Connection) Serve() {
 	defer conn.c.Close()
 
+	if !conn.checksum {
+		conn.s.logf("jsonrpc: refusing connection from %s: the codec can't carry checksums", conn.info.RemoteAddr)
+		return
+	}
+
+	if !conn.s.trackConn(conn) {
+		return
+	}
+	defer conn.s.untrackConn(conn)
+
+	// checked once tracked: a ban from then on closes the connection
+	if conn.banned() {
+		conn.s.logf("jsonrpc: refusing connection from banned %s", conn.info.RemoteAddr)
+		return
+	}
+
+	if err := conn.handshake(); err != nil {
+		conn.s.logf("jsonrpc: TLS handshake with %s: %v", conn.info.RemoteAddr, err)
+		conn.violation(ViolationAuth, err)
+		return
+	}
+
+	conn.openReceivers()
+	defer conn.releaseReceivers()
+
 	for {
-		var req *Request
-		err := conn.codec.decoder.Decode(&req)
+		raw, err := conn.readFrame()
 		if err != nil {
-			return
+			break
 		}
 
-		conn.do(req)
+		// responses to calls made with Call, cancellations and pings are
+		// handled by the reader itself, which never waits for a request
+		// slot: the handlers they concern may hold every one of them
+		fields := frameFields(raw)
+		if isResponse(fields) {
+			conn.deliver(raw)
+			continue
+		}
+
+		if id, ok := cancelTarget(fields); ok {
+			conn.cancelRequest(id)
+			continue
+		}
+
+		if isPing(fields) {
+			conn.servePing(raw)
+			continue
+		}
+
+		// rpc.scalars is handled before reading on, so that the frames
+		// after it are read in the formats it negotiates
+		if _, ok := builtinParams(fields, scalarsMethod); ok {
+			conn.begin()
+			conn.handleFrame(raw, conn.scalars())
+			conn.done()
+			continue
+		}
+
+		conn.startFrame(raw)
 	}
+
+	conn.s.unsubscribe(conn)
+	conn.cancel()
+	conn.running.Wait()
+
+	conn.outMu.Lock()
+	conn.closed = true
+	conn.outMu.Unlock()
+	conn.writer.wait()
 }
 
-func (conn *Connection) do(req *Request) {
-	if err := req.Regular(); err != nil {
-		conn.replyError(req.Id, err)
+// readFrame returns the next frame, a request or a batch of requests. A
+// malformed frame is answered with a parse error and ends the connection, since
+// the stream can't be resynchronized. So does a frame with an invalid checksum,
+// whose id can't be trusted.
+func (conn *Connection) readFrame() (raw json.RawMessage, err error) {
+	err = conn.codec.Decode(&raw)
+
+	if malformedFrame(err) {
+		conn.s.logf("jsonrpc: parse error from %s: %v", conn.info.RemoteAddr, err)
+		conn.replyError(&Request{received: time.Now()}, newError(CodeParseError, "parse error: %v", err))
+		conn.violation(ViolationBadFrame, err)
+	}
+
+	if errors.Is(err, ErrChecksumMismatch) {
+		conn.s.checksumMismatch(conn)
+		conn.violation(ViolationBadFrame, err)
+	}
+
+	if err == nil && conn.protocol == ProtocolAuto {
+		conn.protocol = detectProtocol(raw)
+	}
+
+	return
+}
+
+// startFrame handles raw on its own goroutine, or on the server's worker pool
+// if it has one, once it has a slot in conn.handlers. The reader doesn't wait
+// for the slot: it goes on reading the responses to the calls of the running
+// handlers, which may hold every slot until they are answered.
+func (conn *Connection) startFrame(raw json.RawMessage) {
+	conn.begin()
+
+	if atomic.LoadInt32(&conn.frames) > maxConcurrentRequests+maxWaitingRequests {
+		conn.s.logf("jsonrpc: too many requests waiting, rejecting request from %s", conn.info.RemoteAddr)
+		conn.rejectFrame(raw)
 		return
 	}
 
-	parts := strings.Split(req.Method, ".")
-	svc, err := conn.s.getService(parts[0])
-	if err != nil {
-		conn.replyError(req.Id, err)
+	scalars := conn.scalars()
+
+	if conn.s.HandlerWorkers <= 0 {
+		go conn.serveFrame(raw, scalars)
 		return
 	}
 
-	mthd, err := svc.getMethod(parts[1])
-	if err != nil {
-		conn.replyError(req.Id, err)
+	if !conn.s.workers().submit(func() { conn.serveFrame(raw, scalars) }) {
+		conn.s.logf("jsonrpc: worker pool full, rejecting request from %s", conn.info.RemoteAddr)
+		conn.rejectFrame(raw)
+	}
+}
+
+// serveFrame waits for a slot in conn.handlers, handles raw in the formats
+// scalars and releases the slot. Frames still waiting when the connection
+// ends are dropped.
+func (conn *Connection) serveFrame(raw json.RawMessage, scalars *Scalars) {
+	select {
+	case conn.handlers <- struct{}{}:
+	case <-conn.ctx.Done():
+		conn.done()
 		return
 	}
+	defer conn.release()
 
-	var inParam reflect.Value
+	conn.handleFrame(raw, scalars)
+}
 
-	inParam = reflect.New(mthd.inType)
+func (conn *Connection) handleFrame(raw json.RawMessage, scalars *Scalars) {
+	if frame := conn.respond(raw, scalars); frame != nil {
+		conn.enqueue(frame)
+	}
+}
 
-	err = json.Unmarshal(req.Param, inParam.Interface())
+// begin counts a frame passed on by the reader until done is called for it.
+func (conn *Connection) begin() {
+	atomic.AddInt32(&conn.frames, 1)
+	conn.running.Add(1)
+}
 
-	outParam := reflect.New(mthd.outType.Elem())
+func (conn *Connection) done() {
+	atomic.AddInt32(&conn.frames, -1)
+	conn.running.Done()
+}
 
-	returnValues := mthd.method.Func.Call([]reflect.Value{svc.receiverValue, inParam.Elem(), outParam})
+func (conn *Connection) release() {
+	<-conn.handlers
+	conn.done()
+}
 
-	errInter := returnValues[0].Interface()
+// respond handles raw, a request or a batch of requests whose values are in
+// the formats scalars, and returns the frame to send back, nil if there is
+// none.
+func (conn *Connection) respond(raw json.RawMessage, scalars *Scalars) interface{} {
+	if firstByte(raw) == '[' {
+		return conn.serveBatch(raw, scalars)
+	}
 
-	if errInter != nil {
-		conn.replyError(req.Id, errInter.(error))
+	req, err := conn.parseRequest(raw)
+	req.scalars = scalars
+	if err != nil {
+		conn.violation(ViolationInvalidRequest, err)
+		return conn.audited(conn.response(req, newErrorResponse(req, err)), req.Method)
+	}
+
+	resp := conn.handle(req)
+	if req.notification {
+		return nil
+	}
+
+	return conn.audited(conn.response(req, resp), req.Method)
+}
+
+// parseRequest decodes a request in the connection's protocol. The returned
+// request is never nil so that errors can be reported with the request's id
+// when it could be read.
+func (conn *Connection) parseRequest(raw json.RawMessage) (req *Request, err error) {
+	return parseRequestAs(raw, conn.protocol, conn.s.StrictEnvelope)
+}
+
+func parseRequestAs(raw json.RawMessage, protocol Protocol, strict bool) (req *Request, err error) {
+	defer func() {
+		req.received = time.Now()
+	}()
+
+	switch protocol {
+	case ProtocolJSONRPC2:
+		return parseRequest2(raw, strict)
+	case ProtocolJSONRPC1:
+		return parseRequest1(raw, strict)
+	}
+
+	if strict {
+		return parseStrictRequest(raw)
+	}
+
+	req, _, err = splitEnvelope(raw)
+	if err != nil {
+		return
+	}
+
+	if err = json.Unmarshal(raw, req); err != nil {
+		err = newError(CodeInvalidRequest, "invalid request envelope: %v", err)
 		return
 	}
 
-	conn.replyResult(req.Id, outParam.Interface())
 	return
 }
 
+func (conn *Connection) handle(req *Request) *Response {
+	start := time.Now()
+	resp := conn.dispatch(req)
+	conn.s.observeCall(req, start, resp)
+	return resp
+}
+
+func (conn *Connection) dispatch(req *Request) *Response {
+	if err := req.Regular(); err != nil {
+		conn.violation(ViolationInvalidRequest, err)
+		return newErrorResponse(req, err)
+	}
+
+	if err := conn.s.verifySignature(conn.protocol, req); err != nil {
+		conn.violation(ViolationAuth, err)
+		return newErrorResponse(req, err)
+	}
+
+	serviceName, methodName, _ := splitMethod(req.Method)
+	if serviceName == builtinService {
+		return conn.callBuiltin(req, methodName)
+	}
+
+	svc, err := conn.s.getService(serviceName)
+	if err != nil {
+		conn.s.logf("jsonrpc: unknown method %q called by %s", req.Method, conn.info.RemoteAddr)
+		return conn.s.unknownMethod(req, err)
+	}
+
+	mthd, err := svc.getMethod(methodName)
+	if err != nil {
+		conn.s.logf("jsonrpc: unknown method %q called by %s", req.Method, conn.info.RemoteAddr)
+		return conn.s.unknownMethod(req, err)
+	}
+
+	if mthd.isDisabled() {
+		return conn.s.unknownMethod(req, newError(CodeMethodDisabled, "method '%s' is disabled", req.Method))
+	}
+
+	ctx, done := conn.requestContext(req)
+	defer done()
+
+	if ctx, err = contextMeta(ctx, conn.s.ContextMeta, req); err != nil {
+		return newErrorResponse(req, err)
+	}
+
+	if err := conn.s.authorize(ctx, conn, req); err != nil {
+		return newErrorResponse(req, err)
+	}
+
+	var resp *Response
+	conn.s.profile(ctx, serviceName, methodName, func(ctx context.Context) {
+		resp, err = chain(svc.handler(chain(conn.callMethod(svc, mthd), mthd.interceptors)), conn.s.interceptors)(ctx, req)
+	})
+	if err != nil {
+		return newErrorResponse(req, err)
+	}
+
+	return resp
+}
+
+// callMethod returns the Handler invoking mthd of svc.
+func (conn *Connection) callMethod(svc *service, mthd *serviceMethod) Handler {
+	return func(ctx context.Context, req *Request) (*Response, error) {
+		var inParam reflect.Value
+
+		inParam = reflect.New(mthd.inType)
+
+		if mthd.proto {
+			if err := decodeProtoParams(req.Param, inParam); err != nil {
+				return nil, newError(CodeInvalidParams, "invalid params: %v", err)
+			}
+		} else if len(req.Param) > 0 {
+			decode := decodeParams
+			if conn.s.StrictEnvelope {
+				decode = strictParams
+			}
+			if scalars := conn.scalarsOf(req); !scalars.plain(mthd.inType) {
+				decode = scalars.decodeParams
+			}
+
+			if err := decode(req.Param, inParam.Interface()); err != nil {
+				return nil, newError(CodeInvalidParams, "invalid params: %v", err)
+			}
+		}
+
+		finishSpan := conn.s.startSpan(req)
+
+		fn, args := mthd.fn, []reflect.Value(nil)
+		if !fn.IsValid() {
+			fn, args = mthd.method.Func, append(args, conn.receiver(svc))
+		}
+
+		if mthd.hasCtx {
+			args = append(args, reflect.ValueOf(ctx))
+		}
+		args = append(args, inParam.Elem())
+
+		var outParam reflect.Value
+		if !mthd.returnsResult {
+			outParam = reflect.New(mthd.outType.Elem())
+			args = append(args, outParam)
+		}
+
+		returnValues, err := conn.s.call(req, fn, args)
+		if err != nil {
+			finishSpan(err)
+			return nil, err
+		}
+
+		errInter := returnValues[len(returnValues)-1].Interface()
+
+		if errInter != nil {
+			finishSpan(errInter.(error))
+			return nil, errInter.(error)
+		}
+
+		finishSpan(nil)
+
+		out := outParam
+		if mthd.returnsResult {
+			out = returnValues[0]
+		}
+
+		var result interface{}
+		if mthd.proto {
+			result, err = protoResult(out)
+		} else {
+			result, err = conn.s.transformResult(req, out.Interface())
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if enc, ok := conn.resultEncoder(req, svc, mthd, result); ok {
+			return conn.newEncodedResponse(req, enc, result)
+		}
+
+		return conn.newResultResponse(req, result)
+	}
+}
+
+// resultEncoder returns the codec of the connection if it encodes the results
+// of mthd itself, straight from their Go values, rather than as JSON. Results
+// are still encoded as JSON when something may read Response.Result: an
+// interceptor, the mirror or the legacy protocol, whose frames are the
+// responses themselves, or when the connection's scalars apply to them.
+func (conn *Connection) resultEncoder(req *Request, svc *service, mthd *serviceMethod, result interface{}) (binaryEncoder, bool) {
+	enc, ok := conn.codec.(binaryEncoder)
+	if !ok || conn.protocol == ProtocolLegacy || conn.s.Mirror != nil ||
+		len(conn.s.interceptors) > 0 || len(svc.interceptors) > 0 || len(mthd.interceptors) > 0 {
+		return nil, false
+	}
+
+	if result != nil && !conn.scalarsOf(req).plain(reflect.TypeOf(result)) {
+		return nil, false
+	}
+
+	return enc, true
+}
+
+func (conn *Connection) callBuiltin(req *Request, methodName string) *Response {
+	mthd, ok := builtinMethods[methodName]
+	if !ok && conn.s.Diagnostics {
+		mthd, ok = diagnosticMethods[methodName]
+	}
+	if !ok {
+		return newErrorResponse(req, newError(CodeMethodNotFound, "methodName '%s' not exists", methodName))
+	}
+
+	result, err := mthd(conn, req)
+	if err != nil {
+		return newErrorResponse(req, err)
+	}
+
+	resp, err := conn.newResultResponse(req, result)
+	if err != nil {
+		return newErrorResponse(req, err)
+	}
+
+	return resp
+}
+
 type service struct {
 	receiverType  reflect.Type
 	receiverValue reflect.Value
 	methodMap     map[string]*serviceMethod
+	interceptors  []Interceptor
+	docs          map[string]*MethodDoc
+
+	// factory, if valid, builds a receiver for each connection
+	factory reflect.Value
+
+	// set for services made of functions, see RegisterFunc
+	funcs bool
+}
+
+// handler wraps h with the service's interceptors.
+func (svc *service) handler(h Handler) Handler {
+	return chain(h, svc.interceptors)
 }
 
 func (svc *service) getMethod(methodName string) (*serviceMethod, error) {
 	svcMethod, ok := svc.methodMap[methodName]
 
 	if !ok {
-		return nil, fmt.Errorf("methodName '%s' not exists", methodName)
+		return nil, newError(CodeMethodNotFound, "methodName '%s' not exists", methodName)
 	}
 
 	return svcMethod, nil
@@ -125,12 +655,218 @@ type serviceMethod struct {
 	method  reflect.Method
 	inType  reflect.Type
 	outType reflect.Type
+	hasCtx  bool
+
+	// fn, if valid, is called instead of method, without a receiver
+	fn reflect.Value
+
+	// returnsResult is set when the result is returned before the error
+	// instead of filled through an out pointer, outType still being a pointer
+	// to it
+	returnsResult bool
+
+	// interceptors of the method alone, see RegisterFunc
+	interceptors []Interceptor
+
+	// proto is set when the params and result are carried as protobuf
+	// messages, see WithProtobuf
+	proto bool
+
+	// disabled is set while the method is disabled by Server.DisableMethod
+	disabled int32
 }
 
 type Server struct {
+	// Addr is the TCP address to listen on, or the path of a Unix domain socket
+	// prefixed with unix://, created with the permissions of SocketMode if set.
 	Addr       string
+	SocketMode os.FileMode
 	Listener   net.Listener
+	listenerMu sync.Mutex // guards Listener while serving
 	serviceMap map[string]*service
+	services   sync.RWMutex // guards serviceMap
+
+	// TLSConfig configures the connections served by ListenAndServeTLS.
+	// ClientCAs, if set, makes it require client certificates signed by one of
+	// them; handlers get the identity of the client with PeerFromContext.
+	TLSConfig *tls.Config
+	ClientCAs *x509.CertPool
+
+	// Protocol is the envelope format spoken on accepted connections.
+	Protocol Protocol
+
+	// ConcurrentBatch handles the requests of a batch concurrently instead of one
+	// after the other, on the request slots of the connection free when they
+	// are read: a batch never runs more requests at once than a connection.
+	ConcurrentBatch bool
+
+	// MaxBatchSize and MaxBatchBytes, if set, bound the number of requests in a
+	// batch and its encoded size; larger batches are rejected as a whole.
+	MaxBatchSize  int
+	MaxBatchBytes int
+
+	// BatchFailFast stops running the requests of a batch after one of them
+	// fails: the requests after it get an error coded CodeBatchAborted. In a
+	// ConcurrentBatch only the requests not started yet are aborted.
+	BatchFailFast bool
+
+	// HandlerWorkers, if set, runs handlers on a pool of at most that many
+	// goroutines shared by all connections. Requests wait for a worker in a
+	// queue of HandlerQueue requests (HandlerWorkers if zero); while it is full
+	// requests fail with an error coded CodeServerBusy.
+	HandlerWorkers int
+	HandlerQueue   int
+	pool           *workerPool
+	poolOnce       sync.Once
+
+	// MaxResultBytes is the encoded result size handlers are asked to stay
+	// within, see BudgetFromContext. Results aren't checked against it, only
+	// against the size callers declare with MetaMaxResultSize.
+	MaxResultBytes int
+
+	// OversizedResult, if set, returns the error sent instead of a result
+	// larger than its caller accepts, given the default one coded
+	// CodeResultTooLarge with a ResultSize as data. Returning nil sends the
+	// result anyway.
+	OversizedResult func(req *Request, err *Error) *Error
+
+	// StrictEnvelope rejects requests with duplicate or unknown top-level
+	// fields or missing required ones with an invalid request error instead of
+	// ignoring them, and params objects with members the method doesn't take
+	// with an invalid params error.
+	StrictEnvelope bool
+
+	// WriteQueueSize bounds the responses queued for writing on each connection,
+	// 64 if zero. A connection whose queue stays full for SlowWriterTimeout (10s
+	// if zero) is closed.
+	WriteQueueSize    int
+	SlowWriterTimeout time.Duration
+
+	// ErrorLog receives errors the server can't report to the client; the log
+	// package's standard logger is used if nil. Repeated errors of the same
+	// kind are logged once per ErrorLogInterval (a minute if zero) with their
+	// count; a negative interval logs every error.
+	ErrorLog         *log.Logger
+	ErrorLogInterval time.Duration
+	logs             logAggregator
+
+	// Diagnostics serves the rpc.echo, rpc.delay and rpc.payload methods, for
+	// operators to check connectivity, latency and payload limits of a
+	// deployment, e.g. with jsonrpc-diag.
+	Diagnostics bool
+
+	// Version is reported by rpc.info; the main module version is used if empty.
+	Version string
+
+	// Tracer, if set, is notified of calls selected by Sampler (all calls when
+	// Sampler is nil).
+	Tracer  Tracer
+	Sampler Sampler
+
+	// Metrics, if set, receives an observation per call. The method names it
+	// sees are bounded by MetricsLabels; by default methods that aren't
+	// registered are reported as "other".
+	Metrics       MetricsRecorder
+	MetricsLabels *MethodLabels
+
+	// Mirror, if set, publishes a copy of every call to a message bus.
+	Mirror *Mirror
+
+	// Checksum requires a CRC32 on every frame received and adds one to every
+	// frame sent, to detect corruption the transport missed. A frame with a
+	// missing or invalid checksum ends its connection and is counted, see
+	// ChecksumMismatches. Clients opt in with Client.SetChecksum. Connections
+	// whose codec isn't a ChecksumCodec are refused.
+	Checksum           bool
+	checksumMismatches uint64
+
+	// Codec, if set, returns the codec of each connection, reading and writing
+	// frames in a wire format other than newline-delimited JSON. Clients use
+	// the same with WithCodec. Binary codecs such as MessagePackCodec are
+	// handed the results of handlers unencoded, unless an interceptor or the
+	// Mirror is set.
+	Codec CodecFactory
+
+	// Scalars, if set, overrides how values of some types, such as times, byte
+	// slices or 64-bit integers, are encoded in params and results. Params
+	// whose type holds such values aren't subject to StrictEnvelope's params
+	// check. Clients may ask for other predefined formats on their connection
+	// with Client.RequestScalars.
+	Scalars *Scalars
+
+	// AuditResponse, if set, is passed every response as encoded by the
+	// connection's codec before it is written, for exact egress accounting
+	// or to enforce data-volume limits per peer. If it returns an error the
+	// response isn't written and the connection is closed. It is called
+	// concurrently for different connections.
+	AuditResponse func(resp *EncodedResponse) error
+
+	// DowngradeError, if set, returns the error sent instead of err, or nil
+	// to send err, so that old clients can be sent the codes and data they
+	// know, e.g. depending on a client version in req.Meta.
+	DowngradeError func(req *Request, err *Error) *Error
+
+	// ContextMeta puts the metadata entries of requests it binds into the
+	// context of their handlers, see MetaKey.
+	ContextMeta []MetaKey
+
+	// UnknownMethod, if set, returns the error sent for calls to methods that
+	// aren't registered or are disabled, given the default one coded
+	// CodeServiceNotFound, CodeMethodNotFound or CodeMethodDisabled. See
+	// SuggestMethod.
+	UnknownMethod func(req *Request, err *Error) *Error
+
+	// CheckOrigin, if set, reports whether ServeWS accepts the upgrade
+	// request r from a browser page of another origin. If nil, upgrades whose
+	// Origin header names a host other than the one requested are refused.
+	CheckOrigin func(r *http.Request) bool
+
+	// Bans, if set, counts the protocol violations of clients to disconnect and
+	// ban those that keep committing them.
+	Bans *BanPolicy
+
+	// Bandwidth limits the bytes read and written on each connection, see
+	// WithBandwidth to limit those of a method.
+	Bandwidth Bandwidth
+
+	// Authz, if set, asks an external authorization service about calls to
+	// registered methods before handling them.
+	Authz *Authz
+
+	// Verifier, if set, rejects requests that aren't signed with a key it
+	// accepts, see Client.SetSigner, or were signed more than SignatureMaxAge
+	// (5 minutes if zero) away from the server's clock. Signatures don't
+	// prevent replays within that window.
+	Verifier        Verifier
+	SignatureMaxAge time.Duration
+
+	// PanicHandler, if set, is called with the value and stack of handler
+	// panics instead of logging them. Panics are recovered either way: the
+	// call fails with an internal error and the connection is kept.
+	PanicHandler func(req *Request, v interface{}, stack []byte)
+
+	// CrashDumpDir, if set, records handler panics: a CrashRecord is written to
+	// a file in the directory, keeping the CrashDumpMax (10 if zero) most recent
+	// ones. Params are only recorded as a hash.
+	CrashDumpDir string
+	CrashDumpMax int
+
+	// ProfileLabels labels handler goroutines with their service and method
+	// (rpc.service and rpc.method), attributing CPU profile samples to methods.
+	// Goroutines started by handlers inherit the labels.
+	ProfileLabels bool
+
+	interceptors       []Interceptor
+	resultTransformers []ResultTransformer
+
+	// connections subscribed to announcements, see rpc.announcements
+	announceMu  sync.Mutex
+	subscribers map[*Connection]bool
+
+	// connections being served, see Shutdown and Close
+	connsMu    sync.Mutex
+	conns      map[*Connection]struct{}
+	inShutdown int32
 }
 
 // Is this an exported - upper case - name?
@@ -149,19 +885,71 @@ func isExportedOrBuiltinType(t reflect.Type) bool {
 	return isExported(t.Name()) || t.PkgPath() == ""
 }
 
-func (s *Server) Register(receiver interface{}) error {
+// Register publishes the exported methods of receiver under its type name. It
+// fails if a service with the same name is already registered. opts only apply
+// to this service.
+func (s *Server) Register(receiver interface{}, opts ...ServiceOption) error {
+	return s.register("", receiver, false, opts)
+}
+
+// RegisterName is like Register but publishes the methods under name instead
+// of the receiver's type name, so the name clients call doesn't change when
+// the type is renamed. name may contain dots to carry a version, e.g.
+// billing.v2, whose methods are called as billing.v2.Charge.
+func (s *Server) RegisterName(name string, receiver interface{}, opts ...ServiceOption) error {
+	if name == "" {
+		return errors.New("invalid service name")
+	}
+
+	return s.register(name, receiver, false, opts)
+}
+
+// RegisterOrReplace is like Register but replaces a service already registered
+// under the same name.
+func (s *Server) RegisterOrReplace(receiver interface{}, opts ...ServiceOption) error {
+	return s.register("", receiver, true, opts)
+}
+
+// MustRegister is like Register but panics on error.
+func (s *Server) MustRegister(receiver interface{}, opts ...ServiceOption) {
+	if err := s.Register(receiver, opts...); err != nil {
+		panic(err)
+	}
+}
+
+// register publishes receiver under name, or under its type name if name is
+// empty.
+func (s *Server) register(name string, receiver interface{}, replace bool, opts []ServiceOption) error {
 	recvType := reflect.TypeOf(receiver)
 	recvValue := reflect.ValueOf(receiver)
 
-	serviceName := reflect.Indirect(recvValue).Type().Name()
-	if serviceName == "" {
-		return errors.New("invalid service name")
+	if recvType == nil {
+		return errors.New("invalid receiver: nil")
+	}
+
+	recvType, recvValue = s.adaptReceiver(recvType, recvValue)
+
+	newService := newService(recvType)
+	newService.receiverValue = recvValue
+
+	if name == "" {
+		name = reflect.Indirect(recvValue).Type().Name()
 	}
 
+	return s.addService(name, newService, replace, opts)
+}
+
+// newService collects the methods of recvType that can be served: methods of
+// the form
+//
+//	func (s *S) M(in In, out *Out) error
+//	func (s *S) M(in In) (Out, error)
+//
+// optionally taking a context.Context before in.
+func newService(recvType reflect.Type) *service {
 	newService := &service{
-		receiverType:  recvType,
-		receiverValue: recvValue,
-		methodMap:     make(map[string]*serviceMethod),
+		receiverType: recvType,
+		methodMap:    make(map[string]*serviceMethod),
 	}
 
 	for i := 0; i < recvType.NumMethod(); i++ {
@@ -173,42 +961,101 @@ func (s *Server) Register(receiver interface{}) error {
 			continue
 		}
 
-		if methodType.NumIn() != 3 {
+		// methods either fill an out param or return their result
+		returnsResult := methodType.NumOut() == 2
+		if !returnsResult && methodType.NumOut() != 1 {
 			continue
 		}
 
-		inType := methodType.In(1)
-
-		if !isExportedOrBuiltinType(inType) {
+		if methodType.Out(methodType.NumOut()-1) != typeOfError {
 			continue
 		}
 
-		outType := methodType.In(2)
-		if outType.Kind() != reflect.Ptr {
-			continue
+		params := 3
+		if returnsResult {
+			params = 2
 		}
 
-		if !isExportedOrBuiltinType(outType) {
+		// methods may take a context.Context before the in param
+		hasCtx := methodType.NumIn() == params+1 && methodType.In(1) == typeOfContext
+		if methodType.NumIn() != params && !hasCtx {
 			continue
 		}
 
-		if methodType.NumOut() != 1 {
+		argOffset := 1
+		if hasCtx {
+			argOffset = 2
+		}
+
+		inType := methodType.In(argOffset)
+
+		if !isExportedOrBuiltinType(inType) {
 			continue
 		}
 
-		if methodType.Out(0) != typeOfError {
+		var outType reflect.Type
+		if returnsResult {
+			outType = reflect.PtrTo(methodType.Out(0))
+		} else {
+			outType = methodType.In(argOffset + 1)
+			if outType.Kind() != reflect.Ptr {
+				continue
+			}
+		}
+
+		if !isExportedOrBuiltinType(outType) {
 			continue
 		}
 
 		newService.methodMap[methodName] = &serviceMethod{
-			method:  method,
-			inType:  inType,
-			outType: outType,
+			method:        method,
+			inType:        inType,
+			outType:       outType,
+			hasCtx:        hasCtx,
+			returnsResult: returnsResult,
 		}
 	}
 
+	return newService
+}
+
+// checkServiceName fails if serviceName can't be registered.
+func checkServiceName(serviceName string) error {
+	if !validServiceName(serviceName) {
+		return fmt.Errorf("invalid service name '%s'", serviceName)
+	}
+
+	if serviceName == builtinService || strings.HasPrefix(serviceName, builtinService+".") {
+		return fmt.Errorf("service name '%s' is reserved", serviceName)
+	}
+
+	return nil
+}
+
+func (s *Server) addService(serviceName string, newService *service, replace bool, opts []ServiceOption) error {
+	if err := checkServiceName(serviceName); err != nil {
+		return err
+	}
+
+	s.services.Lock()
+	defer s.services.Unlock()
+
+	if _, ok := s.serviceMap[serviceName]; ok && !replace {
+		return fmt.Errorf("%w: '%s'", ErrServiceExists, serviceName)
+	}
+
 	if len(newService.methodMap) <= 0 {
-		return NoExportedMethod
+		return noExportedMethodError(newService.receiverType)
+	}
+
+	options := &serviceOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	newService.interceptors = options.chain()
+	newService.docs = options.docs
+	if options.protobuf {
+		useProtobuf(newService.methodMap)
 	}
 
 	if s.serviceMap == nil {
@@ -221,87 +1068,164 @@ func (s *Server) Register(receiver interface{}) error {
 }
 
 func (s *Server) getService(serviceName string) (*service, error) {
+	s.services.RLock()
 	svc, ok := s.serviceMap[serviceName]
+	s.services.RUnlock()
 
 	if !ok {
-		return nil, fmt.Errorf("serviceName '%s' not exists", serviceName)
+		return nil, newError(CodeServiceNotFound, "serviceName '%s' not exists", serviceName)
 	}
 
 	return svc, nil
 }
 
 func (s *Server) getMethod(method string) (_service *service, _serviceMethod *serviceMethod, err error) {
-	parts := strings.Split(method, ".")
-
-	if len(parts) != 2 {
+	serviceName, serviceMethodName, ok := splitMethod(method)
+	if !ok {
 		err = fmt.Errorf("invalid method(%s)", method)
 		return
 	}
 
-	serviceName, serviceMethodName := parts[0], parts[1]
+	s.services.RLock()
+	_service, ok = s.serviceMap[serviceName]
+	s.services.RUnlock()
 
-	if _, ok := s.serviceMap[serviceName]; !ok {
+	if !ok {
 		err = fmt.Errorf("service '%s' not found", serviceName)
 		return
 	}
 
-	_service = s.serviceMap[serviceName]
-
-	if _, ok := _service.methodMap[serviceMethodName]; ok {
-		err = fmt.Errorf("serviceMethod '%s' not found in service '%s'", serviceName, serviceMethodName)
+	_serviceMethod, ok = _service.methodMap[serviceMethodName]
+	if !ok {
+		err = fmt.Errorf("serviceMethod '%s' not found in service '%s'", serviceMethodName, serviceName)
 		return
 	}
 
 	return
 }
 
-func (conn *Connection) replyError(id uint32, err error) {
-	resp := &Response{
-		Id:    id,
+func (conn *Connection) replyError(req *Request, err error) {
+	conn.reply(req, newErrorResponse(req, err))
+	return
+}
+
+func newErrorResponse(req *Request, err error) *Response {
+	return &Response{
+		Id:    req.Id,
 		Error: err.Error(),
+		err:   err,
 	}
-
-	_ = conn.codec.encoder.Encode(resp)
-	return
 }
 
-func (conn *Connection) replyResult(id uint32, result interface{}) {
-	resultBytes, _ := json.Marshal(result)
+func (conn *Connection) newResultResponse(req *Request, result interface{}) (*Response, error) {
+	resultBytes, err := conn.scalarsOf(req).marshal(result)
+	if err != nil {
+		conn.s.logf("jsonrpc: marshal result of %s: %v", req.Method, err)
+		return nil, ErrUnmarshalableResult
+	}
+
+	if rpcErr := conn.s.checkResultSize(req, resultBytes); rpcErr != nil {
+		return nil, rpcErr
+	}
 
 	resp := &Response{
-		Id:     id,
+		Id:     req.Id,
 		Result: resultBytes,
 	}
 
-	_ = conn.codec.encoder.Encode(resp)
+	return resp, nil
+}
+
+// newEncodedResponse returns the response carrying result encoded by enc, the
+// connection's codec.
+func (conn *Connection) newEncodedResponse(req *Request, enc binaryEncoder, result interface{}) (*Response, error) {
+	encoded, err := enc.encodeBinary(result)
+	if err != nil {
+		conn.s.logf("jsonrpc: marshal result of %s: %v", req.Method, err)
+		return nil, ErrUnmarshalableResult
+	}
+
+	if rpcErr := conn.s.checkResultSize(req, encoded); rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	return &Response{Id: req.Id, encoded: encoded}, nil
+}
+
+func (conn *Connection) reply(req *Request, resp *Response) {
+	conn.enqueue(conn.audited(conn.response(req, resp), req.Method))
 	return
 }
 
+// response returns resp in the connection's envelope format, publishing the
+// call to the mirror if any.
+func (conn *Connection) response(req *Request, resp *Response) interface{} {
+	if conn.s.Mirror != nil {
+		conn.s.Mirror.record(req, resp)
+	}
+
+	if conn.s.DowngradeError != nil && resp.err != nil {
+		if rpcErr := conn.s.DowngradeError(req, toError(resp.err)); rpcErr != nil {
+			resp = newErrorResponse(req, rpcErr)
+		}
+	}
+
+	return conn.protocol.wireResponse(resp)
+}
+
 func (s *Server) ListenAndServe() (err error) {
+	if err = s.listenOnce(nil); err != nil {
+		return
+	}
+
+	err = s.Serve()
+	return
+}
+
+// listenOnce listens on Addr unless a Listener is set, then wraps the
+// Listener with wrap if not nil. It fails with ErrServerClosed once the server
+// is shut down, so that a listener opened concurrently with Close is closed by
+// it or never opened.
+func (s *Server) listenOnce(wrap func(l net.Listener) net.Listener) (err error) {
+	s.listenerMu.Lock()
+	defer s.listenerMu.Unlock()
+
+	if s.shuttingDown() {
+		return ErrServerClosed
+	}
+
 	if s.Listener == nil {
-		s.Listener, err = net.Listen("tcp", s.Addr)
-		if err != nil {
+		if s.Listener, err = s.listen(); err != nil {
 			return
 		}
 	}
 
-	err = s.Serve()
+	if wrap != nil {
+		s.Listener = wrap(s.Listener)
+	}
 	return
 }
 
+func (s *Server) listener() net.Listener {
+	s.listenerMu.Lock()
+	defer s.listenerMu.Unlock()
+
+	return s.Listener
+}
+
 func (s *Server) Serve() error {
+	l := s.listener()
 
 	for {
-		rw, err := s.Listener.Accept()
+		rw, err := l.Accept()
 		if err != nil {
+			if s.shuttingDown() {
+				return ErrServerClosed
+			}
 			return err
 		}
 
-		conn := &Connection{
-			c:     rw,
-			s:     s,
-			codec: NewCodec(rw),
-		}
+		conn := newConnection(s, rw)
 
 		go conn.Serve()
 	}
@@ -0,0 +1,111 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Peer is a callback service of the client.
+type Peer struct {
+	inflight int32
+	full     chan struct{}
+	once     sync.Once
+}
+
+// Echo answers once maxConcurrentRequests callbacks are in flight at once, so
+// that every request slot of the server's connection is held by a handler
+// waiting in Connection.Call.
+func (p *Peer) Echo(ctx context.Context, in int) (int, error) {
+	if atomic.AddInt32(&p.inflight, 1) >= maxConcurrentRequests {
+		p.once.Do(func() { close(p.full) })
+	}
+
+	select {
+	case <-p.full:
+	case <-ctx.Done():
+	}
+	return in, nil
+}
+
+func TestCallbacksBeyondRequestSlots(t *testing.T) {
+	s := NewServer("")
+	err := s.RegisterFunc("Relay.Echo", func(ctx context.Context, in int) (out int, err error) {
+		conn, _ := ConnectionFromContext(ctx)
+		err = conn.Call(ctx, "Peer.Echo", in, &out)
+		return
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, c := NewLocalPair(s)
+	defer c.Close()
+
+	if err := c.Register(&Peer{full: make(chan struct{})}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	const calls = 200
+
+	var wg sync.WaitGroup
+	errs := make(chan error, calls)
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			var out int
+			if err := c.CallContext(ctx, "Relay.Echo", i, &out); err != nil {
+				errs <- err
+				return
+			}
+			if out != i {
+				t.Errorf("Relay.Echo(%d) = %d", i, out)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatal(err)
+	}
+}
+
+// rawConn writes frames to a connection served by s and reads its answers as
+// JSON.
+type rawConn struct {
+	t    *testing.T
+	conn net.Conn
+	dec  *json.Decoder
+}
+
+func newRawConn(t *testing.T, s *Server) *rawConn {
+	serverEnd, clientEnd := net.Pipe()
+	go newConnection(s, serverEnd).Serve()
+	t.Cleanup(func() { clientEnd.Close() })
+
+	return &rawConn{t: t, conn: clientEnd, dec: json.NewDecoder(clientEnd)}
+}
+
+// call writes frame and decodes the answer into out.
+func (rc *rawConn) call(frame string, out interface{}) {
+	rc.t.Helper()
+
+	rc.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.WriteString(rc.conn, frame+"\n"); err != nil {
+		rc.t.Fatal(err)
+	}
+	if err := rc.dec.Decode(out); err != nil {
+		rc.t.Fatal(err)
+	}
+}
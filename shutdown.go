@@ -0,0 +1,125 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrServerClosed is returned by Serve and ListenAndServe after Shutdown or
+// Close.
+var ErrServerClosed = errors.New("jsonrpc: server closed")
+
+// shutdownPollInterval is how often Shutdown looks for idle connections.
+const shutdownPollInterval = 10 * time.Millisecond
+
+// Shutdown stops the server gracefully: it closes the listener, then closes
+// every connection once it has no request being handled and no response left
+// to write. If ctx is done first, the remaining connections are closed at
+// once, canceling their requests, and ctx's error is returned.
+func (s *Server) Shutdown(ctx context.Context) (err error) {
+	atomic.StoreInt32(&s.inShutdown, 1)
+
+	if l := s.listener(); l != nil {
+		err = l.Close()
+	}
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if s.closeIdleConns() {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			s.closeConns()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close stops the server at once: it closes the listener and every connection,
+// canceling the requests being handled. See Shutdown for a graceful stop.
+func (s *Server) Close() (err error) {
+	atomic.StoreInt32(&s.inShutdown, 1)
+
+	if l := s.listener(); l != nil {
+		err = l.Close()
+	}
+
+	s.closeConns()
+	return
+}
+
+// OpenConnections returns the number of connections being served.
+func (s *Server) OpenConnections() int {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+
+	return len(s.conns)
+}
+
+func (s *Server) shuttingDown() bool {
+	return atomic.LoadInt32(&s.inShutdown) != 0
+}
+
+// trackConn records conn as being served. It reports false if the server is
+// shutting down, in which case conn must not be served.
+func (s *Server) trackConn(conn *Connection) bool {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+
+	if s.shuttingDown() {
+		return false
+	}
+
+	if s.conns == nil {
+		s.conns = make(map[*Connection]struct{})
+	}
+	s.conns[conn] = struct{}{}
+	return true
+}
+
+func (s *Server) untrackConn(conn *Connection) {
+	s.connsMu.Lock()
+	delete(s.conns, conn)
+	s.connsMu.Unlock()
+}
+
+// closeIdleConns closes the idle connections and reports whether all are
+// closed.
+func (s *Server) closeIdleConns() bool {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+
+	for conn := range s.conns {
+		if conn.idle() {
+			_ = conn.c.Close()
+			delete(s.conns, conn)
+		}
+	}
+
+	return len(s.conns) == 0
+}
+
+// closeConns closes every connection.
+func (s *Server) closeConns() {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+
+	for conn := range s.conns {
+		_ = conn.c.Close()
+		delete(s.conns, conn)
+	}
+}
+
+// idle reports whether the connection has no request being handled and no
+// response waiting to be written.
+func (conn *Connection) idle() bool {
+	return atomic.LoadInt32(&conn.frames) == 0 &&
+		conn.writer.idle(conn.queued)
+}
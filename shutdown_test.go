@@ -0,0 +1,164 @@
+package jsonrpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// serveBlocking serves s on a loopback address with Block.Wait, which blocks
+// until release is closed or its context is done, and returns the error of
+// Serve.
+func serveBlocking(t *testing.T, s *Server, started chan<- struct{}, release <-chan struct{}) (addr string, served <-chan error) {
+	err := s.RegisterFunc("Block.Wait", func(ctx context.Context, in int) (int, error) {
+		started <- struct{}{}
+		select {
+		case <-release:
+			return in, nil
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Listener = l
+
+	errs := make(chan error, 1)
+	go func() { errs <- s.Serve() }()
+	t.Cleanup(func() { l.Close() })
+
+	return l.Addr().String(), errs
+}
+
+func TestShutdownWaitsForRequests(t *testing.T) {
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	s := NewServer("")
+	addr, served := serveBlocking(t, s, started, release)
+
+	c, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	idle, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idle.Close()
+
+	result := make(chan error, 1)
+	go func() {
+		var out int
+		result <- c.Call("Block.Wait", 1, &out)
+	}()
+	<-started
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- s.Shutdown(context.Background()) }()
+
+	if err := <-served; err != ErrServerClosed {
+		t.Errorf("Serve returned %v", err)
+	}
+	if _, err := net.DialTimeout("tcp", addr, time.Second); err == nil {
+		t.Error("listener still open")
+	}
+
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown returned %v with a request being handled", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// the idle connection is closed right away
+	if err := idle.Call("Block.Wait", 1, nil); err == nil {
+		t.Error("idle connection still served")
+	}
+
+	close(release)
+	if err := <-result; err != nil {
+		t.Errorf("request in flight failed: %v", err)
+	}
+	if err := <-shutdown; err != nil {
+		t.Errorf("Shutdown: %v", err)
+	}
+	if n := s.OpenConnections(); n != 0 {
+		t.Errorf("%d connections left open", n)
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	s := NewServer("")
+	addr, _ := serveBlocking(t, s, started, release)
+
+	c, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	result := make(chan error, 1)
+	go func() {
+		var out int
+		result <- c.Call("Block.Wait", 1, &out)
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if err := s.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Shutdown returned %v", err)
+	}
+	if err := <-result; err == nil {
+		t.Error("request outlived the shutdown deadline")
+	}
+}
+
+func TestClose(t *testing.T) {
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	s := NewServer("")
+	addr, served := serveBlocking(t, s, started, release)
+
+	c, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	result := make(chan error, 1)
+	go func() {
+		var out int
+		result <- c.Call("Block.Wait", 1, &out)
+	}()
+	<-started
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-served; err != ErrServerClosed {
+		t.Errorf("Serve returned %v", err)
+	}
+	if err := <-result; err == nil {
+		t.Error("request survived Close")
+	}
+}
+
+func TestCloseBeforeListen(t *testing.T) {
+	s := NewServer("127.0.0.1:0")
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.ListenAndServe(); err != ErrServerClosed {
+		t.Errorf("ListenAndServe after Close returned %v", err)
+	}
+}
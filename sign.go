@@ -0,0 +1,236 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Meta keys carrying the signature of a request.
+const (
+	MetaSignature     = "signature"
+	MetaSignatureKey  = "signature-key"
+	MetaSignatureTime = "signature-time"
+)
+
+// defaultSignatureMaxAge is the SignatureMaxAge used when it is zero.
+const defaultSignatureMaxAge = 5 * time.Minute
+
+// ErrInvalidSignature is returned to callers whose request isn't signed or
+// whose signature the server's Verifier rejects.
+var ErrInvalidSignature = errors.New("invalid request signature")
+
+// Signer signs the requests of a client, see Client.SetSigner.
+type Signer interface {
+	// Sign returns the signature of payload, the canonical form of a request,
+	// and the id of the key that made it.
+	Sign(payload []byte) (keyID string, signature []byte, err error)
+}
+
+// Verifier checks the signatures of the requests a server receives, see
+// Server.Verifier.
+type Verifier interface {
+	// Verify returns an error unless signature is a signature of payload made
+	// with the key keyID.
+	Verify(keyID string, payload, signature []byte) error
+}
+
+// Ed25519Signer signs requests with an ed25519 key.
+type Ed25519Signer struct {
+	KeyID string
+	Key   ed25519.PrivateKey
+}
+
+func (s *Ed25519Signer) Sign(payload []byte) (string, []byte, error) {
+	return s.KeyID, ed25519.Sign(s.Key, payload), nil
+}
+
+// Ed25519Verifier verifies ed25519 signatures with the public keys it maps
+// key ids to.
+type Ed25519Verifier map[string]ed25519.PublicKey
+
+func (v Ed25519Verifier) Verify(keyID string, payload, signature []byte) error {
+	key, ok := v[keyID]
+	if !ok {
+		return fmt.Errorf("unknown key '%s'", keyID)
+	}
+
+	if !ed25519.Verify(key, payload, signature) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+// HMACSigner signs requests with HMAC-SHA256 and a shared secret.
+type HMACSigner struct {
+	KeyID  string
+	Secret []byte
+}
+
+func (s *HMACSigner) Sign(payload []byte) (string, []byte, error) {
+	mac := hmac.New(sha256.New, s.Secret)
+	mac.Write(payload)
+	return s.KeyID, mac.Sum(nil), nil
+}
+
+// HMACVerifier verifies HMAC-SHA256 signatures with the secrets it maps key
+// ids to.
+type HMACVerifier map[string][]byte
+
+func (v HMACVerifier) Verify(keyID string, payload, signature []byte) error {
+	secret, ok := v[keyID]
+	if !ok {
+		return fmt.Errorf("unknown key '%s'", keyID)
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	if !hmac.Equal(mac.Sum(nil), signature) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+// SetSigner signs every request of the client with signer, in the request's
+// meta. It must be called before the first call.
+func (c *Client) SetSigner(signer Signer) {
+	c.reqMutex.Lock()
+	c.signer = signer
+	c.reqMutex.Unlock()
+}
+
+// signaturePayload returns the canonical form of req sent in protocol p and
+// signed at signedAt: the protocol version, its method, id, params, meta and
+// signing time on separate lines, the id and params re-encoded without
+// insignificant whitespace and with sorted object keys, the meta as an object
+// with sorted keys leaving out those of the signature.
+func signaturePayload(p Protocol, req *Request, signedAt string) ([]byte, error) {
+	id, err := canonicalJSON(req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := canonicalJSON(req.Param)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := make(map[string]string, len(req.Meta))
+	for k, v := range req.Meta {
+		switch k {
+		case MetaSignature, MetaSignatureKey, MetaSignatureTime:
+		default:
+			meta[k] = v
+		}
+	}
+
+	// maps are encoded with sorted keys
+	signedMeta, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	var payload bytes.Buffer
+	payload.WriteString(p.String())
+	payload.WriteByte('\n')
+	payload.WriteString(req.Method)
+	payload.WriteByte('\n')
+	payload.Write(id)
+	payload.WriteByte('\n')
+	payload.Write(params)
+	payload.WriteByte('\n')
+	payload.Write(signedMeta)
+	payload.WriteByte('\n')
+	payload.WriteString(signedAt)
+	return payload.Bytes(), nil
+}
+
+func canonicalJSON(raw json.RawMessage) ([]byte, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	var v interface{}
+	if err := unmarshalNumbers(raw, &v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func unmarshalNumbers(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// sign adds the signature of req, sent in protocol p, to its meta.
+func sign(p Protocol, req *Request, signer Signer) error {
+	signedAt := strconv.FormatInt(time.Now().Unix(), 10)
+
+	payload, err := signaturePayload(p, req, signedAt)
+	if err != nil {
+		return err
+	}
+
+	keyID, signature, err := signer.Sign(payload)
+	if err != nil {
+		return err
+	}
+
+	meta := make(map[string]string, len(req.Meta)+3)
+	for k, v := range req.Meta {
+		meta[k] = v
+	}
+	meta[MetaSignature] = base64.StdEncoding.EncodeToString(signature)
+	meta[MetaSignatureKey] = keyID
+	meta[MetaSignatureTime] = signedAt
+
+	req.Meta = meta
+	return nil
+}
+
+// verifySignature checks the signature of req, received in protocol p, with
+// the server's Verifier.
+func (s *Server) verifySignature(p Protocol, req *Request) error {
+	if s.Verifier == nil {
+		return nil
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(req.Meta[MetaSignature])
+	if err != nil || len(signature) == 0 {
+		return ErrInvalidSignature
+	}
+
+	signedAt := req.Meta[MetaSignatureTime]
+	unix, err := strconv.ParseInt(signedAt, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	maxAge := s.SignatureMaxAge
+	if maxAge <= 0 {
+		maxAge = defaultSignatureMaxAge
+	}
+
+	if age := time.Since(time.Unix(unix, 0)); age > maxAge || age < -maxAge {
+		return fmt.Errorf("%w: signed %s ago", ErrInvalidSignature, age.Round(time.Second))
+	}
+
+	payload, err := signaturePayload(p, req, signedAt)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	if err = s.Verifier.Verify(req.Meta[MetaSignatureKey], payload, signature); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func signedRequest(t *testing.T, signer Signer) *Request {
+	req := &Request{
+		Id:     json.RawMessage(`7`),
+		Method: "Account.Get",
+		Param:  json.RawMessage(`{"id": 1, "all": true}`),
+		Meta:   map[string]string{"tenant": "acme"},
+	}
+
+	if err := sign(ProtocolJSONRPC2, req, signer); err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestSignedCalls(t *testing.T) {
+	s := NewServer("")
+	s.Verifier = HMACVerifier{"k1": []byte("secret")}
+	if err := s.RegisterFunc("Echo.Int", func(in int) (int, error) { return in, nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	_, c := NewLocalPair(s)
+	defer c.Close()
+
+	var out int
+	if err := c.Call("Echo.Int", 3, &out); err == nil {
+		t.Error("unsigned call accepted")
+	}
+
+	c.SetSigner(&HMACSigner{KeyID: "k1", Secret: []byte("secret")})
+	if err := c.Method("Echo.Int").Meta("tenant", "acme").Do(context.Background(), 3, &out); err != nil || out != 3 {
+		t.Errorf("signed call: %d, %v", out, err)
+	}
+
+	c.SetSigner(&HMACSigner{KeyID: "k1", Secret: []byte("other")})
+	if err := c.Call("Echo.Int", 3, &out); err == nil {
+		t.Error("call signed with another secret accepted")
+	}
+}
+
+func TestTamperedEnvelope(t *testing.T) {
+	s := NewServer("")
+	s.Verifier = HMACVerifier{"k1": []byte("secret")}
+	signer := &HMACSigner{KeyID: "k1", Secret: []byte("secret")}
+
+	if err := s.verifySignature(ProtocolJSONRPC2, signedRequest(t, signer)); err != nil {
+		t.Fatalf("good signature rejected: %v", err)
+	}
+
+	// re-encoding the params doesn't break the signature
+	req := signedRequest(t, signer)
+	req.Param = json.RawMessage(`{"all":true,"id":1}`)
+	if err := s.verifySignature(ProtocolJSONRPC2, req); err != nil {
+		t.Errorf("canonically equal params rejected: %v", err)
+	}
+
+	tampers := map[string]func(req *Request){
+		"method": func(req *Request) { req.Method = "Account.Delete" },
+		"id":     func(req *Request) { req.Id = json.RawMessage(`8`) },
+		"params": func(req *Request) { req.Param = json.RawMessage(`{"id":2,"all":true}`) },
+		"meta":   func(req *Request) { req.Meta["tenant"] = "other" },
+		"added":  func(req *Request) { req.Meta[MetaMaxResultSize] = "1" },
+		"time":   func(req *Request) { req.Meta[MetaSignatureTime] = strconv.FormatInt(time.Now().Unix()+1, 10) },
+	}
+
+	for name, tamper := range tampers {
+		req := signedRequest(t, signer)
+		tamper(req)
+		if err := s.verifySignature(ProtocolJSONRPC2, req); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s tampered: got %v, want ErrInvalidSignature", name, err)
+		}
+	}
+
+	if err := s.verifySignature(ProtocolJSONRPC1, signedRequest(t, signer)); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("protocol changed: got %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestSignatureClockSkew(t *testing.T) {
+	s := NewServer("")
+	s.Verifier = HMACVerifier{"k1": []byte("secret")}
+	s.SignatureMaxAge = time.Minute
+	signer := &HMACSigner{KeyID: "k1", Secret: []byte("secret")}
+
+	for _, skew := range []time.Duration{-2 * time.Minute, -30 * time.Second, 30 * time.Second, 2 * time.Minute} {
+		req := &Request{Id: json.RawMessage(`1`), Method: "A.B"}
+		signedAt := strconv.FormatInt(time.Now().Add(skew).Unix(), 10)
+
+		payload, err := signaturePayload(ProtocolJSONRPC2, req, signedAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyID, signature, _ := signer.Sign(payload)
+		req.Meta = map[string]string{
+			MetaSignature:     base64.StdEncoding.EncodeToString(signature),
+			MetaSignatureKey:  keyID,
+			MetaSignatureTime: signedAt,
+		}
+
+		err = s.verifySignature(ProtocolJSONRPC2, req)
+		if tooFar := skew > time.Minute || skew < -time.Minute; tooFar != (err != nil) {
+			t.Errorf("signed %v away: got %v", skew, err)
+		}
+	}
+}
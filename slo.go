@@ -0,0 +1,243 @@
+package jsonrpc
+
+import (
+	"sync"
+	"time"
+)
+
+const sloBuckets = 10
+
+// Objective is a service level objective over a sliding window, e.g. "at most
+// 1% of the calls fail and at most 5% take longer than 200ms over 5 minutes".
+type Objective struct {
+	// Method is the method ("Service.Method") the objective applies to. When
+	// empty, it applies to every method, each tracked separately.
+	Method string
+
+	// Window is the period the rates are computed over.
+	Window time.Duration
+
+	// MaxErrorRate is the fraction of failed calls allowed, 0 disables the
+	// check.
+	MaxErrorRate float64
+
+	// Latency and MaxSlowRate are the latency objective: at most MaxSlowRate
+	// of the calls may take longer than Latency. 0 disables the check.
+	Latency     time.Duration
+	MaxSlowRate float64
+
+	// MinCalls is the number of calls needed in the window before the objective
+	// is evaluated, so that a single failure on an idle method doesn't count
+	// as a breach.
+	MinCalls int
+}
+
+// SLOStatus is the state of an objective for one method.
+type SLOStatus struct {
+	Method string
+	Calls  int
+	Errors int
+	Slow   int
+
+	// Breached is true while the objective isn't met.
+	Breached bool
+}
+
+// ErrorRate returns the fraction of failed calls.
+func (st SLOStatus) ErrorRate() float64 {
+	if st.Calls == 0 {
+		return 0
+	}
+	return float64(st.Errors) / float64(st.Calls)
+}
+
+// SlowRate returns the fraction of calls slower than the latency objective.
+func (st SLOStatus) SlowRate() float64 {
+	if st.Calls == 0 {
+		return 0
+	}
+	return float64(st.Slow) / float64(st.Calls)
+}
+
+// SLOTracker tracks objectives per method. It is a MetricsRecorder: set it as
+// the server's Metrics, or chain it with another recorder with MultiRecorder.
+type SLOTracker struct {
+	Objectives []Objective
+
+	// OnBreach is called when a method stops meeting an objective, OnRecover
+	// when it meets it again. Objectives are evaluated as calls complete, and
+	// the callbacks run on the goroutine handling the call.
+	OnBreach  func(o Objective, st SLOStatus)
+	OnRecover func(o Objective, st SLOStatus)
+
+	m       sync.Mutex
+	windows map[sloKey]*sloWindow
+}
+
+type sloKey struct {
+	objective int
+	method    string
+}
+
+// sloWindow counts calls over a sliding window of sloBuckets buckets.
+type sloWindow struct {
+	bucketSize time.Duration
+	calls      [sloBuckets]int
+	errors     [sloBuckets]int
+	slow       [sloBuckets]int
+	head       int
+	headAt     time.Time
+	breached   bool
+}
+
+func (w *sloWindow) advance(now time.Time) {
+	if w.bucketSize <= 0 {
+		return
+	}
+
+	for n := 0; now.Sub(w.headAt) >= w.bucketSize && n < sloBuckets; n++ {
+		w.head = (w.head + 1) % sloBuckets
+		w.calls[w.head], w.errors[w.head], w.slow[w.head] = 0, 0, 0
+		w.headAt = w.headAt.Add(w.bucketSize)
+	}
+
+	if now.Sub(w.headAt) >= w.bucketSize {
+		w.headAt = now
+	}
+}
+
+func (w *sloWindow) status(method string) (st SLOStatus) {
+	st.Method = method
+	for i := 0; i < sloBuckets; i++ {
+		st.Calls += w.calls[i]
+		st.Errors += w.errors[i]
+		st.Slow += w.slow[i]
+	}
+	st.Breached = w.breached
+	return
+}
+
+// breached reports whether st misses o.
+func (o *Objective) breached(st SLOStatus) bool {
+	if st.Calls == 0 || st.Calls < o.MinCalls {
+		return false
+	}
+
+	if o.MaxErrorRate > 0 && st.ErrorRate() > o.MaxErrorRate {
+		return true
+	}
+
+	return o.Latency > 0 && o.MaxSlowRate > 0 && st.SlowRate() > o.MaxSlowRate
+}
+
+// ObserveCall implements MetricsRecorder.
+func (t *SLOTracker) ObserveCall(method string, duration time.Duration, err error) {
+	type transition struct {
+		o  Objective
+		st SLOStatus
+	}
+	var transitions []transition
+
+	now := time.Now()
+
+	t.m.Lock()
+	for i := range t.Objectives {
+		o := &t.Objectives[i]
+		if o.Method != "" && o.Method != method {
+			continue
+		}
+
+		w := t.window(i, method, now)
+		w.advance(now)
+		w.calls[w.head]++
+		if err != nil {
+			w.errors[w.head]++
+		}
+		if o.Latency > 0 && duration > o.Latency {
+			w.slow[w.head]++
+		}
+
+		st := w.status(method)
+		if breached := o.breached(st); breached != w.breached {
+			w.breached = breached
+			st.Breached = breached
+			transitions = append(transitions, transition{*o, st})
+		}
+	}
+	t.m.Unlock()
+
+	for _, tr := range transitions {
+		if tr.st.Breached && t.OnBreach != nil {
+			t.OnBreach(tr.o, tr.st)
+		} else if !tr.st.Breached && t.OnRecover != nil {
+			t.OnRecover(tr.o, tr.st)
+		}
+	}
+}
+
+// window returns the window of objective i for method. Must be called with t.m
+// held.
+func (t *SLOTracker) window(i int, method string, now time.Time) *sloWindow {
+	if t.windows == nil {
+		t.windows = make(map[sloKey]*sloWindow)
+	}
+
+	key := sloKey{i, method}
+	w, ok := t.windows[key]
+	if !ok {
+		w = &sloWindow{
+			bucketSize: t.Objectives[i].Window / sloBuckets,
+			headAt:     now,
+		}
+		t.windows[key] = w
+	}
+	return w
+}
+
+// Status returns the state of every objective that applies to method, in the
+// order of Objectives. Objectives without a call to method yet are omitted.
+func (t *SLOTracker) Status(method string) (statuses []SLOStatus) {
+	now := time.Now()
+
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	for i := range t.Objectives {
+		w, ok := t.windows[sloKey{i, method}]
+		if !ok {
+			continue
+		}
+
+		w.advance(now)
+		st := w.status(method)
+		st.Breached = t.Objectives[i].breached(st)
+		statuses = append(statuses, st)
+	}
+
+	return
+}
+
+// Breached reports whether method currently misses any of its objectives, e.g.
+// to shed its calls from an interceptor.
+func (t *SLOTracker) Breached(method string) bool {
+	for _, st := range t.Status(method) {
+		if st.Breached {
+			return true
+		}
+	}
+	return false
+}
+
+// MultiRecorder returns a MetricsRecorder forwarding every observation to each
+// of recorders.
+func MultiRecorder(recorders ...MetricsRecorder) MetricsRecorder {
+	return multiRecorder(recorders)
+}
+
+type multiRecorder []MetricsRecorder
+
+func (m multiRecorder) ObserveCall(method string, duration time.Duration, err error) {
+	for _, r := range m {
+		r.ObserveCall(method, duration, err)
+	}
+}
@@ -0,0 +1,79 @@
+package jsonrpc
+
+import (
+	"io"
+	"net"
+	"time"
+)
+
+// streamAddr is the address of both ends of a stream that isn't a network
+// connection.
+type streamAddr struct{}
+
+func (streamAddr) Network() string { return "stream" }
+func (streamAddr) String() string  { return "stream" }
+
+// streamConn adapts a stream to net.Conn. Deadlines are passed on to streams
+// supporting them and ignored otherwise.
+type streamConn struct {
+	io.ReadWriteCloser
+}
+
+func (c streamConn) LocalAddr() net.Addr  { return streamAddr{} }
+func (c streamConn) RemoteAddr() net.Addr { return streamAddr{} }
+
+func (c streamConn) SetDeadline(t time.Time) error {
+	if d, ok := c.ReadWriteCloser.(interface{ SetDeadline(time.Time) error }); ok {
+		return d.SetDeadline(t)
+	}
+	return nil
+}
+
+func (c streamConn) SetReadDeadline(t time.Time) error {
+	if d, ok := c.ReadWriteCloser.(interface{ SetReadDeadline(time.Time) error }); ok {
+		return d.SetReadDeadline(t)
+	}
+	return nil
+}
+
+func (c streamConn) SetWriteDeadline(t time.Time) error {
+	if d, ok := c.ReadWriteCloser.(interface{ SetWriteDeadline(time.Time) error }); ok {
+		return d.SetWriteDeadline(t)
+	}
+	return nil
+}
+
+// streamAsConn returns rwc as a net.Conn.
+func streamAsConn(rwc io.ReadWriteCloser) net.Conn {
+	if conn, ok := rwc.(net.Conn); ok {
+		return conn
+	}
+
+	return streamConn{rwc}
+}
+
+// ServeConn serves a single connection over rwc, any stream such as a serial
+// port, an SSH channel or an in-memory pipe, until it fails or is closed.
+// rwc is closed when ServeConn returns.
+func (s *Server) ServeConn(rwc io.ReadWriteCloser) {
+	newConnection(s, streamAsConn(rwc)).Serve()
+}
+
+// NewClientFromConn returns a client calling the server at the other end of
+// rwc, served by ServeConn or any other JSON-RPC implementation. Closing the
+// client closes rwc.
+func NewClientFromConn(rwc io.ReadWriteCloser) *Client {
+	return newClient("", streamAsConn(rwc), nil)
+}
+
+// NewLocalPair connects a client to s over an in-memory pipe, for testing
+// services without opening sockets. The returned connection is already being
+// served; closing the client ends it.
+func NewLocalPair(s *Server) (*Connection, *Client) {
+	serverEnd, clientEnd := net.Pipe()
+
+	conn := newConnection(s, serverEnd)
+	go conn.Serve()
+
+	return conn, newClient("pipe", clientEnd, nil)
+}
@@ -0,0 +1,149 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+)
+
+// envelopeFields lists the top-level fields of a request and whether they are
+// required.
+var envelopeFields = map[string]bool{
+	"id":     false,
+	"method": true,
+	"param":  false,
+	"meta":   false,
+}
+
+// splitEnvelope decodes the top-level fields of a request envelope and reads its
+// id; requests without an id are notifications. The returned request is never
+// nil so that errors can be reported with the request's id when it could be
+// read.
+func splitEnvelope(raw json.RawMessage) (req *Request, fields map[string]json.RawMessage, err error) {
+	req = &Request{}
+
+	if err = json.Unmarshal(raw, &fields); err != nil || fields == nil {
+		err = newError(CodeInvalidRequest, "invalid request envelope: expected a JSON object")
+		return
+	}
+
+	id, ok := fields["id"]
+	if !ok {
+		req.notification = true
+		return
+	}
+
+	switch firstByte(id) {
+	case '"', 'n', '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		req.Id = id
+	default:
+		err = newError(CodeInvalidRequest, "invalid request envelope: field 'id' must be a string, a number or null")
+		return
+	}
+
+	return
+}
+
+// checkEnvelopeFields rejects unknown top-level fields and missing required ones.
+func checkEnvelopeFields(fields map[string]json.RawMessage, allowed map[string]bool) *Error {
+	var unknown []string
+	for name := range fields {
+		if _, ok := allowed[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return newError(CodeInvalidRequest, "invalid request envelope: unknown field '%s'", unknown[0])
+	}
+
+	var missing []string
+	for name, required := range allowed {
+		if _, ok := fields[name]; required && !ok {
+			missing = append(missing, name)
+		}
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return newError(CodeInvalidRequest, "invalid request envelope: missing required field '%s'", missing[0])
+	}
+
+	return nil
+}
+
+// checkStrictEnvelope rejects duplicate, unknown and missing top-level fields
+// of the request raw, whose fields are already decoded.
+func checkStrictEnvelope(raw json.RawMessage, fields map[string]json.RawMessage, allowed map[string]bool) *Error {
+	if name, ok := duplicateMember(raw); ok {
+		return newError(CodeInvalidRequest, "invalid request envelope: duplicate field '%s'", name)
+	}
+
+	return checkEnvelopeFields(fields, allowed)
+}
+
+// duplicateMember returns the first member of the JSON object raw that appears
+// more than once, which encoding/json would silently resolve to the last one.
+func duplicateMember(raw json.RawMessage) (name string, ok bool) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	if _, err := decoder.Token(); err != nil {
+		return
+	}
+
+	seen := make(map[string]bool)
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return
+		}
+
+		key, _ := token.(string)
+		if seen[key] {
+			return key, true
+		}
+		seen[key] = true
+
+		var value json.RawMessage
+		if err = decoder.Decode(&value); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// strictParams decodes params like decodeParams, rejecting members of a params
+// object that in has no field for.
+func strictParams(params json.RawMessage, in interface{}) error {
+	if firstByte(params) != '{' {
+		return decodeParams(params, in)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(params))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(in)
+}
+
+// parseStrictRequest decodes a request envelope, rejecting duplicate and unknown
+// top-level fields and missing required ones.
+func parseStrictRequest(raw json.RawMessage) (req *Request, err error) {
+	req, fields, err := splitEnvelope(raw)
+	if err != nil {
+		return
+	}
+
+	if rpcErr := checkStrictEnvelope(raw, fields, envelopeFields); rpcErr != nil {
+		err = rpcErr
+		return
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(req); err != nil {
+		err = newError(CodeInvalidRequest, "invalid request envelope: %v", err)
+		return
+	}
+
+	return
+}
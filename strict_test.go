@@ -0,0 +1,117 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type Transfer struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Amount int    `json:"amount"`
+}
+
+func newStrictServer(t *testing.T, protocol Protocol) *Server {
+	s := NewServer("")
+	s.Protocol = protocol
+	s.StrictEnvelope = true
+
+	err := s.RegisterFunc("Bank.Transfer", func(ctx context.Context, in Transfer) (int, error) { return in.Amount, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// strictResponse is a response of either protocol.
+type strictResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  json.RawMessage `json:"error"`
+}
+
+// failed reports whether resp is an error mentioning message.
+func (resp *strictResponse) failed(message string) bool {
+	return len(resp.Error) > 0 && string(resp.Error) != `""` && string(resp.Error) != "null" &&
+		strings.Contains(string(resp.Error), message)
+}
+
+func TestStrictEnvelope(t *testing.T) {
+	tests := []struct {
+		protocol Protocol
+		frame    string
+		err      string
+	}{
+		{ProtocolLegacy, `{"id":1,"method":"Bank.Transfer","param":{"amount":5}}`, ""},
+		{ProtocolLegacy, `{"id":1,"method":"Bank.Transfer","param":{"amount":5},"params":{}}`, "unknown field 'params'"},
+		{ProtocolLegacy, `{"id":1,"param":{"amount":5}}`, "missing required field 'method'"},
+		{ProtocolJSONRPC2, `{"jsonrpc":"2.0","id":1,"method":"Bank.Transfer","params":{"amount":5}}`, ""},
+		{ProtocolJSONRPC2, `{"jsonrpc":"2.0","id":1,"method":"Bank.Transfer","params":{"amount":5},"extra":1}`, "unknown field 'extra'"},
+		{ProtocolJSONRPC2, `{"id":1,"method":"Bank.Transfer","params":{"amount":5}}`, "jsonrpc"},
+	}
+	for _, test := range tests {
+		rc := newRawConn(t, newStrictServer(t, test.protocol))
+
+		var resp strictResponse
+		rc.call(test.frame, &resp)
+		if test.err == "" && string(resp.Result) != "5" {
+			t.Errorf("%s: %s, %s", test.frame, resp.Result, resp.Error)
+		}
+		if test.err != "" && !resp.failed(test.err) {
+			t.Errorf("%s: got error %s, want %q", test.frame, resp.Error, test.err)
+		}
+	}
+
+	// without StrictEnvelope unknown fields are ignored
+	s := newStrictServer(t, ProtocolLegacy)
+	s.StrictEnvelope = false
+
+	var resp strictResponse
+	newRawConn(t, s).call(`{"id":1,"method":"Bank.Transfer","param":{"amount":5},"extra":1}`, &resp)
+	if string(resp.Result) != "5" {
+		t.Errorf("lax envelope: %s, %s", resp.Result, resp.Error)
+	}
+}
+
+func TestStrictDuplicatesAndParams(t *testing.T) {
+	tests := []struct {
+		frame string
+		err   string
+	}{
+		{`{"jsonrpc":"2.0","id":1,"method":"Bank.Transfer","method":"Bank.Drain","params":{"amount":5}}`, "duplicate field 'method'"},
+		{`{"jsonrpc":"2.0","id":1,"id":2,"method":"Bank.Transfer","params":{"amount":5}}`, "duplicate field 'id'"},
+		{`{"jsonrpc":"2.0","id":1,"method":"Bank.Transfer","params":{"amount":5,"currency":"EUR"}}`, "currency"},
+		{`{"jsonrpc":"2.0","id":1,"method":"Bank.Transfer","params":{"from":"a","to":"b","amount":5}}`, ""},
+		{`{"jsonrpc":"2.0","id":1,"method":"Bank.Transfer","params":["a","b",5]}`, ""},
+	}
+	for _, test := range tests {
+		rc := newRawConn(t, newStrictServer(t, ProtocolJSONRPC2))
+
+		var resp struct {
+			Result json.RawMessage `json:"result"`
+			Error  *Error          `json:"error"`
+		}
+		rc.call(test.frame, &resp)
+
+		switch {
+		case test.err == "":
+			if resp.Error != nil || string(resp.Result) != "5" {
+				t.Errorf("%s: %s, %v", test.frame, resp.Result, resp.Error)
+			}
+		case resp.Error == nil || !strings.Contains(resp.Error.Message, test.err):
+			t.Errorf("%s: got error %v, want %q", test.frame, resp.Error, test.err)
+		}
+	}
+
+	// unknown params members are invalid params, the envelope is fine
+	rc := newRawConn(t, newStrictServer(t, ProtocolJSONRPC2))
+
+	var resp struct {
+		Error *Error `json:"error"`
+	}
+	rc.call(`{"jsonrpc":"2.0","id":1,"method":"Bank.Transfer","params":{"amount":5,"memo":"x"}}`, &resp)
+	if resp.Error == nil || resp.Error.Code != CodeInvalidParams {
+		t.Errorf("unknown params member: %v", resp.Error)
+	}
+}
@@ -0,0 +1,123 @@
+package jsonrpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/url"
+	"time"
+)
+
+// tlsHandshakeTimeout bounds the TLS handshake of accepted connections.
+const tlsHandshakeTimeout = 10 * time.Second
+
+// ListenAndServeTLS is like ListenAndServe, serving TLS connections. The
+// certificate and key are loaded from certFile and keyFile, which may be empty
+// if TLSConfig already holds a certificate. A Listener set beforehand is wrapped
+// in TLS.
+func (s *Server) ListenAndServeTLS(certFile, keyFile string) (err error) {
+	config := &tls.Config{}
+	if s.TLSConfig != nil {
+		config = s.TLSConfig.Clone()
+	}
+
+	if s.ClientCAs != nil {
+		config.ClientCAs = s.ClientCAs
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return err
+		}
+		config.Certificates = append([]tls.Certificate{cert}, config.Certificates...)
+	}
+
+	err = s.listenOnce(func(l net.Listener) net.Listener {
+		return tls.NewListener(l, config)
+	})
+	if err != nil {
+		return
+	}
+
+	err = s.Serve()
+	return
+}
+
+// DialTLS connects to the server at addr over TLS. config may be nil; when it
+// doesn't name the server, the host of addr is verified.
+func DialTLS(addr string, config *tls.Config) (c *Client, err error) {
+	if config == nil {
+		config = &tls.Config{}
+	}
+
+	return DialContext(context.Background(), addr, WithTLS(config))
+}
+
+// PeerIdentity is the identity of a client proven by a certificate verified
+// during the TLS handshake.
+type PeerIdentity struct {
+	Subject        string
+	DNSNames       []string
+	EmailAddresses []string
+	IPAddresses    []net.IP
+	URIs           []*url.URL
+
+	// Certificate is the client's verified certificate.
+	Certificate *x509.Certificate
+}
+
+// PeerFromContext returns the verified identity of the client that sent the
+// request being handled, if it presented a certificate the server verified.
+func PeerFromContext(ctx context.Context) (*PeerIdentity, bool) {
+	info, ok := ConnInfoFromContext(ctx)
+	if !ok || info.Peer == nil {
+		return nil, false
+	}
+
+	return info.Peer, true
+}
+
+// peerIdentity returns the identity of the peer of a TLS connection, nil
+// unless its certificate was verified.
+func peerIdentity(state tls.ConnectionState) *PeerIdentity {
+	if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	cert := state.VerifiedChains[0][0]
+	return &PeerIdentity{
+		Subject:        cert.Subject.String(),
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+		IPAddresses:    cert.IPAddresses,
+		URIs:           cert.URIs,
+		Certificate:    cert,
+	}
+}
+
+// handshake completes the TLS handshake of a TLS connection before it is
+// served, recording the identity of the client.
+func (conn *Connection) handshake() (err error) {
+	tlsConn, ok := conn.c.(*tls.Conn)
+	if !ok {
+		return
+	}
+
+	if err = tlsConn.SetDeadline(time.Now().Add(tlsHandshakeTimeout)); err != nil {
+		return
+	}
+
+	if err = tlsConn.Handshake(); err != nil {
+		return
+	}
+
+	if err = tlsConn.SetDeadline(time.Time{}); err != nil {
+		return
+	}
+
+	conn.info.Peer = peerIdentity(tlsConn.ConnectionState())
+	return
+}
@@ -0,0 +1,186 @@
+package jsonrpc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// testCA issues certificates for tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+// issue returns a certificate for template signed by the CA.
+func (ca *testCA) issue(t *testing.T, template *x509.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// serveTLS serves s over TLS on a loopback address with a certificate of ca.
+func serveTLS(t *testing.T, s *Server, ca *testCA) (addr string) {
+	serverCert := ca.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "server"},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	s.TLSConfig = &tls.Config{Certificates: []tls.Certificate{serverCert}}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Listener = l
+	go s.ListenAndServeTLS("", "")
+	t.Cleanup(func() { l.Close() })
+
+	return l.Addr().String()
+}
+
+func TestTLSCall(t *testing.T) {
+	ca := newTestCA(t)
+
+	s := NewServer("")
+	err := s.RegisterFunc("Echo.Int", func(ctx context.Context, in int) (int, error) { return in, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := serveTLS(t, s, ca)
+
+	c, err := DialTLS(addr, &tls.Config{RootCAs: ca.pool})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var out int
+	if err = c.Call("Echo.Int", 42, &out); err != nil || out != 42 {
+		t.Fatalf("Echo.Int(42) = %d, %v", out, err)
+	}
+
+	// the server's certificate is verified
+	if c, err := DialTLS(addr, nil); err == nil {
+		c.Close()
+		t.Error("dialed a server whose certificate isn't trusted")
+	}
+}
+
+func TestMutualTLSPeerIdentity(t *testing.T) {
+	ca := newTestCA(t)
+
+	s := NewServer("")
+	s.ClientCAs = ca.pool
+	s.Bans = &BanPolicy{}
+	err := s.RegisterFunc("Peer.Whoami", func(ctx context.Context, _ int) (string, error) {
+		peer, ok := PeerFromContext(ctx)
+		if !ok {
+			return "", errors.New("no verified peer")
+		}
+		return peer.Subject + " " + peer.URIs[0].String(), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := serveTLS(t, s, ca)
+
+	worker, _ := url.Parse("spiffe://example.org/worker")
+	clientCert := ca.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "client-1", Organization: []string{"Acme"}},
+		URIs:        []*url.URL{worker},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+
+	c, err := DialTLS(addr, &tls.Config{RootCAs: ca.pool, Certificates: []tls.Certificate{clientCert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var whoami string
+	if err = c.Call("Peer.Whoami", 0, &whoami); err != nil {
+		t.Fatal(err)
+	}
+	if want := "CN=client-1,O=Acme spiffe://example.org/worker"; whoami != want {
+		t.Errorf("peer %q, want %q", whoami, want)
+	}
+
+	// clients without a certificate of the CA aren't served
+	other := newTestCA(t)
+	strangerCert := other.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "stranger"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	for _, certs := range [][]tls.Certificate{nil, {strangerCert}} {
+		c, err := DialTLS(addr, &tls.Config{RootCAs: ca.pool, Certificates: certs})
+		if err != nil {
+			continue
+		}
+		err = c.Call("Peer.Whoami", 0, &whoami)
+		c.Close()
+		if err == nil {
+			t.Errorf("client with certificates %d served as %q", len(certs), whoami)
+		}
+	}
+
+	// the failed handshakes are counted once the server is done with them
+	deadline := time.Now().Add(5 * time.Second)
+	for s.Bans.Violations()[ViolationAuth] != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d failed handshakes counted", s.Bans.Violations()[ViolationAuth])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,89 @@
+package jsonrpc
+
+import (
+	"math/rand"
+)
+
+// Tracer is notified of every sampled call handled by the server.
+type Tracer interface {
+	// StartSpan is called before the handler runs. The returned function is
+	// called with the handler's error once it returns.
+	StartSpan(req *Request) (finish func(err error))
+}
+
+// Sampler decides whether a call is traced.
+type Sampler interface {
+	ShouldSample(req *Request) bool
+}
+
+// SamplerFunc adapts a function to the Sampler interface.
+type SamplerFunc func(req *Request) bool
+
+func (f SamplerFunc) ShouldSample(req *Request) bool {
+	return f(req)
+}
+
+// AlwaysSample traces every call.
+func AlwaysSample() Sampler {
+	return SamplerFunc(func(*Request) bool { return true })
+}
+
+// NeverSample traces no call.
+func NeverSample() Sampler {
+	return SamplerFunc(func(*Request) bool { return false })
+}
+
+// RatioSampler traces the given fraction (0..1) of calls.
+func RatioSampler(ratio float64) Sampler {
+	return SamplerFunc(func(*Request) bool {
+		return rand.Float64() < ratio
+	})
+}
+
+// RateLimitedSampler traces at most perSecond calls per second, allowing bursts
+// of up to perSecond calls.
+func RateLimitedSampler(perSecond float64) Sampler {
+	limiter := newTokenBucket(perSecond, int(perSecond))
+	return SamplerFunc(func(*Request) bool {
+		return limiter.allow()
+	})
+}
+
+// ParentBasedSampler follows the sampling decision of the caller's parent span
+// when parent reports one (ok is true), and falls back to root otherwise.
+func ParentBasedSampler(parent func(req *Request) (sampled, ok bool), root Sampler) Sampler {
+	return SamplerFunc(func(req *Request) bool {
+		if sampled, ok := parent(req); ok {
+			return sampled
+		}
+		return root.ShouldSample(req)
+	})
+}
+
+// MethodSampler applies per-method overrides, keyed by full method name
+// ("Service.Method"), on top of a default sampler.
+type MethodSampler struct {
+	Default Sampler
+	Methods map[string]Sampler
+}
+
+func (s *MethodSampler) ShouldSample(req *Request) bool {
+	if sampler, ok := s.Methods[req.Method]; ok {
+		return sampler.ShouldSample(req)
+	}
+
+	if s.Default == nil {
+		return true
+	}
+	return s.Default.ShouldSample(req)
+}
+
+// startSpan starts a span for req if a tracer is set and the call is sampled.
+// The returned function is never nil.
+func (s *Server) startSpan(req *Request) func(err error) {
+	if s.Tracer == nil || (s.Sampler != nil && !s.Sampler.ShouldSample(req)) {
+		return func(error) {}
+	}
+
+	return s.Tracer.StartSpan(req)
+}
@@ -0,0 +1,24 @@
+package jsonrpc
+
+// ResultTransformer post-processes the typed result of a handler before it is
+// encoded, e.g. to filter fields, convert units or wrap the result in an envelope.
+// The returned value is what gets sent to the client.
+type ResultTransformer func(req *Request, result interface{}) (interface{}, error)
+
+// UseResultTransformer appends t to the server's result transformers. They are run
+// in the order they were added, after every successful call.
+func (s *Server) UseResultTransformer(t ResultTransformer) {
+	s.resultTransformers = append(s.resultTransformers, t)
+}
+
+func (s *Server) transformResult(req *Request, result interface{}) (out interface{}, err error) {
+	out = result
+	for _, t := range s.resultTransformers {
+		out, err = t(req, out)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
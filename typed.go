@@ -0,0 +1,12 @@
+package jsonrpc
+
+// TypedCall calls method with req as params and returns its result decoded
+// into a Resp, sparing the caller the out parameter of Client.Call:
+//
+//	sum, err := jsonrpc.TypedCall[[2]int, int](client, "Arith.Add", [2]int{1, 2})
+//
+// It can't be named Call, the name of the client's call type.
+func TypedCall[Req, Resp any](c *Client, method string, req Req) (resp Resp, err error) {
+	err = c.Call(method, req, &resp)
+	return
+}
@@ -0,0 +1,90 @@
+package jsonrpc
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// unixScheme prefixes the addresses of Unix domain sockets, as in
+// "unix:///run/app.sock".
+const unixScheme = "unix://"
+
+// splitNetwork returns the network and address of addr, a "host:port" TCP
+// address or a unix:// socket path.
+func splitNetwork(addr string) (network, address string) {
+	if strings.HasPrefix(addr, unixScheme) {
+		return "unix", strings.TrimPrefix(addr, unixScheme)
+	}
+
+	return "tcp", addr
+}
+
+// listen listens on s.Addr. Unix sockets get the permissions of SocketMode if
+// set; a socket file left behind by a server that is gone is replaced.
+func (s *Server) listen() (l net.Listener, err error) {
+	network, address := splitNetwork(s.Addr)
+	if network != "unix" {
+		return net.Listen(network, address)
+	}
+
+	if info, err := os.Lstat(address); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if c, err := net.Dial("unix", address); err == nil {
+			_ = c.Close()
+		} else {
+			_ = os.Remove(address)
+		}
+	}
+
+	if s.SocketMode == 0 {
+		return net.Listen("unix", address)
+	}
+	return listenUnixMode(address, s.SocketMode)
+}
+
+// listenUnixMode listens on a Unix socket at address with the permissions of
+// mode. The socket is created in a private directory next to address, and
+// only linked to address once it has them, so that no one can connect to it
+// before.
+func listenUnixMode(address string, mode os.FileMode) (l net.Listener, err error) {
+	dir, err := os.MkdirTemp(filepath.Dir(address), ".jsonrpc-")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	private := filepath.Join(dir, "socket")
+	ul, err := net.ListenUnix("unix", &net.UnixAddr{Name: private, Net: "unix"})
+	if err != nil {
+		return
+	}
+	ul.SetUnlinkOnClose(false)
+
+	// unlike a rename, linking fails if the address is taken
+	if err = os.Chmod(private, mode); err == nil {
+		err = os.Link(private, address)
+	}
+	if err != nil {
+		_ = ul.Close()
+		return nil, err
+	}
+
+	return &unixListener{UnixListener: ul, path: address}, nil
+}
+
+// unixListener is a Unix socket listener that was linked to path.
+type unixListener struct {
+	*net.UnixListener
+	path string
+}
+
+func (l *unixListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: l.path, Net: "unix"}
+}
+
+// Close closes the listener and removes its socket, as Go's listeners do.
+func (l *unixListener) Close() error {
+	_ = os.Remove(l.path)
+	return l.UnixListener.Close()
+}
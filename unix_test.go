@@ -0,0 +1,142 @@
+package jsonrpc
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// serveUnix serves s on its unix:// Addr and waits until it accepts
+// connections.
+func serveUnix(t *testing.T, s *Server) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix sockets with permissions aren't supported on Windows")
+	}
+
+	err := s.RegisterFunc("Echo.Int", func(ctx context.Context, in int) (int, error) { return in, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error, 1)
+	go func() { errs <- s.ListenAndServe() }()
+	t.Cleanup(func() { s.Close() })
+
+	_, path := splitNetwork(s.Addr)
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		if c, err := net.Dial("unix", path); err == nil {
+			c.Close()
+			return
+		}
+
+		select {
+		case err := <-errs:
+			t.Fatal(err)
+		default:
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("socket never accepted connections")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rpc.sock")
+
+	s := NewServer("unix://" + path)
+	s.SocketMode = 0666
+	serveUnix(t, s)
+
+	c, err := Dial("unix://" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var out int
+	if err = c.Call("Echo.Int", 42, &out); err != nil || out != 42 {
+		t.Fatalf("Echo.Int(42) = %d, %v", out, err)
+	}
+
+	// the mode is applied as is, whatever the umask
+	info, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSocket == 0 || info.Mode().Perm() != 0666 {
+		t.Errorf("socket mode %v", info.Mode())
+	}
+
+	// nothing is left of the private directory the socket was created in
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("%d files next to the socket", len(entries)-1)
+	}
+
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("socket left behind: %v", err)
+	}
+}
+
+func TestUnixSocketReplacesStale(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix sockets with permissions aren't supported on Windows")
+	}
+
+	path := filepath.Join(t.TempDir(), "rpc.sock")
+
+	// a socket left behind by a server that crashed
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.SetUnlinkOnClose(false)
+	stale.Close()
+
+	s := NewServer("unix://" + path)
+	s.SocketMode = 0600
+	serveUnix(t, s)
+
+	if info, err := os.Lstat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("socket %v, %v", info.Mode(), err)
+	}
+}
+
+func TestUnixSocketInUse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rpc.sock")
+
+	live := NewServer("unix://" + path)
+	serveUnix(t, live)
+
+	for _, mode := range []os.FileMode{0, 0600} {
+		s := NewServer("unix://" + path)
+		s.SocketMode = mode
+		if l, err := s.listen(); err == nil {
+			l.Close()
+			t.Errorf("mode %v: listened on the socket of a live server", mode)
+		}
+	}
+
+	c, err := Dial("unix://" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var out int
+	if err = c.Call("Echo.Int", 1, &out); err != nil {
+		t.Errorf("live server broken: %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// DisableMethod makes calls to method, named "Service.Method", fail with
+// CodeMethodDisabled until it is enabled again with EnableMethod.
+func (s *Server) DisableMethod(method string) error {
+	return s.setMethodDisabled(method, 1)
+}
+
+// EnableMethod serves method again after DisableMethod.
+func (s *Server) EnableMethod(method string) error {
+	return s.setMethodDisabled(method, 0)
+}
+
+func (s *Server) setMethodDisabled(method string, disabled int32) error {
+	_, mthd, err := s.getMethod(method)
+	if err != nil {
+		return err
+	}
+
+	atomic.StoreInt32(&mthd.disabled, disabled)
+	return nil
+}
+
+func (mthd *serviceMethod) isDisabled() bool {
+	return atomic.LoadInt32(&mthd.disabled) != 0
+}
+
+// unknownMethod returns the response to req, a call to a method that isn't
+// registered or is disabled, failing with err unless UnknownMethod says
+// otherwise.
+func (s *Server) unknownMethod(req *Request, err error) *Response {
+	rpcErr := toError(err)
+	if s.UnknownMethod != nil {
+		rpcErr = s.UnknownMethod(req, rpcErr)
+	}
+
+	return newErrorResponse(req, rpcErr)
+}
+
+// suggestion is the data of errors returned by SuggestMethod.
+type suggestion struct {
+	Suggestion string `json:"suggestion"`
+}
+
+// suggestSlack is how much longer than the longest registered method name the
+// name of a call can be for SuggestMethod to look for one close to it.
+const suggestSlack = 8
+
+// SuggestMethod is an UnknownMethod hook naming the registered method closest
+// to the one called, if any is close enough, in the error message and as the
+// "suggestion" member of its data. Names much longer than any registered one
+// aren't compared, so that the cost stays bounded.
+func (s *Server) SuggestMethod(req *Request, err *Error) *Error {
+	if err.Code == CodeMethodDisabled {
+		return err
+	}
+
+	names := s.methodNames()
+
+	longest := 0
+	for _, method := range names {
+		if len(method) > longest {
+			longest = len(method)
+		}
+	}
+	if len(req.Method) > longest+suggestSlack {
+		return err
+	}
+
+	best, bestDistance := "", len(req.Method)/3+1
+	for _, method := range names {
+		// the distance is at least the difference in length
+		if diff := len(method) - len(req.Method); diff >= bestDistance || -diff >= bestDistance {
+			continue
+		}
+		if d := editDistance(strings.ToLower(req.Method), strings.ToLower(method)); d < bestDistance {
+			best, bestDistance = method, d
+		}
+	}
+
+	if best == "" {
+		return err
+	}
+
+	suggested := &Error{
+		Code:    err.Code,
+		Message: err.Message + "; did you mean '" + best + "'?",
+	}
+	suggested.Data, _ = json.Marshal(&suggestion{Suggestion: best})
+
+	return suggested
+}
+
+// methodNames returns the names of the registered methods, in order.
+func (s *Server) methodNames() (names []string) {
+	s.services.RLock()
+	defer s.services.RUnlock()
+
+	for serviceName, svc := range s.serviceMap {
+		for methodName, mthd := range svc.methodMap {
+			if !mthd.isDisabled() {
+				names = append(names, serviceName+"."+methodName)
+			}
+		}
+	}
+
+	sort.Strings(names)
+	return
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,47 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSuggestMethod(t *testing.T) {
+	s := NewServer("")
+	echo := func(ctx context.Context, in int) (int, error) { return in, nil }
+	for _, name := range []string{"Account.Balance", "Account.Transfer", "Ledger.Entries"} {
+		if err := s.RegisterFunc(name, echo); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		method, suggestion string
+	}{
+		{"Account.Balanse", "Account.Balance"},
+		{"account.transfer", "Account.Transfer"},
+		{"Ledger.Entry", "Ledger.Entries"},
+		{"Billing.Charge", ""},
+		{"A.B", ""},
+		{"Account.Balance" + strings.Repeat("x", suggestSlack+1), ""},
+		{strings.Repeat("Account.Balance", 1000), ""},
+	}
+	for _, test := range tests {
+		unknown := newError(CodeMethodNotFound, "method '%s' not found", test.method)
+		err := s.SuggestMethod(&Request{Method: test.method}, unknown)
+
+		var data suggestion
+		if err.Data != nil {
+			if jsonErr := json.Unmarshal(err.Data, &data); jsonErr != nil {
+				t.Fatal(jsonErr)
+			}
+		}
+		if data.Suggestion != test.suggestion {
+			t.Errorf("%.40s: suggested %q, want %q", test.method, data.Suggestion, test.suggestion)
+		}
+		if test.suggestion == "" && err != unknown {
+			t.Errorf("%.40s: error replaced by %v", test.method, err)
+		}
+	}
+}
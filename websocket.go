@@ -0,0 +1,440 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// wsGUID is appended to the handshake key to compute the accept key, see
+// RFC 6455 section 1.3.
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// maxWSMessageSize bounds the messages read from a WebSocket.
+const maxWSMessageSize = maxHTTPBodySize
+
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+)
+
+var (
+	// ErrWSHandshake is returned by DialWS when the server doesn't accept the
+	// WebSocket upgrade.
+	ErrWSHandshake = errors.New("websocket handshake failed")
+
+	errWSProtocol   = errors.New("websocket protocol error")
+	errWSMessageLen = errors.New("websocket message too large")
+)
+
+// maxWSControlSize bounds the payload of control frames, see RFC 6455 section
+// 5.5.
+const maxWSControlSize = 125
+
+// wsConn is a net.Conn exchanging JSON-RPC frames as WebSocket messages: every
+// Write is sent as one message, and Read returns the payloads of the messages
+// received one after the other.
+type wsConn struct {
+	net.Conn
+	r *bufio.Reader
+
+	// client connections mask the frames they send and require the frames
+	// they receive to be unmasked, servers the other way around
+	client bool
+
+	// the opcode of the messages written: text for JSON, binary for the
+	// other wire formats
+	opcode byte
+
+	// payload is what's left to read of the current message
+	payload []byte
+
+	wm        sync.Mutex
+	closeOnce sync.Once
+}
+
+func newWSConn(conn net.Conn, r *bufio.Reader, client bool) *wsConn {
+	return &wsConn{
+		Conn:   conn,
+		r:      r,
+		client: client,
+		opcode: wsText,
+	}
+}
+
+func (ws *wsConn) Read(p []byte) (n int, err error) {
+	for len(ws.payload) == 0 {
+		if ws.payload, err = ws.readMessage(); err != nil {
+			return
+		}
+	}
+
+	n = copy(p, ws.payload)
+	ws.payload = ws.payload[n:]
+	return
+}
+
+// readMessage returns the payload of the next data message, answering the
+// control frames received before it.
+func (ws *wsConn) readMessage() (message []byte, err error) {
+	for {
+		fin, opcode, payload, err := ws.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case wsPing:
+			if err = ws.writeFrame(wsPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			_ = ws.writeFrame(wsClose, payload)
+			return nil, io.EOF
+		case wsText, wsBinary:
+			if message != nil {
+				return nil, errWSProtocol
+			}
+			message = payload
+		case wsContinuation:
+			if message == nil {
+				return nil, errWSProtocol
+			}
+			if len(message)+len(payload) > maxWSMessageSize {
+				return nil, errWSMessageLen
+			}
+			message = append(message, payload...)
+		default:
+			return nil, errWSProtocol
+		}
+
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+// readFrame reads a frame, unmasking its payload. Frames with reserved bits
+// set, masked the wrong way, or control frames that are fragmented or carry
+// more than 125 bytes are protocol errors.
+func (ws *wsConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err = io.ReadFull(ws.r, header[:]); err != nil {
+		return
+	}
+
+	fin, opcode = header[0]&0x80 != 0, header[0]&0x0F
+	masked := header[1]&0x80 != 0
+
+	if header[0]&0x70 != 0 || masked == ws.client {
+		err = errWSProtocol
+		return
+	}
+
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(ws.r, ext[:]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(ws.r, ext[:]); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	if opcode&0x8 != 0 && (!fin || length > maxWSControlSize) {
+		err = errWSProtocol
+		return
+	}
+
+	if length > maxWSMessageSize {
+		err = errWSMessageLen
+		return
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err = io.ReadFull(ws.r, mask[:]); err != nil {
+			return
+		}
+	}
+
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(ws.r, payload); err != nil {
+		return
+	}
+
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+
+	return
+}
+
+func (ws *wsConn) Write(p []byte) (n int, err error) {
+	if err = ws.writeFrame(ws.opcode, p); err != nil {
+		return
+	}
+
+	return len(p), nil
+}
+
+// writeFrame sends payload as a single frame.
+func (ws *wsConn) writeFrame(opcode byte, payload []byte) (err error) {
+	frame := make([]byte, 0, len(payload)+14)
+	frame = append(frame, 0x80|opcode)
+
+	var maskBit byte
+	if ws.client {
+		maskBit = 0x80
+	}
+
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, maskBit|byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, maskBit|126, byte(n>>8), byte(n))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+
+	if ws.client {
+		var mask [4]byte
+		if _, err = rand.Read(mask[:]); err != nil {
+			return
+		}
+		frame = append(frame, mask[:]...)
+		for i, b := range payload {
+			frame = append(frame, b^mask[i%4])
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+
+	ws.wm.Lock()
+	defer ws.wm.Unlock()
+
+	_, err = ws.Conn.Write(frame)
+	return
+}
+
+// Close sends a close frame before closing the connection.
+func (ws *wsConn) Close() (err error) {
+	ws.closeOnce.Do(func() {
+		_ = ws.Conn.SetWriteDeadline(time.Now().Add(time.Second))
+		_ = ws.writeFrame(wsClose, nil)
+	})
+
+	return ws.Conn.Close()
+}
+
+func wsAcceptKey(key string) string {
+	h := sha1.Sum([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+func headerContains(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, v := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// sameOrigin reports whether the Origin of r, if any, is the host r was sent
+// to.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// ServeWS upgrades the HTTP request to a WebSocket and serves it as a
+// connection, each message carrying one frame. Messages are sent as text with
+// JSON codecs and as binary with the others. Unlike with ServeHTTP, handlers
+// can call back into the client and report progress. Upgrades from another
+// origin are refused, see CheckOrigin.
+func (s *Server) ServeWS(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != http.MethodGet || key == "" ||
+		!headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "expected a WebSocket upgrade", http.StatusBadRequest)
+		return
+	}
+
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported WebSocket version", http.StatusUpgradeRequired)
+		return
+	}
+
+	checkOrigin := s.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+	if !checkOrigin(r) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "connection can't be upgraded", http.StatusInternalServerError)
+		return
+	}
+
+	rw, buf, err := hijacker.Hijack()
+	if err != nil {
+		s.logf("jsonrpc: websocket upgrade: %v", err)
+		return
+	}
+
+	_, err = buf.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + wsAcceptKey(key) + "\r\n\r\n")
+	if err == nil {
+		err = buf.Flush()
+	}
+	if err != nil {
+		_ = rw.Close()
+		return
+	}
+
+	ws := newWSConn(rw, buf.Reader, false)
+	conn := newConnection(s, ws)
+	if _, ok := conn.codec.(*JSONCodec); !ok {
+		ws.opcode = wsBinary
+	}
+	if r.TLS != nil {
+		conn.info.Peer = peerIdentity(*r.TLS)
+	}
+	conn.Serve()
+}
+
+// ListenAndServeWS listens on the TCP address addr and serves WebSocket
+// connections with ServeWS on every path.
+func (s *Server) ListenAndServeWS(addr string) error {
+	return http.ListenAndServe(addr, http.HandlerFunc(s.ServeWS))
+}
+
+// DialWS connects to the WebSocket JSON-RPC server at rawURL, a ws:// or wss://
+// URL.
+func DialWS(rawURL string) (c *Client, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "wss" {
+			port = "443"
+		}
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	var conn net.Conn
+	switch u.Scheme {
+	case "ws":
+		conn, err = net.Dial("tcp", host)
+	case "wss":
+		conn, err = tls.Dial("tcp", host, &tls.Config{ServerName: u.Hostname()})
+	default:
+		err = errors.New("websocket URL scheme must be ws or wss")
+	}
+	if err != nil {
+		return
+	}
+
+	ws, err := wsHandshake(conn, u)
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+
+	c = newClient(host, ws, nil)
+	return
+}
+
+// wsHandshake upgrades conn to a WebSocket to u.
+func wsHandshake(conn net.Conn, u *url.URL) (ws *wsConn, err error) {
+	var nonce [16]byte
+	if _, err = rand.Read(nonce[:]); err != nil {
+		return
+	}
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        u,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Upgrade":               {"websocket"},
+			"Connection":            {"Upgrade"},
+			"Sec-WebSocket-Key":     {key},
+			"Sec-WebSocket-Version": {"13"},
+		},
+		Host: u.Host,
+	}
+
+	if err = req.Write(conn); err != nil {
+		return
+	}
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		return
+	}
+
+	if resp.StatusCode != http.StatusSwitchingProtocols ||
+		resp.Header.Get("Sec-WebSocket-Accept") != wsAcceptKey(key) {
+		err = ErrWSHandshake
+		return
+	}
+
+	ws = newWSConn(conn, r, true)
+	return
+}
@@ -0,0 +1,232 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newWSServer(t *testing.T, s *Server) (addr string) {
+	if err := s.RegisterFunc("Echo.Int", func(ctx context.Context, in int) (int, error) { return in, nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	hs := httptest.NewServer(http.HandlerFunc(s.ServeWS))
+	t.Cleanup(hs.Close)
+	return strings.TrimPrefix(hs.URL, "http://")
+}
+
+// wsUpgrade asks the server at addr for an upgrade, sent from a page of origin
+// if not empty, and returns the client end of the WebSocket if it is accepted.
+func wsUpgrade(t *testing.T, addr, origin string) (ws *wsConn, status int) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	req, _ := http.NewRequest(http.MethodGet, "http://"+addr+"/", nil)
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	if err = req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		ws = newWSConn(conn, r, true)
+	}
+	return ws, resp.StatusCode
+}
+
+func TestWSCall(t *testing.T) {
+	addr := newWSServer(t, NewServer(""))
+
+	c, err := DialWS("ws://" + addr + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var out int
+	if err = c.Call("Echo.Int", 42, &out); err != nil || out != 42 {
+		t.Fatalf("Echo.Int(42) = %d, %v", out, err)
+	}
+}
+
+func TestWSOrigin(t *testing.T) {
+	addr := newWSServer(t, NewServer(""))
+
+	tests := []struct {
+		origin string
+		status int
+	}{
+		{"", http.StatusSwitchingProtocols},
+		{"http://" + addr, http.StatusSwitchingProtocols},
+		{"https://evil.example", http.StatusForbidden},
+		{"http://" + addr + ".evil.example", http.StatusForbidden},
+		{"::", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		if _, status := wsUpgrade(t, addr, test.origin); status != test.status {
+			t.Errorf("upgrade from %q: status %d, want %d", test.origin, status, test.status)
+		}
+	}
+
+	s := NewServer("")
+	s.CheckOrigin = func(r *http.Request) bool {
+		return r.Header.Get("Origin") == "https://app.example"
+	}
+	addr = newWSServer(t, s)
+
+	if _, status := wsUpgrade(t, addr, "https://app.example"); status != http.StatusSwitchingProtocols {
+		t.Errorf("upgrade from an allowed origin: status %d", status)
+	}
+	if _, status := wsUpgrade(t, addr, "http://"+addr); status != http.StatusForbidden {
+		t.Errorf("upgrade from an origin CheckOrigin rejects: status %d", status)
+	}
+}
+
+// rawWSFrame encodes a frame with the given first header byte, masked with a
+// zero mask if masked.
+func rawWSFrame(head byte, masked bool, payload []byte) []byte {
+	frame := []byte{head}
+
+	var maskBit byte
+	if masked {
+		maskBit = 0x80
+	}
+	if n := len(payload); n < 126 {
+		frame = append(frame, maskBit|byte(n))
+	} else {
+		frame = append(frame, maskBit|126, byte(n>>8), byte(n))
+	}
+	if masked {
+		frame = append(frame, 0, 0, 0, 0)
+	}
+	return append(frame, payload...)
+}
+
+func TestWSProtocolViolations(t *testing.T) {
+	addr := newWSServer(t, NewServer(""))
+
+	call := []byte(`{"method":"Echo.Int","params":[1],"id":1}`)
+	tests := []struct {
+		name  string
+		frame []byte
+	}{
+		{"unmasked", rawWSFrame(0x80|wsText, false, call)},
+		{"reserved bits", rawWSFrame(0xC0|wsText, true, call)},
+		{"large ping", rawWSFrame(0x80|wsPing, true, make([]byte, maxWSControlSize+1))},
+		{"fragmented ping", rawWSFrame(wsPing, true, nil)},
+		{"fragmented close", rawWSFrame(wsClose, true, nil)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ws, status := wsUpgrade(t, addr, "")
+			if ws == nil {
+				t.Fatalf("upgrade: status %d", status)
+			}
+
+			frames := append(test.frame, rawWSFrame(0x80|wsText, true, call)...)
+			if _, err := ws.Conn.Write(frames); err != nil {
+				t.Fatal(err)
+			}
+
+			// the server only answers with a close frame before hanging up
+			for {
+				_, opcode, payload, err := ws.readFrame()
+				if err == io.EOF {
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if opcode != wsClose {
+					t.Fatalf("got a frame with opcode %d: %s", opcode, payload)
+				}
+			}
+		})
+	}
+
+	// control frames of up to 125 bytes are answered
+	ws, status := wsUpgrade(t, addr, "")
+	if ws == nil {
+		t.Fatalf("upgrade: status %d", status)
+	}
+	ping := make([]byte, maxWSControlSize)
+	if _, err := ws.Conn.Write(rawWSFrame(0x80|wsPing, true, ping)); err != nil {
+		t.Fatal(err)
+	}
+	if _, opcode, payload, err := ws.readFrame(); err != nil || opcode != wsPong || len(payload) != len(ping) {
+		t.Fatalf("ping answered with opcode %d, %d bytes, %v", opcode, len(payload), err)
+	}
+}
+
+func TestWSOpcodes(t *testing.T) {
+	tests := []struct {
+		codec  CodecFactory
+		opcode byte
+	}{
+		{nil, wsText},
+		{NewMessagePackCodec, wsBinary},
+		{NewCBORCodec, wsBinary},
+	}
+	for _, test := range tests {
+		s := NewServer("")
+		s.Protocol = ProtocolJSONRPC2
+		s.Codec = test.codec
+		addr := newWSServer(t, s)
+
+		ws, status := wsUpgrade(t, addr, "")
+		if ws == nil {
+			t.Fatalf("upgrade: status %d", status)
+		}
+		codec := s.codec()(ws)
+
+		call := json.RawMessage(`{"jsonrpc":"2.0","method":"Echo.Int","params":[7],"id":1}`)
+		if err := codec.Encode(&call); err != nil {
+			t.Fatal(err)
+		}
+
+		_, opcode, payload, err := ws.readFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if opcode != test.opcode {
+			t.Errorf("%s: response sent with opcode %d, want %d", codecName(codec), opcode, test.opcode)
+		}
+
+		ws.payload = payload
+		var resp struct {
+			Result int `json:"result"`
+		}
+		var frame json.RawMessage
+		if err = codec.Decode(&frame); err != nil {
+			t.Fatal(err)
+		}
+		if err = json.Unmarshal(frame, &resp); err != nil || resp.Result != 7 {
+			t.Errorf("%s: response %s, %v", codecName(codec), frame, err)
+		}
+	}
+}
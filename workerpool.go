@@ -0,0 +1,87 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// workerPool runs jobs on at most max goroutines, started when jobs are queued
+// and exiting once the queue is empty.
+type workerPool struct {
+	jobs chan func()
+
+	m       sync.Mutex
+	workers int
+	max     int
+}
+
+func (s *Server) workers() *workerPool {
+	s.poolOnce.Do(func() {
+		queue := s.HandlerQueue
+		if queue <= 0 {
+			queue = s.HandlerWorkers
+		}
+
+		s.pool = &workerPool{
+			jobs: make(chan func(), queue),
+			max:  s.HandlerWorkers,
+		}
+	})
+
+	return s.pool
+}
+
+// submit queues job, reporting false if the queue is full.
+func (p *workerPool) submit(job func()) bool {
+	select {
+	case p.jobs <- job:
+	default:
+		return false
+	}
+
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	if p.workers < p.max {
+		p.workers++
+		go p.work()
+	}
+
+	return true
+}
+
+// work runs queued jobs until the queue is empty.
+func (p *workerPool) work() {
+	for {
+		select {
+		case job := <-p.jobs:
+			job()
+			continue
+		default:
+		}
+
+		p.m.Lock()
+		if len(p.jobs) == 0 {
+			p.workers--
+			p.m.Unlock()
+			return
+		}
+		p.m.Unlock()
+	}
+}
+
+// rejectFrame answers raw, which there was no room for, with a busy error.
+func (conn *Connection) rejectFrame(raw json.RawMessage) {
+	defer conn.done()
+
+	err := newError(CodeServerBusy, "server busy: too many requests queued")
+	if firstByte(raw) == '[' {
+		conn.enqueue(conn.rejectBatch(err))
+		return
+	}
+
+	req, _ := conn.parseRequest(raw)
+	if !req.notification {
+		conn.enqueue(conn.audited(conn.response(req, newErrorResponse(req, err)), req.Method))
+	}
+}
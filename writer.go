@@ -0,0 +1,91 @@
+package jsonrpc
+
+import (
+	"time"
+)
+
+const (
+	defaultWriteQueueSize    = 64
+	defaultSlowWriterTimeout = 10 * time.Second
+)
+
+func (s *Server) writeQueueSize() int {
+	if s.WriteQueueSize > 0 {
+		return s.WriteQueueSize
+	}
+	return defaultWriteQueueSize
+}
+
+func (s *Server) slowWriterTimeout() time.Duration {
+	if s.SlowWriterTimeout > 0 {
+		return s.SlowWriterTimeout
+	}
+	return defaultSlowWriterTimeout
+}
+
+// writeLoop encodes queued frames until the queues are empty, those of the
+// control queue first. After a write error the remaining frames are discarded
+// so that senders never block.
+func (conn *Connection) writeLoop() {
+	for {
+		select {
+		case frame := <-conn.control:
+			conn.write(frame)
+			continue
+		default:
+		}
+
+		select {
+		case frame := <-conn.control:
+			conn.write(frame)
+		case frame := <-conn.out:
+			conn.write(frame)
+		default:
+			if conn.writer.exit(conn.queued) {
+				return
+			}
+		}
+	}
+}
+
+func (conn *Connection) write(frame interface{}) {
+	if conn.writeErr != nil {
+		return
+	}
+
+	if rf, ok := frame.(*responseFrame); ok {
+		conn.writeErr = conn.writeAudited(rf)
+		return
+	}
+	conn.writeErr = conn.codec.Encode(frame)
+}
+
+// enqueue queues frame, a response or a batch of responses, for the writer.
+func (conn *Connection) enqueue(frame interface{}) {
+	conn.enqueueOn(conn.out, frame)
+}
+
+// enqueueOn queues frame on queue, the connection's data or control queue, for
+// the writer. If the queue stays full for longer than the server's
+// SlowWriterTimeout the peer is considered stalled and the connection is
+// closed.
+func (conn *Connection) enqueueOn(queue chan interface{}, frame interface{}) {
+	defer conn.writer.start(conn.writeLoop)
+
+	select {
+	case queue <- frame:
+		return
+	default:
+	}
+
+	timer := time.NewTimer(conn.s.slowWriterTimeout())
+	defer timer.Stop()
+
+	select {
+	case queue <- frame:
+	case <-timer.C:
+		conn.s.logf("jsonrpc: closing connection to %s: peer stopped reading", conn.info.RemoteAddr)
+		_ = conn.c.Close()
+		queue <- frame
+	}
+}